@@ -0,0 +1,276 @@
+// Package client는 proglog HTTP API를 호출하는 클라이언트다.
+// JSON 인코딩과 상태 코드를 에러로 바꾸는 일을 대신 해주므로 컨슈머가 직접 구현하지 않아도 된다.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record는 서버의 레코드와 같은 JSON 형태다. Value와 Key는 JSON에서 base64로 인코딩된다.
+type Record struct {
+	Value     []byte    `json:"value"`
+	Offset    uint64    `json:"offset"`
+	Key       []byte    `json:"key,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	// Headers는 레코드에 붙이는 메타데이터로, 서버는 해석하지 않고 그대로 저장한다.
+	Headers map[string]string `json:"headers,omitempty"`
+	// ExpireAt이 있으면 그 시각부터 서버가 레코드를 돌려주지 않는다.
+	ExpireAt time.Time `json:"expireAt,omitzero"`
+}
+
+var (
+	// ErrOffsetNotFound는 오프셋의 레코드가 없을 때 리턴한다. 아직 추가되지 않았거나,
+	// 보존 정책이나 컴팩션으로 삭제되었거나 expireAt이 지난 오프셋이다.
+	ErrOffsetNotFound = errors.New("offset not found")
+	ErrReadOnly       = errors.New("log is read-only")
+	ErrRecordTooLarge = errors.New("record too large")
+)
+
+// 서버 에러 응답의 code를 클라이언트 에러로 바꾼다
+var errorCodes = map[string]error{
+	"offset_not_found":    ErrOffsetNotFound,
+	"offset_out_of_range": ErrOffsetNotFound,
+	"offset_compacted":    ErrOffsetNotFound,
+	"record_expired":      ErrOffsetNotFound,
+	"read_only":           ErrReadOnly,
+	"record_too_large":    ErrRecordTooLarge,
+}
+
+// APIError는 서버가 성공이 아닌 상태 코드로 응답했을 때 리턴한다.
+// errors.Is로 ErrOffsetNotFound 같은 에러와 비교할 수 있다.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("proglog: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("proglog: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap은 code에 맞는 에러를 리턴한다. JSON 에러 응답이 아닌 404는 ErrOffsetNotFound로 본다.
+func (e *APIError) Unwrap() error {
+	if e.Code == "" && e.StatusCode == http.StatusNotFound {
+		return ErrOffsetNotFound
+	}
+	return errorCodes[e.Code]
+}
+
+// Client는 proglog 서버 하나에 요청을 보낸다. 여러 고루틴에서 동시에 사용해도 된다.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+
+	// maxAttempts가 1보다 크면 재시도해도 안전한 요청을 backoff부터 두 배씩 늘려가며 다시 보낸다
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// Option은 New로 만드는 Client의 동작을 바꾸는 함수형 옵션이다.
+type Option func(*Client)
+
+// WithHTTPClient는 요청에 사용할 http.Client를 설정한다. 지정하지 않으면 http.DefaultClient를 사용한다.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetry는 연결이 끊기거나 서버가 5xx로 응답한 요청을 최대 maxAttempts번까지 보낸다.
+// 재시도 간격은 backoff부터 시작해서 매번 두 배로 늘어난다. 4xx 응답은 다시 보내도 같으므로 재시도하지 않는다.
+// 여러 번 읽어도 같은 Consume은 항상 재시도하고, Produce는 레코드가 중복으로 추가될 수 있으므로
+// ProduceIdempotent로 Idempotency-Key를 보낸 경우에만 재시도한다.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts = maxAttempts
+		c.backoff = backoff
+	}
+}
+
+// New는 http://localhost:8080 같은 서버 주소로 Client를 만든다.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("proglog: unsupported URL scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	c := &Client{baseURL: u, httpClient: http.DefaultClient, maxAttempts: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+type produceRequest struct {
+	Record Record `json:"record"`
+}
+
+type produceResponse struct {
+	Offset uint64 `json:"offset"`
+}
+
+type consumeResponse struct {
+	Record Record `json:"record"`
+}
+
+// Produce는 레코드를 로그에 추가하고 그 오프셋을 리턴한다.
+// 응답을 받지 못했을 때 다시 보내면 레코드가 중복될 수 있으므로 WithRetry가 있어도 재시도하지 않는다.
+func (c *Client) Produce(ctx context.Context, record Record) (uint64, error) {
+	return c.produce(ctx, "", record)
+}
+
+// ProduceIdempotent는 Idempotency-Key 헤더와 함께 레코드를 추가한다.
+// 서버가 같은 키로 이미 추가한 레코드의 오프셋을 돌려주므로 WithRetry가 있으면 안전하게 재시도한다.
+func (c *Client) ProduceIdempotent(ctx context.Context, idempotencyKey string, record Record) (uint64, error) {
+	return c.produce(ctx, idempotencyKey, record)
+}
+
+func (c *Client) produce(ctx context.Context, idempotencyKey string, record Record) (uint64, error) {
+	body, err := json.Marshal(produceRequest{Record: record})
+	if err != nil {
+		return 0, err
+	}
+	req := request{method: http.MethodPost, path: "/produce", body: body, retry: idempotencyKey != ""}
+	if idempotencyKey != "" {
+		req.header = http.Header{"Idempotency-Key": {idempotencyKey}}
+	}
+	var res produceResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return 0, err
+	}
+	return res.Offset, nil
+}
+
+// Consume은 오프셋의 레코드를 읽는다. 레코드가 없으면 ErrOffsetNotFound를 감싼 에러를 리턴한다.
+func (c *Client) Consume(ctx context.Context, offset uint64) (Record, error) {
+	query := url.Values{"offset": {strconv.FormatUint(offset, 10)}}
+	var res consumeResponse
+	req := request{method: http.MethodGet, path: "/consume", query: query, retry: true}
+	if err := c.do(ctx, req, &res); err != nil {
+		return Record{}, err
+	}
+	return res.Record, nil
+}
+
+// request는 서버에 보낼 요청 하나다. retry가 true이면 다시 보내도 안전한 요청이다.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	retry  bool
+}
+
+// do는 요청을 보내고 성공하면 응답 바디를 out으로 디코딩한다.
+// 성공이 아닌 상태 코드이면 서버의 JSON 에러 응답을 APIError로 바꾼다.
+// 재시도할 수 있는 요청이 끝내 실패하면 몇 번 시도했는지 에러에 덧붙인다.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	attempts := 1
+	if req.retry && c.maxAttempts > 1 {
+		attempts = c.maxAttempts
+	}
+	backoff := c.backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.send(ctx, req, out)
+		if err == nil || attempt == attempts || !retryable(ctx, err) {
+			if attempt > 1 && err != nil {
+				return fmt.Errorf("proglog: giving up after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("proglog: giving up after %d attempts: %w", attempt, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, out any) error {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var r io.Reader
+	if req.body != nil {
+		r = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	for k, v := range req.header {
+		httpReq.Header[k] = v
+	}
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errorFromResponse(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retryable은 다시 보내면 성공할 수도 있는 에러인지 확인한다.
+// 컨텍스트가 끝났으면 재시도하지 않고, 서버 응답은 5xx 중 501 Not Implemented를 뺀 경우만 재시도한다.
+// 응답이 없는 에러는 연결이 끊기거나 거부된 경우이므로 재시도한다.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 && apiErr.StatusCode != http.StatusNotImplemented
+	}
+	var syntaxErr *json.SyntaxError
+	return !errors.As(err, &syntaxErr)
+}
+
+func errorFromResponse(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(b, &body) == nil {
+		apiErr.Code = body.Error.Code
+		apiErr.Message = body.Error.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(b))
+	}
+	return apiErr
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mokpolar/proglog/internal/server"
+)
+
+// newTestClient는 메모리 Log를 쓰는 실제 서버를 httptest.Server로 띄우고 그 주소의 Client를 만든다.
+func newTestClient(t *testing.T, opts ...server.Option) *Client {
+	t.Helper()
+	opts = append([]server.Option{server.WithLogger(slog.New(slog.DiscardHandler))}, opts...)
+	srv, err := server.NewHTTPServerE(":0", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown(context.Background())
+	})
+	c, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestProduceConsume(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		off, err := c.Produce(ctx, Record{Value: []byte(fmt.Sprintf("record-%d", i)), Key: []byte("k")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off != uint64(i) {
+			t.Fatalf("produce %d: got offset %d", i, off)
+		}
+	}
+	record, err := c.Consume(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(record.Value) != "record-1" || string(record.Key) != "k" || record.Offset != 1 {
+		t.Fatalf("consume 1: got %+v", record)
+	}
+
+	_, err = c.Consume(ctx, 3)
+	if !errors.Is(err, ErrOffsetNotFound) {
+		t.Fatalf("consume past the end: got %v, want %v", err, ErrOffsetNotFound)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "offset_not_found" {
+		t.Fatalf("consume past the end: got %#v", err)
+	}
+}
+
+func TestProduceErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, server.WithMaxRecordBytes(8))
+	if _, err := c.Produce(ctx, Record{Value: make([]byte, 9)}); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("produce too large: got %v, want %v", err, ErrRecordTooLarge)
+	}
+	c = newTestClient(t, server.WithReadOnly(true))
+	if _, err := c.Produce(ctx, Record{Value: []byte("a")}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("produce read-only: got %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestStream(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Produce(ctx, Record{Value: []byte("record-0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 첫 레코드를 받은 뒤에 추가한 레코드도 같은 스트림으로 받는다
+	done := errors.New("done")
+	var got []string
+	err := c.Stream(ctx, 0, func(record Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 1 {
+			if _, err := c.Produce(ctx, Record{Value: []byte("record-1")}); err != nil {
+				return err
+			}
+			return nil
+		}
+		return done
+	})
+	if err != done {
+		t.Fatalf("stream: got %v, want the error returned by fn", err)
+	}
+	if len(got) != 2 || got[0] != "record-0" || got[1] != "record-1" {
+		t.Fatalf("stream: got %q", got)
+	}
+}
+
+// 5xx 응답은 WithRetry의 횟수만큼 다시 보내고, 4xx 응답과 Idempotency-Key가 없는 Produce는 다시 보내지 않는다.
+func TestRetry(t *testing.T) {
+	var requests atomic.Int32
+	status := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"error":{"code":"unavailable","message":"try again"}}`)
+	}))
+	defer ts.Close()
+	c, err := New(ts.URL, WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		status int
+		call   func() error
+		want   int32
+	}{
+		{"consume 503", http.StatusServiceUnavailable, func() error { _, err := c.Consume(ctx, 0); return err }, 3},
+		{"consume 400", http.StatusBadRequest, func() error { _, err := c.Consume(ctx, 0); return err }, 1},
+		{"consume 501", http.StatusNotImplemented, func() error { _, err := c.Consume(ctx, 0); return err }, 1},
+		{"produce 503", http.StatusServiceUnavailable, func() error { _, err := c.Produce(ctx, Record{}); return err }, 1},
+		{"idempotent produce 503", http.StatusServiceUnavailable, func() error { _, err := c.ProduceIdempotent(ctx, "key", Record{}); return err }, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			status = tt.status
+			err := tt.call()
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("got %v, want a %d APIError", err, tt.status)
+			}
+			if got := requests.Load(); got != tt.want {
+				t.Fatalf("got %d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsScheme(t *testing.T) {
+	if _, err := New("ftp://localhost"); err == nil {
+		t.Fatal("New accepted an ftp URL")
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Stream은 offset부터 레코드를 읽어서 fn을 호출하고, 로그의 끝에 도달하면 새 레코드가 추가될 때까지 기다린다.
+// 서버의 /stream 엔드포인트(Server-Sent Events)를 사용한다.
+// ctx가 끝나거나, fn이 에러를 리턴하거나, 연결이 끊기면 그 에러를 리턴한다.
+func (c *Client) Stream(ctx context.Context, offset uint64, fn func(Record) error) error {
+	u := *c.baseURL
+	u.Path += "/stream"
+	u.RawQuery = url.Values{"offset": {strconv.FormatUint(offset, 10)}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorFromResponse(resp)
+	}
+
+	// 이벤트는 빈 줄로 끝나고, data 줄에 레코드 JSON이 들어있다. ':'로 시작하는 heartbeat 주석은 무시한다
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(v, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(data.String()), &record); err != nil {
+			return fmt.Errorf("proglog: malformed stream event: %w", err)
+		}
+		data.Reset()
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("proglog: stream closed by server")
+}
@@ -0,0 +1,150 @@
+// proglog-cli는 실행 중인 proglog 서버에 레코드를 추가하거나 읽는 명령줄 도구다.
+//
+//	proglog-cli [-addr URL] [-o json|plain] produce -value VALUE [-key KEY] [-header NAME=VALUE ...]
+//	proglog-cli [-addr URL] [-o json|plain] consume -offset N
+//	proglog-cli [-addr URL] [-o json|plain] tail [-offset N]
+//
+// 서버 주소는 -addr 플래그, PROGLOG_ADDR 환경 변수, http://localhost:8080 순서로 정한다.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mokpolar/proglog/client"
+)
+
+const defaultAddr = "http://localhost:8080"
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "proglog-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("proglog-cli", flag.ExitOnError)
+	addr := fs.String("addr", envOr("PROGLOG_ADDR", defaultAddr), "server address (or set PROGLOG_ADDR)")
+	output := fs.String("o", "json", "output format: json or plain (record value only)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: proglog-cli [flags] produce|consume|tail [command flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *output != "json" && *output != "plain" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c, err := client.New(*addr)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "produce":
+		return produce(ctx, c, *output, cmdArgs)
+	case "consume":
+		return consume(ctx, c, *output, cmdArgs)
+	case "tail":
+		return tail(ctx, c, *output, cmdArgs)
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func produce(ctx context.Context, c *client.Client, output string, args []string) error {
+	fs := flag.NewFlagSet("produce", flag.ExitOnError)
+	value := fs.String("value", "", "record value")
+	key := fs.String("key", "", "record key (optional)")
+	headers := headerFlag{}
+	fs.Var(headers, "header", "record header as NAME=VALUE (repeatable)")
+	fs.Parse(args)
+
+	record := client.Record{Value: []byte(*value)}
+	if *key != "" {
+		record.Key = []byte(*key)
+	}
+	if len(headers) > 0 {
+		record.Headers = headers
+	}
+	off, err := c.Produce(ctx, record)
+	if err != nil {
+		return err
+	}
+	if output == "plain" {
+		fmt.Println(off)
+		return nil
+	}
+	return json.NewEncoder(os.Stdout).Encode(map[string]uint64{"offset": off})
+}
+
+func consume(ctx context.Context, c *client.Client, output string, args []string) error {
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+	offset := fs.Uint64("offset", 0, "offset to read")
+	fs.Parse(args)
+
+	record, err := c.Consume(ctx, *offset)
+	if err != nil {
+		return err
+	}
+	return printRecord(output, record)
+}
+
+// tail은 offset부터 레코드를 출력하고 Ctrl-C를 누를 때까지 새 레코드를 기다린다.
+func tail(ctx context.Context, c *client.Client, output string, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	offset := fs.Uint64("offset", 0, "offset to start from")
+	fs.Parse(args)
+
+	err := c.Stream(ctx, *offset, func(record client.Record) error {
+		return printRecord(output, record)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// printRecord는 json이면 레코드 전체를 한 줄의 JSON으로, plain이면 값만 출력한다.
+func printRecord(output string, record client.Record) error {
+	if output == "plain" {
+		_, err := fmt.Printf("%s\n", record.Value)
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(record)
+}
+
+// headerFlag는 -header NAME=VALUE를 여러 번 받아서 레코드 헤더로 모은다.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+func (h headerFlag) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("header must be NAME=VALUE, got %q", v)
+	}
+	h[name] = value
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
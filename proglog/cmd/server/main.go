@@ -1,12 +1,362 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/mokpolar/proglog/internal/auth"
+	"github.com/mokpolar/proglog/internal/backup"
+	"github.com/mokpolar/proglog/internal/config"
 	"github.com/mokpolar/proglog/internal/server"
 )
 
 func main() {
-	srv := server.NewHTTPServer(":8080")
-	log.Fatal(srv.ListenAndServe())
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// SIGINT나 SIGTERM을 받으면 ctx가 취소되고, Run이 그레이스풀 셧다운을 시작한다
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// HTTP 서버와 gRPC 서버는 같은 Log를 공유한다
+	commitLog, err := newCommitLog(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 복원하는 동안 요청을 받지 않도록 서버를 시작하기 전에 복원한다
+	if err := restoreLog(ctx, cfg, commitLog); err != nil {
+		log.Fatal(err)
+	}
+
+	gsrv, err := server.NewGRPCServer(commitLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go gsrv.Serve(ln)
+
+	membership, err := newMembership(cfg, commitLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts, err := serverOptions(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if membership != nil {
+		opts = append(opts, server.WithMembership(membership))
+	}
+	audit, err := newAuditLogger(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if audit != nil {
+		opts = append(opts, server.WithAuditLogger(audit))
+	}
+	backups, err := newBackup(cfg, commitLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if backups != nil {
+		opts = append(opts, server.WithBackup(backups))
+		if cfg.Backup.Interval > 0 {
+			go backups.Run(ctx, cfg.Backup.Interval, slog.Default())
+		}
+	}
+	srv, err := server.NewHTTPServerE(cfg.Addr, append(opts, server.WithLog(commitLog))...)
+	// 서버를 만들지 못하면 이미 시작한 gRPC 서버와 Serf, Raft를 멈추고 Log를 닫은 뒤에 에러로 종료한다
+	if err == nil {
+		err = server.Run(ctx, srv, cfg.ShutdownGrace)
+	}
+	gsrv.GracefulStop()
+	// 다른 노드가 이 노드를 실패가 아니라 떠난 것으로 보도록 Raft를 멈추기 전에 Serf에서 먼저 나간다
+	if membership != nil {
+		if lerr := membership.Leave(); lerr != nil {
+			log.Print(lerr)
+		}
+		if cerr := membership.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if c, ok := audit.(interface{ Close() error }); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	// 두 서버가 모두 멈춘 뒤에 Log를 닫아야 버퍼에 남은 레코드까지 디스크에 쓰인다
+	if cerr := commitLog.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// commitLog는 main이 닫는 Log다. Raft 노드라면 DistributedLog가 로컬 Log까지 닫는다.
+type commitLog interface {
+	server.CommitLog
+	Close() error
+}
+
+// newCommitLog는 Raft 설정이 있으면 메모리 Log를 Raft로 복제하는 DistributedLog를, 없으면 dataDir의 파일 Log나 메모리 Log를 만든다.
+func newCommitLog(cfg config.Config) (commitLog, error) {
+	if cfg.DataDir != "" {
+		var c server.Config
+		if cfg.EncryptionKeyFile != "" {
+			key, err := loadEncryptionKey(cfg.EncryptionKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			c.Segment.EncryptionKey = key
+		}
+		return server.NewLogWithConfig(cfg.DataDir, c)
+	}
+	local := server.NewLog()
+	if cfg.Raft.NodeID == "" {
+		return local, nil
+	}
+	return server.NewDistributedLog(local, server.DistributedConfig{
+		NodeID:    cfg.Raft.NodeID,
+		BindAddr:  cfg.Raft.Addr,
+		HTTPAddr:  cfg.Raft.AdvertiseAddr,
+		DataDir:   cfg.Raft.DataDir,
+		Bootstrap: cfg.Raft.Bootstrap,
+	})
+}
+
+// loadEncryptionKey는 path 파일에 16진수로 적힌 암호화 키를 읽는다. 키 길이는 NewLogWithConfig가 확인한다.
+func loadEncryptionKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// newAuditLogger는 감사 로그 파일이 설정되어 있으면 그 파일에, "-"이면 표준 출력에 쓰는 AuditLogger를 만든다.
+func newAuditLogger(cfg config.Config) (server.AuditLogger, error) {
+	switch cfg.AuditFile {
+	case "":
+		return nil, nil
+	case "-":
+		return server.NewWriterAuditLogger(os.Stdout), nil
+	}
+	return server.OpenAuditFile(cfg.AuditFile)
+}
+
+// newBackup은 백업 버킷이 설정되어 있으면 commitLog를 그 버킷에 증분 백업하는 Backup을 만든다.
+func newBackup(cfg config.Config, commitLog commitLog) (*backup.Backup, error) {
+	if cfg.Backup.Bucket == "" {
+		return nil, nil
+	}
+	store, err := backup.NewS3(backup.S3Config{
+		Bucket:   cfg.Backup.Bucket,
+		Region:   cfg.Backup.Region,
+		Endpoint: cfg.Backup.Endpoint,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backup.New(commitLog, store, cfg.Backup.Prefix), nil
+}
+
+// restoreLog는 restoreFrom이 설정되어 있고 로그가 비어있으면 그 백업으로 로그를 복원한다.
+// 이미 레코드가 있거나 백업이 없으면 복원하지 않고 계속 시작하지만, 체크섬이 맞지 않는 등 복원에 실패하면 에러를 리턴해서 시작하지 않는다.
+func restoreLog(ctx context.Context, cfg config.Config, commitLog commitLog) error {
+	if cfg.RestoreFrom == "" {
+		return nil
+	}
+	bucket, prefix, err := backup.ParseLocation(cfg.RestoreFrom)
+	if err != nil {
+		return err
+	}
+	store, err := backup.NewS3(backup.S3Config{
+		Bucket:   bucket,
+		Region:   cfg.Backup.Region,
+		Endpoint: cfg.Backup.Endpoint,
+	})
+	if err != nil {
+		return err
+	}
+	m, err := backup.Restore(ctx, commitLog, store, prefix)
+	switch {
+	case err == nil:
+		log.Printf("restored %d backup objects from %s up to offset %d", len(m.Objects), cfg.RestoreFrom, m.Next)
+	case errors.Is(err, backup.ErrLogNotEmpty):
+		log.Printf("skipping restore from %s: log already has records", cfg.RestoreFrom)
+	case errors.Is(err, backup.ErrNotFound):
+		log.Printf("skipping restore from %s: no backup found", cfg.RestoreFrom)
+	case errors.Is(err, server.ErrNotLeader):
+		log.Printf("skipping restore from %s: the raft leader restores and replicates the log", cfg.RestoreFrom)
+	default:
+		return fmt.Errorf("restore from %s: %w", cfg.RestoreFrom, err)
+	}
+	return nil
+}
+
+// newMembership은 Serf 주소가 설정되어 있으면 Serf로 노드를 찾아서 Raft 클러스터에 추가하고 제거하는 Membership을 만든다.
+func newMembership(cfg config.Config, commitLog commitLog) (*server.Membership, error) {
+	if cfg.Serf.Addr == "" {
+		return nil, nil
+	}
+	return server.NewMembership(commitLog.(server.MembershipHandler), server.MembershipConfig{
+		NodeName:       cfg.Raft.NodeID,
+		BindAddr:       cfg.Serf.Addr,
+		RaftAddr:       cfg.Raft.Addr,
+		HTTPAddr:       cfg.Raft.AdvertiseAddr,
+		StartJoinAddrs: cfg.Serf.Join,
+	})
+}
+
+// loadConfig는 기본 설정, -config 파일, PROGLOG_ 환경 변수, 명령줄에서 직접 준 플래그 순서로 덮어쓴다.
+// 즉 우선순위는 플래그 > 환경 변수 > 파일 > 기본값이다.
+func loadConfig() (config.Config, error) {
+	defaults := config.Default()
+	path := flag.String("config", os.Getenv(config.EnvName("config")), "YAML config file (defaults are used if empty; env "+config.EnvName("config")+")")
+	defaults.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg := config.Default()
+	if *path != "" {
+		var err error
+		if cfg, err = config.LoadConfig(*path); err != nil {
+			return config.Config{}, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return config.Config{}, err
+	}
+	// 플래그로 받은 값은 defaults에 들어있으므로, 직접 준 플래그만 cfg에 다시 적용한다
+	overrides := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	cfg.RegisterFlags(overrides)
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return config.Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// serverOptions는 설정을 NewHTTPServer의 옵션으로 바꾼다.
+func serverOptions(cfg config.Config) ([]server.Option, error) {
+	opts := []server.Option{
+		server.WithReadTimeout(cfg.ReadTimeout),
+		server.WithWriteTimeout(cfg.WriteTimeout),
+		server.WithProduceTimeout(cfg.ProduceTimeout),
+		server.WithConsumeTimeout(cfg.ConsumeTimeout),
+		server.WithLongPollTimeout(cfg.LongPollTimeout),
+		server.WithMaxRecordBytes(cfg.MaxRecordBytes),
+		server.WithMaxHeaderBytes(cfg.MaxHeaderBytes),
+		server.WithMaxBodyBytes(cfg.MaxBodyBytes),
+		server.WithMaxInFlightAppends(cfg.MaxInFlightAppends),
+		server.WithAppendWorkers(cfg.AppendWorkers),
+		server.WithMaxConsumeOffsets(cfg.MaxConsumeOffsets),
+		server.WithRetention(cfg.Retention),
+		server.WithRetentionInterval(cfg.RetentionInterval),
+		server.WithExpirySweep(cfg.ExpirySweepInterval),
+		server.WithCompression(cfg.GzipMinBytes),
+		server.WithProfiling(cfg.Pprof),
+		server.WithSnapshotEnabled(cfg.Snapshot),
+		server.WithTopicDeletionEnabled(cfg.TopicDeletion),
+		server.WithWebhooks(cfg.Webhooks),
+		server.WithDeadLetter(cfg.DeadLetterAttempts),
+		server.WithH2C(cfg.H2C),
+		server.WithCORS(cfg.CORSOrigins),
+		server.WithLeaderRedirect(cfg.Raft.Redirect),
+		server.WithPathPrefix(cfg.PathPrefix),
+		server.WithHealthOutsidePrefix(cfg.HealthOutsidePrefix),
+	}
+	if cfg.Fsync != "" {
+		fsync, err := server.ParseFsyncPolicy(cfg.Fsync)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithFsync(fsync))
+	}
+	if cfg.StoreCompression != "" {
+		codec, err := server.ParseCodec(cfg.StoreCompression)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithStoreCompression(codec))
+	}
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		opts = append(opts, server.WithTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		pool, err := server.LoadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithClientCAs(pool))
+	}
+	if cfg.JWT.KeyFile != "" || cfg.JWT.JWKSURL != "" {
+		v, err := auth.NewJWTVerifier(auth.JWTConfig{
+			KeyFile:  cfg.JWT.KeyFile,
+			JWKSURL:  cfg.JWT.JWKSURL,
+			Issuer:   cfg.JWT.Issuer,
+			Audience: cfg.JWT.Audience,
+			Leeway:   time.Minute,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithTokenVerifier(v))
+	}
+	if cfg.BasicAuthFile != "" {
+		users, err := auth.NewHtpasswd(cfg.BasicAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		reloadOnHangup(users)
+		opts = append(opts, server.WithBasicAuth(users))
+	}
+	if cfg.ACLFile != "" {
+		acl, err := auth.NewACL(cfg.ACLFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithAuthorizer(acl))
+	}
+	return opts, nil
+}
+
+// reloadOnHangup은 SIGHUP을 받을 때마다 htpasswd 파일을 다시 읽는다. 파일이 잘못되었으면 이전 사용자를 그대로 쓴다.
+func reloadOnHangup(users *auth.Htpasswd) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := users.Reload(); err != nil {
+				log.Printf("reload basic auth users: %v", err)
+				continue
+			}
+			log.Print("reloaded basic auth users")
+		}
+	}()
 }
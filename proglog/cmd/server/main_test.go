@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mokpolar/proglog/internal/config"
+	"github.com/mokpolar/proglog/internal/server"
+)
+
+// dataDir를 주면 닫고 다시 연 Log에 레코드가 남아있어야 한다.
+func TestNewCommitLogDataDirReopen(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+
+	log, err := newCommitLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		if _, err := log.Append(server.Record{Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = newCommitLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for off, want := range []string{"a", "b", "c"} {
+		record, err := log.Read(uint64(off))
+		if err != nil {
+			t.Fatalf("read %d after reopen: %v", off, err)
+		}
+		if string(record.Value) != want {
+			t.Fatalf("offset %d: got %q, want %q", off, record.Value, want)
+		}
+	}
+	off, err := log.Append(server.Record{Value: []byte("d")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != 3 {
+		t.Fatalf("append after reopen: got offset %d, want 3", off)
+	}
+}
+
+func TestConfigRejectsDataDirWithRaft(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Raft.NodeID = "node-1"
+	cfg.Raft.Addr = "127.0.0.1:0"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate accepted dataDir with raft.nodeID")
+	}
+}
+
+func TestConfigRejectsFsyncWithoutDataDir(t *testing.T) {
+	cfg := config.Default()
+	cfg.Fsync = "always"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate accepted fsync without dataDir")
+	}
+	cfg.DataDir = t.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate with dataDir: %v", err)
+	}
+	opts, err := serverOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.NewHTTPServerE(":0", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Shutdown(context.Background())
+}
+
+func TestNewCommitLogEncryptionKeyFile(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	cfg.EncryptionKeyFile = filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(cfg.EncryptionKeyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	log, err := newCommitLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(server.Record{Value: []byte("secret value")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := os.ReadFile(filepath.Join(cfg.DataDir, "0.store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(store), "secret value") {
+		t.Fatal("store file contains the plaintext value")
+	}
+
+	// 키 없이 다시 열면 암호화한 세그먼트를 읽을 수 없으므로 시작하지 않는다
+	plain := cfg
+	plain.EncryptionKeyFile = ""
+	if _, err := newCommitLog(plain); !errors.Is(err, server.ErrInvalidEncryptionKey) {
+		t.Fatalf("reopen without the key: got %v, want %v", err, server.ErrInvalidEncryptionKey)
+	}
+
+	if err := os.WriteFile(cfg.EncryptionKeyFile, []byte("abcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCommitLog(cfg); !errors.Is(err, server.ErrInvalidEncryptionKey) {
+		t.Fatalf("2 byte key: got %v, want %v", err, server.ErrInvalidEncryptionKey)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ACL은 정책 파일에 적힌 (subject, object, action) 규칙으로 권한을 확인한다.
+// 정책 파일은 한 줄에 규칙 하나를 "subject,object,action" 형식으로 적고,
+// 각 항목에 *를 쓰면 모든 값과 일치한다. 빈 줄과 #으로 시작하는 줄은 무시한다.
+//
+//	# root는 모든 작업을 할 수 있다
+//	root,*,*
+//	reader,*,read
+type ACL struct {
+	rules []rule
+}
+
+type rule struct {
+	subject, object, action string
+}
+
+// NewACL은 policyFile을 읽어서 ACL을 만든다.
+func NewACL(policyFile string) (*ACL, error) {
+	f, err := os.Open(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &ACL{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected subject,object,action", policyFile, line)
+		}
+		a.rules = append(a.rules, rule{
+			subject: strings.TrimSpace(fields[0]),
+			object:  strings.TrimSpace(fields[1]),
+			action:  strings.TrimSpace(fields[2]),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authorize는 subject가 object에 action을 할 수 있는 규칙이 있으면 nil을,
+// 없으면 ErrPermissionDenied를 감싼 에러를 리턴한다.
+func (a *ACL) Authorize(subject, object, action string) error {
+	for _, r := range a.rules {
+		if match(r.subject, subject) && match(r.object, object) && match(r.action, action) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s not permitted to %s to %s", ErrPermissionDenied, subject, action, object)
+}
+
+func match(pattern, value string) bool {
+	return pattern == "*" || pattern == value
+}
+
+var ErrPermissionDenied = fmt.Errorf("permission denied")
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrBadCredentials는 사용자가 없거나 비밀번호가 맞지 않을 때 리턴한다. 어느 쪽인지는 알려주지 않는다.
+var ErrBadCredentials = errors.New("bad credentials")
+
+// StaticCredentials는 사용자 이름 -> 비밀번호 맵이다. 테스트나 설정 파일 없이 띄우는 개발용 서버에서 쓴다.
+type StaticCredentials map[string]string
+
+// VerifyPassword는 username의 비밀번호가 password와 같은지 확인한다.
+func (c StaticCredentials) VerifyPassword(username, password string) error {
+	want, ok := c[username]
+	// 비교 시간으로 비밀번호 길이를 알 수 없도록 해시끼리 비교한다
+	got, expected := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(want))
+	if subtle.ConstantTimeCompare(got[:], expected[:]) != 1 || !ok {
+		return ErrBadCredentials
+	}
+	return nil
+}
+
+// Htpasswd는 Apache htpasswd 파일의 사용자로 비밀번호를 확인한다. 파일은 한 줄에 "user:hash" 하나이고,
+// hash는 htpasswd -m으로 만든 $apr1$(MD5)이나 htpasswd -s로 만든 {SHA}다.
+// bcrypt($2y$)는 지원하지 않으므로 파일을 읽을 때 에러를 리턴한다. 빈 줄과 #으로 시작하는 줄은 무시한다.
+//
+//	$ htpasswd -c -m users.htpasswd alice
+type Htpasswd struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewHtpasswd는 path의 htpasswd 파일을 읽는다.
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload는 파일을 다시 읽어서 사용자를 바꾼다. 파일이 잘못되었으면 에러를 리턴하고 이전 사용자를 그대로 쓴다.
+func (h *Htpasswd) Reload() error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("%s:%d: expected user:hash", h.path, line)
+		}
+		if !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+			return fmt.Errorf("%s:%d: unsupported hash for %s (use htpasswd -m or -s)", h.path, line, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+	return nil
+}
+
+// VerifyPassword는 파일에 있는 username의 해시가 password와 맞는지 확인한다.
+func (h *Htpasswd) VerifyPassword(username, password string) error {
+	h.mu.RLock()
+	hash, ok := h.users[username]
+	h.mu.RUnlock()
+	if !ok {
+		return ErrBadCredentials
+	}
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1(password, salt)
+	}
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) != 1 {
+		return ErrBadCredentials
+	}
+	return nil
+}
+
+// apr1은 Apache의 MD5 crypt로 password를 해시한다. salt는 최대 8자까지만 쓴다.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw, s := []byte(password), []byte(salt)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic))
+	ctx.Write(s)
+	for i := len(pw); i > 0; i -= 16 {
+		ctx.Write(altSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write(s)
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+	return magic + salt + "$" + out.String()
+}
@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken은 토큰의 형식이나 서명, 클레임이 맞지 않을 때 리턴한다.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired는 exp가 지난 토큰이다. ErrInvalidToken도 감싼다.
+	ErrTokenExpired = fmt.Errorf("%w: token expired", ErrInvalidToken)
+)
+
+// JWTConfig는 JWTVerifier가 토큰의 서명을 확인할 키를 어디서 가져올지와 확인할 클레임을 정한다.
+// KeyFile과 JWKSURL 중 하나만 준다.
+type JWTConfig struct {
+	// KeyFile이 PEM 공개 키(RSA, ECDSA)이면 RS*, ES* 토큰을 확인하고,
+	// 아니면 파일 내용 전체를 HMAC 비밀 키로 보고 HS* 토큰을 확인한다.
+	KeyFile string
+	// JWKSURL은 공개 키 목록(JWK Set)을 받아올 주소다. 토큰 헤더의 kid로 키를 고르고,
+	// 모르는 kid가 오면 키를 교체했을 수 있으므로 목록을 다시 받는다.
+	JWKSURL string
+	// Issuer와 Audience가 있으면 토큰의 iss, aud 클레임이 같아야 한다.
+	Issuer   string
+	Audience string
+	// Leeway는 exp와 nbf를 확인할 때 허용하는 시계 오차다.
+	Leeway time.Duration
+	// Client는 JWKS를 받아올 때 쓴다. 없으면 10초 타임아웃인 클라이언트를 쓴다.
+	Client *http.Client
+}
+
+// JWKS를 다시 받는 간격과, 모르는 kid 때문에 다시 받을 때 최소한 기다리는 간격
+const (
+	jwksRefreshInterval = 5 * time.Minute
+	jwksMinRefresh      = 30 * time.Second
+)
+
+// JWTVerifier는 Authorization: Bearer로 받은 JWT의 서명과 exp, nbf, iss, aud를 확인하고 sub를 요청자로 리턴한다.
+// 서명 알고리즘은 HS256/384/512, RS256/384/512, ES256/384/512를 지원하고, 키 종류와 맞지 않는 alg는 거절한다.
+type JWTVerifier struct {
+	config JWTConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]jwk
+	fetchedAt time.Time
+}
+
+// jwk는 서명을 확인할 키 하나다. alg가 있으면 그 알고리즘의 토큰만 확인한다.
+type jwk struct {
+	alg  string
+	hmac []byte
+	pub  crypto.PublicKey
+}
+
+// NewJWTVerifier는 config로 JWTVerifier를 만든다. KeyFile은 바로 읽고, JWKS는 처음 토큰을 확인할 때 받는다.
+// 그래서 키 서버가 잠깐 내려가 있어도 서버는 시작할 수 있다.
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if (config.KeyFile == "") == (config.JWKSURL == "") {
+		return nil, errors.New("jwt: exactly one of key file and JWKS URL is required")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	v := &JWTVerifier{config: config, now: time.Now}
+	if config.KeyFile != "" {
+		key, err := readKeyFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = map[string]jwk{"": key}
+	}
+	return v, nil
+}
+
+// readKeyFile은 PEM 공개 키나 HMAC 비밀 키를 읽는다. 비밀 키 끝의 줄바꿈은 편집기가 붙인 것으로 보고 뗀다.
+func readKeyFile(path string) (jwk, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return jwk{}, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		secret := []byte(strings.TrimRight(string(b), "\r\n"))
+		if len(secret) == 0 {
+			return jwk{}, fmt.Errorf("jwt: %s is empty", path)
+		}
+		return jwk{hmac: secret}, nil
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return jwk{}, fmt.Errorf("jwt: %s: %w", path, err)
+		}
+		return jwk{pub: pub}, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return jwk{}, fmt.Errorf("jwt: %s: %w", path, err)
+		}
+		return jwk{pub: cert.PublicKey}, nil
+	}
+	return jwk{}, fmt.Errorf("jwt: %s: unsupported PEM block %q", path, block.Type)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  audience    `json:"aud"`
+	ExpiresAt json.Number `json:"exp"`
+	NotBefore json.Number `json:"nbf"`
+}
+
+// audience는 문자열 하나이거나 문자열 배열인 aud 클레임이다.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// Verify는 token을 확인하고 sub 클레임을 리턴한다. exp가 없는 토큰은 영원히 쓸 수 있으므로 거절한다.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", err
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := key.verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+	now := v.now()
+	exp, err := numericDate(claims.ExpiresAt)
+	if err != nil || exp.IsZero() {
+		return "", fmt.Errorf("%w: missing or invalid exp", ErrInvalidToken)
+	}
+	if now.After(exp.Add(v.config.Leeway)) {
+		return "", ErrTokenExpired
+	}
+	nbf, err := numericDate(claims.NotBefore)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid nbf", ErrInvalidToken)
+	}
+	if !nbf.IsZero() && now.Add(v.config.Leeway).Before(nbf) {
+		return "", fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.config.Issuer != "" && claims.Issuer != v.config.Issuer {
+		return "", fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.config.Audience != "" && !slices.Contains(claims.Audience, v.config.Audience) {
+		return "", fmt.Errorf("%w: token is not for %q", ErrInvalidToken, v.config.Audience)
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	return claims.Subject, nil
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// numericDate는 1970년부터 센 초인 exp, nbf를 시각으로 바꾼다. 클레임이 없으면 제로 값을 리턴한다.
+func numericDate(n json.Number) (time.Time, error) {
+	if n == "" {
+		return time.Time{}, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+}
+
+// key는 kid에 맞는 키를 찾는다. JWKS는 오래되었거나 모르는 kid가 오면 다시 받는다.
+func (v *JWTVerifier) key(ctx context.Context, kid string) (jwk, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.config.JWKSURL == "" {
+		return v.keys[""], nil
+	}
+	key, ok := v.lookup(kid)
+	since := v.now().Sub(v.fetchedAt)
+	if v.keys == nil || since >= jwksRefreshInterval || (!ok && since >= jwksMinRefresh) {
+		keys, err := v.fetchJWKS(ctx)
+		if err != nil {
+			// 받아둔 키가 있으면 키 서버가 내려가 있는 동안에도 계속 쓴다
+			if ok {
+				return key, nil
+			}
+			return jwk{}, err
+		}
+		v.keys, v.fetchedAt = keys, v.now()
+		key, ok = v.lookup(kid)
+	}
+	if !ok {
+		return jwk{}, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// lookup은 kid의 키를 찾는다. 토큰에 kid가 없고 키가 하나뿐이면 그 키를 쓴다.
+func (v *JWTVerifier) lookup(kid string) (jwk, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return jwk{}, false
+}
+
+// fetchJWKS는 JWKSURL에서 서명용 RSA, EC 키를 받아온다. 모르는 종류의 키는 건너뛴다.
+func (v *JWTVerifier) fetchJWKS(ctx context.Context) (map[string]jwk, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: fetch JWKS: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwt: fetch JWKS: %s", res.Status)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwt: decode JWKS: %w", err)
+	}
+	keys := make(map[string]jwk)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		switch k.Kty {
+		case "RSA":
+			n, nerr := decodeBigInt(k.N)
+			e, eerr := decodeBigInt(k.E)
+			if nerr != nil || eerr != nil || !e.IsInt64() {
+				continue
+			}
+			pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := ecCurve(k.Crv)
+			x, xerr := decodeBigInt(k.X)
+			y, yerr := decodeBigInt(k.Y)
+			if curve == nil || xerr != nil || yerr != nil {
+				continue
+			}
+			pub = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			continue
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, pub: pub}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func ecCurve(crv string) elliptic.Curve {
+	switch crv {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
+
+// algHashes는 지원하는 alg와 그 alg가 쓰는 해시다. none은 없으므로 서명하지 않은 토큰은 거절한다.
+var algHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// esAlgs는 ECDSA 커브마다 쓸 수 있는 alg다.
+var esAlgs = map[string]string{"P-256": "ES256", "P-384": "ES384", "P-521": "ES512"}
+
+// verify는 alg로 signed의 서명 sig를 확인한다. HMAC 키로 RS256 토큰을 확인하는 것처럼 키와 맞지 않는 alg는 거절한다.
+func (k jwk) verify(alg string, signed, sig []byte) error {
+	if k.alg != "" && k.alg != alg {
+		return fmt.Errorf("%w: key is for %s, token uses %s", ErrInvalidToken, k.alg, alg)
+	}
+	hash, ok := algHashes[alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	var valid bool
+	switch pub := k.pub.(type) {
+	case nil:
+		if !strings.HasPrefix(alg, "HS") || k.hmac == nil {
+			break
+		}
+		mac := hmac.New(hash.New, k.hmac)
+		mac.Write(signed)
+		valid = hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		valid = strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		// ES 서명은 r과 s를 커브 크기만큼 이어붙인 값이다
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg != esAlgs[pub.Curve.Params().Name] || len(sig) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		valid = ecdsa.Verify(pub, digest, r, s)
+	}
+	if !valid {
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Package backup은 로그를 S3 호환 오브젝트 저장소에 증분 백업한다.
+//
+// 백업 하나는 지난 백업 뒤에 추가된 레코드를 Log.Reader와 같은 NDJSON으로 담은 오브젝트이고,
+// prefix 아래의 manifest.json이 오브젝트 목록과 다음 백업이 시작할 오프셋을 기록한다.
+//
+//	<prefix>/manifest.json
+//	<prefix>/00000000000000000000-00000000000000000041.ndjson
+//	<prefix>/00000000000000000042-00000000000000000107.ndjson
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mokpolar/proglog/internal/server"
+)
+
+// ErrNotFound는 저장소에 key의 오브젝트가 없을 때 리턴한다.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectStore는 백업 오브젝트를 저장하는 곳이다. S3가 기본 구현이다.
+type ObjectStore interface {
+	// Put은 body를 key에 쓴다. 서명할 때 바디의 해시를 구하므로 body를 처음부터 다시 읽을 수 있어야 한다.
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	// Get은 key의 오브젝트를 읽는다. 없으면 ErrNotFound를 리턴한다.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// 매니페스트의 오브젝트 이름
+const manifestName = "manifest.json"
+
+// Manifest는 prefix 아래에 올린 백업 오브젝트의 목록이다. Next는 마지막 백업의 다음 오프셋이고, 다음 백업은 Next부터 올린다.
+type Manifest struct {
+	Next    uint64   `json:"next"`
+	Objects []Object `json:"objects"`
+}
+
+// Object는 백업 오브젝트 하나이고, [First, Next) 범위의 레코드를 담는다.
+// 컴팩션으로 지워진 오프셋은 줄이 없고, 보존 정책으로 백업하기 전에 지워진 레코드가 있으면 First가 이전 오브젝트의 Next보다 크다.
+type Object struct {
+	Key    string    `json:"key"`
+	First  uint64    `json:"first"`
+	Next   uint64    `json:"next"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Time   time.Time `json:"time"`
+}
+
+// Backup은 log를 store의 prefix 아래에 증분 백업한다. 백업은 한 번에 하나씩 실행된다.
+type Backup struct {
+	log    server.CommitLog
+	store  ObjectStore
+	prefix string
+
+	mu sync.Mutex
+}
+
+var _ server.Backuper = (*Backup)(nil)
+
+// New는 log를 store의 prefix 아래에 백업하는 Backup을 만든다. prefix가 비어있으면 버킷의 최상위에 쓴다.
+func New(log server.CommitLog, store ObjectStore, prefix string) *Backup {
+	return &Backup{log: log, store: store, prefix: prefix}
+}
+
+// Manifest는 저장소의 매니페스트를 읽는다. 아직 백업한 적이 없으면 빈 매니페스트를 리턴한다.
+func (b *Backup) Manifest(ctx context.Context) (Manifest, error) {
+	var m Manifest
+	body, err := b.store.Get(ctx, b.key(manifestName))
+	if errors.Is(err, ErrNotFound) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return m, fmt.Errorf("read %s: %w", b.key(manifestName), err)
+	}
+	return m, nil
+}
+
+// Backup은 매니페스트의 Next부터 지금 마지막 레코드까지를 오브젝트 하나로 올리고 매니페스트를 갱신한다.
+// 레코드를 임시 파일에 쓰면서 SHA-256을 구하므로 로그 전체를 메모리에 올리지 않는다. 새 레코드가 없으면 아무것도 올리지 않는다.
+// 로그를 비우거나 복원해서 로그의 끝이 매니페스트의 Next보다 앞이면 이어서 백업할 수 없으므로 ErrOffsetOutOfRange를 리턴한다.
+func (b *Backup) Backup(ctx context.Context) (server.BackupResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, err := b.Manifest(ctx)
+	if err != nil {
+		return server.BackupResult{}, err
+	}
+	// 백업하기 전에 보존 정책으로 지워진 레코드는 건너뛴다
+	from := max(m.Next, b.log.LowestOffset())
+	records, next, err := server.ExportFrom(b.log, from)
+	if err != nil {
+		return server.BackupResult{}, err
+	}
+	if next < m.Next {
+		return server.BackupResult{}, fmt.Errorf("%w: log ends at offset %d before the last backup at %d",
+			server.ErrOffsetOutOfRange, next, m.Next)
+	}
+	result := server.BackupResult{FirstOffset: from, NextOffset: next}
+	if next <= from {
+		return result, nil
+	}
+
+	f, err := os.CreateTemp("", "proglog-backup-*.ndjson")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), records)
+	if err != nil {
+		return result, fmt.Errorf("read log: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return result, err
+	}
+	obj := Object{
+		Key:    b.key(fmt.Sprintf("%020d-%020d.ndjson", from, next-1)),
+		First:  from,
+		Next:   next,
+		Size:   size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Time:   time.Now().UTC(),
+	}
+	if err := b.store.Put(ctx, obj.Key, f); err != nil {
+		return result, fmt.Errorf("upload %s: %w", obj.Key, err)
+	}
+
+	// 매니페스트는 오브젝트를 올린 뒤에 쓰므로, 그 사이에 실패하면 다음 백업이 같은 범위를 다시 올린다
+	m.Objects = append(m.Objects, obj)
+	m.Next = next
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return result, err
+	}
+	if err := b.store.Put(ctx, b.key(manifestName), bytes.NewReader(data)); err != nil {
+		return result, fmt.Errorf("upload %s: %w", b.key(manifestName), err)
+	}
+	result.Object, result.Bytes = obj.Key, size
+	return result, nil
+}
+
+// Run은 ctx가 끝날 때까지 interval마다 Backup을 실행한다. 실패하면 logger에 남기고 다음 주기에 다시 시도한다.
+// Raft 노드라면 같은 prefix에 여러 노드가 쓰지 않도록 리더만 백업한다.
+func (b *Backup) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if l, ok := b.log.(interface{ IsLeader() bool }); ok && !l.IsLeader() {
+			continue
+		}
+		result, err := b.Backup(ctx)
+		if err != nil {
+			logger.Error("backup failed", slog.Any("error", err))
+			continue
+		}
+		if result.Object != "" {
+			logger.Info("backup uploaded",
+				slog.String("object", result.Object),
+				slog.Uint64("first_offset", result.FirstOffset),
+				slog.Uint64("next_offset", result.NextOffset),
+				slog.Int64("bytes", result.Bytes),
+			)
+		}
+	}
+}
+
+func (b *Backup) key(name string) string {
+	return path.Join(b.prefix, name)
+}
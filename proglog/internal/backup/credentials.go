@@ -0,0 +1,342 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCredentials는 자격 증명 체인의 어느 곳에서도 AWS 자격 증명을 찾지 못했을 때 리턴한다.
+var ErrNoCredentials = errors.New("no AWS credentials found")
+
+// Credentials는 요청에 서명할 AWS 자격 증명이다. Expires가 0이면 만료되지 않는다.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// CredentialsProvider는 서명할 때마다 자격 증명을 돌려준다. 여러 고루틴에서 동시에 호출해도 안전해야 한다.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials는 항상 같은 자격 증명을 돌려준다.
+type StaticCredentials Credentials
+
+func (c StaticCredentials) Retrieve(context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// 임시 자격 증명이 만료되기 이만큼 전에 새로 받는다
+const credentialsRefreshWindow = 5 * time.Minute
+
+// 환경 변수로 바꾸지 않은 컨테이너와 EC2 메타데이터 주소
+const (
+	containerCredentialsHost = "http://169.254.170.2"
+	imdsEndpoint             = "http://169.254.169.254"
+)
+
+// DefaultCredentials는 AWS SDK의 기본 자격 증명 체인과 같은 순서로 자격 증명을 찾는다.
+//
+//  1. 환경 변수 AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN
+//  2. AWS_WEB_IDENTITY_TOKEN_FILE과 AWS_ROLE_ARN으로 STS AssumeRoleWithWebIdentity (EKS의 IRSA)
+//  3. 공유 자격 증명 파일(AWS_SHARED_CREDENTIALS_FILE, 기본값 ~/.aws/credentials)의 AWS_PROFILE 프로필(기본값 default)
+//  4. ECS 컨테이너 자격 증명(AWS_CONTAINER_CREDENTIALS_RELATIVE_URI 또는 AWS_CONTAINER_CREDENTIALS_FULL_URI)
+//  5. EC2 인스턴스 메타데이터(IMDSv2)의 IAM 역할. AWS_EC2_METADATA_DISABLED=true이면 건너뛴다
+//
+// 찾은 자격 증명은 만료되기 5분 전까지 저장해두고, 만료되면 체인을 처음부터 다시 찾는다.
+// client는 STS와 메타데이터 요청에 쓴다. nil이면 http.DefaultClient를 쓴다.
+func DefaultCredentials(region string, client *http.Client) CredentialsProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &credentialsChain{region: region, client: client}
+}
+
+type credentialsChain struct {
+	region string
+	client *http.Client
+
+	mu     sync.Mutex
+	cached Credentials
+}
+
+func (c *credentialsChain) Retrieve(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached.AccessKeyID != "" && (c.cached.Expires.IsZero() || time.Until(c.cached.Expires) > credentialsRefreshWindow) {
+		return c.cached, nil
+	}
+	sources := []func(context.Context) (Credentials, bool, error){
+		envCredentials,
+		c.webIdentityCredentials,
+		sharedCredentials,
+		c.containerCredentials,
+		c.imdsCredentials,
+	}
+	for _, source := range sources {
+		creds, ok, err := source(ctx)
+		if err != nil {
+			return Credentials{}, err
+		}
+		if ok {
+			c.cached = creds
+			return creds, nil
+		}
+	}
+	return Credentials{}, ErrNoCredentials
+}
+
+// 각 출처는 설정되지 않았으면 false를 리턴하고, 설정되었는데 자격 증명을 받지 못하면 에러를 리턴한다.
+
+func envCredentials(context.Context) (Credentials, bool, error) {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return Credentials{}, false, nil
+	}
+	return Credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, true, nil
+}
+
+func sharedCredentials(context.Context) (Credentials, bool, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, false, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Credentials{}, false, nil
+	}
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	defer f.Close()
+
+	var creds Credentials
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		name, value, _ := strings.Cut(line, "=")
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, false, err
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, false, nil
+	}
+	return creds, true, nil
+}
+
+func (c *credentialsChain) webIdentityCredentials(ctx context.Context) (Credentials, bool, error) {
+	tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || role == "" {
+		return Credentials{}, false, nil
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("web identity token: %w", err)
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("proglog-%d", time.Now().Unix())
+	}
+	q := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := "https://sts.amazonaws.com/"
+	if c.region != "" {
+		endpoint = "https://sts." + c.region + ".amazonaws.com/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(q.Encode()))
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("assume role with web identity: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Credentials{}, false, fmt.Errorf("assume role with web identity: %w", responseError(res))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&out); err != nil {
+		return Credentials{}, false, fmt.Errorf("assume role with web identity: %w", err)
+	}
+	r := out.Credentials
+	return Credentials{AccessKeyID: r.AccessKeyID, SecretAccessKey: r.SecretAccessKey, SessionToken: r.SessionToken, Expires: r.Expiration}, true, nil
+}
+
+func (c *credentialsChain) containerCredentials(ctx context.Context) (Credentials, bool, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		endpoint = containerCredentialsHost + rel
+	}
+	if endpoint == "" {
+		return Credentials{}, false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return Credentials{}, false, fmt.Errorf("container credentials: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	creds, err := c.fetchJSONCredentials(req)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("container credentials: %w", err)
+	}
+	return creds, true, nil
+}
+
+// imdsCredentials는 IMDSv2 토큰을 받아서 인스턴스에 붙은 IAM 역할의 자격 증명을 받는다.
+// EC2가 아니면 메타데이터 주소에 연결되지 않으므로 1초 안에 포기하고 자격 증명이 없는 것으로 본다.
+func (c *credentialsChain) imdsCredentials(ctx context.Context) (Credentials, bool, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return Credentials{}, false, nil
+	}
+	endpoint := imdsEndpoint
+	if e := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/")
+	}
+	probe, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probe, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return Credentials{}, false, nil
+	}
+	tokenBytes, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusOK {
+		return Credentials{}, false, nil
+	}
+	token := string(tokenBytes)
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return req, err
+	}
+	const rolesPath = "/latest/meta-data/iam/security-credentials/"
+	req, err = get(rolesPath)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	res, err = c.client.Do(req)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("instance metadata: %w", err)
+	}
+	roles, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("instance metadata: %w", err)
+	}
+	// 인스턴스에 IAM 역할이 없으면 404다
+	if res.StatusCode == http.StatusNotFound {
+		return Credentials{}, false, nil
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if res.StatusCode != http.StatusOK || role == "" {
+		return Credentials{}, false, nil
+	}
+	if req, err = get(rolesPath + role); err != nil {
+		return Credentials{}, false, err
+	}
+	creds, err := c.fetchJSONCredentials(req)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("instance metadata: %w", err)
+	}
+	return creds, true, nil
+}
+
+// fetchJSONCredentials는 컨테이너와 EC2 메타데이터가 같은 형식으로 돌려주는 자격 증명을 읽는다.
+func (c *credentialsChain) fetchJSONCredentials(req *http.Request) (Credentials, error) {
+	res, err := c.client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Credentials{}, responseError(res)
+	}
+	var out struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return Credentials{}, err
+	}
+	if out.AccessKeyID == "" || out.SecretAccessKey == "" {
+		return Credentials{}, errors.New("response has no access key")
+	}
+	return Credentials{AccessKeyID: out.AccessKeyID, SecretAccessKey: out.SecretAccessKey, SessionToken: out.Token, Expires: out.Expiration}, nil
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mokpolar/proglog/internal/server"
+)
+
+var (
+	// ErrLogNotEmpty는 로컬 로그에 이미 레코드가 있어서 복원하지 않았을 때 리턴한다.
+	ErrLogNotEmpty = errors.New("log is not empty")
+	// ErrChecksumMismatch는 받은 백업 오브젝트의 크기나 SHA-256이 매니페스트와 다를 때 리턴한다.
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+)
+
+// Raft 노드가 시작할 때 리더 선출과 Raft 로그의 재적용을 기다리는 최대 시간
+const restoreWaitTimeout = time.Minute
+
+// ParseLocation은 s3://bucket/prefix 형식의 백업 위치를 버킷과 접두사로 나눈다.
+func ParseLocation(location string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("backup location %q must start with s3://", location)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("backup location %q has no bucket", location)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// Restore는 log가 비어있으면 store의 prefix 아래에 있는 백업을 모두 받아서 같은 오프셋으로 log를 다시 만들고 매니페스트를 리턴한다.
+// 이미 있는 레코드를 덮어쓰지 않도록 log에 레코드가 하나라도 있으면 아무것도 하지 않고 ErrLogNotEmpty를 리턴하고,
+// 백업이 없으면 ErrNotFound를 리턴한다.
+//
+// 오브젝트를 모두 임시 파일에 받으면서 매니페스트의 크기와 SHA-256을 확인하고, 하나라도 다르면 log를 건드리지 않고
+// ErrChecksumMismatch를 리턴한다. 확인한 오브젝트는 매니페스트의 범위를 헤더로 붙인 스냅숏으로 이어서 log.Restore에 넘기므로
+// 오브젝트 사이에 빈 오프셋이 있으면 컴팩션으로 지워진 것으로 읽힌다.
+//
+// Raft 노드라면 리더 선출과 Raft 로그의 재적용이 끝난 뒤에 비어있는지 확인하고, 리더만 Raft를 통해 복원한다.
+// 팔로워는 리더에게 복원한 상태를 받으므로 server.ErrNotLeader를 리턴한다.
+func Restore(ctx context.Context, log server.CommitLog, store ObjectStore, prefix string) (Manifest, error) {
+	var m Manifest
+	sn, ok := log.(interface{ Restore(io.Reader) error })
+	if !ok {
+		return m, errors.ErrUnsupported
+	}
+	if err := waitReady(ctx, log); err != nil {
+		return m, err
+	}
+	if !isEmpty(log) {
+		return m, ErrLogNotEmpty
+	}
+	if l, ok := log.(interface{ IsLeader() bool }); ok && !l.IsLeader() {
+		return m, server.ErrNotLeader
+	}
+
+	b := New(log, store, prefix)
+	m, err := b.Manifest(ctx)
+	if err != nil {
+		return m, err
+	}
+	if len(m.Objects) == 0 {
+		return m, fmt.Errorf("%s: %w", b.key(manifestName), ErrNotFound)
+	}
+
+	readers := make([]io.Reader, 0, len(m.Objects)+1)
+	header, err := json.Marshal(struct {
+		Lowest uint64 `json:"lowest"`
+		Next   uint64 `json:"next"`
+	}{m.Objects[0].First, m.Next})
+	if err != nil {
+		return m, err
+	}
+	readers = append(readers, bytes.NewReader(append(header, '\n')))
+	for _, obj := range m.Objects {
+		f, err := download(ctx, store, obj)
+		if f != nil {
+			defer os.Remove(f.Name())
+			defer f.Close()
+		}
+		if err != nil {
+			return m, err
+		}
+		readers = append(readers, f)
+	}
+	if err := sn.Restore(io.MultiReader(readers...)); err != nil {
+		return m, fmt.Errorf("restore: %w", err)
+	}
+	return m, nil
+}
+
+// download는 obj를 임시 파일에 받고 크기와 SHA-256을 확인한 뒤 처음으로 되감은 파일을 리턴한다.
+// 파일을 만든 뒤에 실패하면 에러와 함께 파일도 리턴하므로 호출자가 지운다.
+func download(ctx context.Context, store ObjectStore, obj Object) (*os.File, error) {
+	body, err := store.Get(ctx, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	f, err := os.CreateTemp("", "proglog-restore-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), body)
+	if err != nil {
+		return f, fmt.Errorf("download %s: %w", obj.Key, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); size != obj.Size || sum != obj.SHA256 {
+		return f, fmt.Errorf("%w: %s is %d bytes with sha256 %s, manifest has %d bytes with sha256 %s",
+			ErrChecksumMismatch, obj.Key, size, sum, obj.Size, obj.SHA256)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return f, err
+}
+
+// boundsReporter는 Log와 DistributedLog처럼 오프셋 범위와 레코드 수를 한 번에 알려주는 백엔드다.
+type boundsReporter interface {
+	Bounds() (lowest, highest, count uint64)
+}
+
+// isEmpty는 log에 레코드가 하나도 없는지 확인한다. 마지막 레코드가 컴팩션으로 지워졌어도 다른 레코드가 있으면 비어있지 않다.
+func isEmpty(log server.CommitLog) bool {
+	if b, ok := log.(boundsReporter); ok {
+		_, _, count := b.Bounds()
+		return count == 0
+	}
+	_, err := log.Read(log.HighestOffset())
+	return errors.Is(err, server.ErrOffsetNotFound)
+}
+
+// waitReady는 Raft 노드가 리더를 찾고 시작할 때의 Raft 로그를 다시 적용할 때까지 기다린다.
+// 그 전에는 로컬 로그가 비어 보여도 곧 레코드가 채워질 수 있다.
+func waitReady(ctx context.Context, log server.CommitLog) error {
+	if l, ok := log.(interface{ WaitForLeader(time.Duration) error }); ok {
+		if err := l.WaitForLeader(restoreWaitTimeout); err != nil {
+			return err
+		}
+	}
+	r, ok := log.(interface{ Ready() bool })
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, restoreWaitTimeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !r.Ready() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for log replay: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Config는 백업을 올릴 S3 버킷과 요청에 서명할 자격 증명을 정한다.
+type S3Config struct {
+	Bucket string
+	// Region이 비어있으면 AWS_REGION, AWS_DEFAULT_REGION 환경 변수를 쓰고, 그것도 없으면 us-east-1이다.
+	Region string
+	// Endpoint는 MinIO처럼 S3 호환 저장소의 주소다. 있으면 {Endpoint}/{Bucket}/{key} 경로 방식으로 요청하고,
+	// 없으면 https://{Bucket}.s3.{Region}.amazonaws.com/{key}로 요청한다.
+	Endpoint string
+	// Credentials가 nil이면 DefaultCredentials의 기본 자격 증명 체인을 쓴다.
+	Credentials CredentialsProvider
+	// Client는 S3 요청에 쓴다. 없으면 http.DefaultClient를 쓴다.
+	Client *http.Client
+}
+
+// S3는 SigV4로 서명한 PutObject, GetObject 요청으로 오브젝트를 읽고 쓰는 ObjectStore다.
+// 오브젝트 하나를 한 번의 PUT으로 올리므로 S3의 한계인 5GiB보다 큰 백업은 올릴 수 없다.
+// 백업 주기를 짧게 해서 한 번에 올리는 레코드를 줄인다.
+type S3 struct {
+	bucket   string
+	region   string
+	endpoint *url.URL
+	creds    CredentialsProvider
+	client   *http.Client
+}
+
+var _ ObjectStore = (*S3)(nil)
+
+// NewS3는 cfg의 버킷에 읽고 쓰는 S3를 만든다. 자격 증명은 처음 요청할 때 찾는다.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	s := &S3{bucket: cfg.Bucket, region: cfg.Region, creds: cfg.Credentials, client: cfg.Client}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	if s.creds == nil {
+		s.creds = DefaultCredentials(s.region, s.client)
+	}
+	if cfg.Endpoint != "" {
+		u, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+		}
+		s.endpoint = u
+	}
+	return s, nil
+}
+
+// Put은 body를 key에 PutObject로 올린다. 바디를 한 번 읽어서 SHA-256을 서명에 넣으므로 S3가 받은 내용도 확인한다.
+func (s *S3) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	h := sha256.New()
+	size, err := io.Copy(h, body)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	res, err := s.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: put %s: %w", key, responseError(res))
+	}
+	return nil
+}
+
+// Get은 key의 오브젝트를 GetObject로 읽는다. 오브젝트가 없으면 ErrNotFound를 리턴한다.
+// 버킷의 ListBucket 권한이 없으면 S3는 없는 오브젝트에 404 대신 403을 응답하므로 그때는 에러가 된다.
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, emptyPayloadSHA)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, fmt.Errorf("s3: get %s: %w", key, ErrNotFound)
+	default:
+		defer res.Body.Close()
+		return nil, fmt.Errorf("s3: get %s: %w", key, responseError(res))
+	}
+}
+
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	creds, err := s.creds.Retrieve(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	signV4(req, creds, s.region, "s3", payloadHash, time.Now())
+	return s.client.Do(req)
+}
+
+// objectURL은 key의 주소를 만든다. 서명한 경로와 실제로 보내는 경로가 같도록 RawPath를 canonicalURI로 정한다.
+func (s *S3) objectURL(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	u := url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key}
+	if s.endpoint != nil {
+		u = *s.endpoint
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	}
+	u.RawPath = canonicalURI(&u)
+	return u.String()
+}
+
+// responseError는 S3와 STS의 XML 에러 응답에서 Code와 Message를 꺼낸다. XML이 아니면 상태 코드만 쓴다.
+func responseError(res *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+		Error   struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil {
+		if body.Code == "" {
+			body.Code, body.Message = body.Error.Code, body.Error.Message
+		}
+		if body.Code != "" {
+			return fmt.Errorf("%s: %s: %s", res.Status, body.Code, body.Message)
+		}
+	}
+	return errors.New(res.Status)
+}
@@ -0,0 +1,399 @@
+// Package config는 proglog 서버의 설정을 YAML 파일에서 읽는다.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config는 서버를 실행하는 데 필요한 설정이다. 시간 값은 "10s"처럼 time.ParseDuration 형식으로 적는다.
+type Config struct {
+	Addr          string        `yaml:"addr"`
+	GRPCAddr      string        `yaml:"grpcAddr"`
+	ReadTimeout   time.Duration `yaml:"readTimeout"`
+	WriteTimeout  time.Duration `yaml:"writeTimeout"`
+	ShutdownGrace time.Duration `yaml:"shutdownGrace"`
+
+	// ProduceTimeout과 ConsumeTimeout은 요청 하나의 최대 처리 시간이고, LongPollTimeout은 wait으로 기다리는 consume 요청의 최대 처리 시간이다.
+	// 넘으면 503을 반환하고, 0이면 제한하지 않는다. stream, export, bulk는 제한하지 않는다.
+	ProduceTimeout  time.Duration `yaml:"produceTimeout"`
+	ConsumeTimeout  time.Duration `yaml:"consumeTimeout"`
+	LongPollTimeout time.Duration `yaml:"longPollTimeout"`
+
+	// MaxRecordBytes는 레코드 값의 최대 바이트 수다. 0이면 제한하지 않는다.
+	MaxRecordBytes int `yaml:"maxRecordBytes"`
+
+	// MaxHeaderBytes는 요청 줄과 헤더의 최대 바이트 수다. 넘으면 431을 반환하고, 0이면 net/http 기본값(1MiB)이다.
+	// MaxBodyBytes는 모든 요청 바디의 최대 바이트 수다. 넘으면 413을 반환하고, 0이면 제한하지 않는다.
+	MaxHeaderBytes int   `yaml:"maxHeaderBytes"`
+	MaxBodyBytes   int64 `yaml:"maxBodyBytes"`
+
+	// Retention이 0보다 크면 그보다 오래된 세그먼트를 RetentionInterval마다 삭제한다.
+	Retention         time.Duration `yaml:"retention"`
+	RetentionInterval time.Duration `yaml:"retentionInterval"`
+
+	// ExpirySweepInterval마다 expireAt이 지난 레코드의 값을 지운다. 0이면 스윕하지 않지만 만료된 레코드는 여전히 읽을 수 없다.
+	ExpirySweepInterval time.Duration `yaml:"expirySweepInterval"`
+
+	// MaxInFlightAppends는 동시에 처리할 쓰기 요청 수다. 넘으면 503을 반환하고, 음수이면 제한하지 않는다.
+	MaxInFlightAppends int `yaml:"maxInFlightAppends"`
+
+	// AppendWorkers가 0보다 크면 produce 요청의 레코드를 그만큼의 워커 고루틴이 추가한다. 0이면 요청마다 바로 추가한다.
+	AppendWorkers int `yaml:"appendWorkers"`
+
+	// MaxConsumeOffsets는 POST /consume-multi 요청 하나에 넣을 수 있는 오프셋 수다. 음수이면 제한하지 않는다.
+	MaxConsumeOffsets int `yaml:"maxConsumeOffsets"`
+
+	// DataDir가 있으면 레코드를 그 디렉터리의 세그먼트 파일에 저장하고, 재시작하면 다시 연다. 비어있으면 메모리에만 둔다.
+	DataDir string `yaml:"dataDir"`
+
+	// Fsync는 "always", "never" 또는 "1s"처럼 백그라운드 fsync 간격이다. 파일 Log에만 의미가 있으므로 DataDir가 있어야 하고,
+	// 비어있으면 1초마다 fsync 한다.
+	Fsync string `yaml:"fsync"`
+
+	// StoreCompression은 새로 만드는 세그먼트가 레코드를 압축할 방식으로, "none", "gzip", "snappy" 중 하나다. 비어있으면 압축하지 않는다.
+	// 응답을 압축하는 GzipMinBytes와는 다르다.
+	StoreCompression string `yaml:"storeCompression"`
+
+	// EncryptionKeyFile이 있으면 그 파일에 16진수로 적힌 16, 24, 32바이트 키로 DataDir의 새 세그먼트를 AES-GCM 암호화한다.
+	// 암호화한 세그먼트는 같은 키로만 열 수 있다.
+	EncryptionKeyFile string `yaml:"encryptionKeyFile"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	// Raft.NodeID가 있으면 Raft 클러스터의 노드로 실행해서 레코드를 복제한다.
+	Raft RaftConfig `yaml:"raft"`
+
+	// Serf.Addr가 있으면 Serf로 노드를 찾아서 Raft 클러스터에 자동으로 추가하고 제거한다.
+	Serf SerfConfig `yaml:"serf"`
+
+	ACLFile      string `yaml:"aclFile"`
+	Pprof        bool   `yaml:"pprof"`
+	GzipMinBytes int    `yaml:"gzipMinBytes"`
+
+	// CORSOrigins에 있는 Origin의 브라우저가 API를 직접 호출할 수 있다. "*"는 모든 Origin이다. 비어있으면 같은 Origin만 허용한다.
+	CORSOrigins []string `yaml:"corsOrigins"`
+
+	// H2C가 true이면 평문 리스너에서 HTTP/1.1과 함께 TLS 없는 HTTP/2(prior knowledge)를 받는다.
+	H2C bool `yaml:"h2c"`
+
+	// Webhooks가 true이면 POST /subscriptions로 등록한 URL에 새 레코드를 보낸다.
+	Webhooks bool `yaml:"webhooks"`
+	// DeadLetterAttempts가 0보다 크면 웹훅이 이만큼 연속으로 보내지 못한 레코드를 데드레터 로그에 남기고 넘어간다. Webhooks가 없으면 쓰지 않는다.
+	DeadLetterAttempts int `yaml:"deadLetterAttempts"`
+
+	// Snapshot이 true이면 POST /snapshot과 POST /restore로 로그를 백업하고 복원할 수 있다.
+	Snapshot bool `yaml:"snapshot"`
+
+	// TopicDeletion이 true이면 DELETE /topics/{topic}으로 토픽과 그 레코드를 삭제할 수 있다.
+	TopicDeletion bool `yaml:"topicDeletion"`
+
+	// PathPrefix가 있으면 모든 엔드포인트를 그 아래에 등록한다. HealthOutsidePrefix가 true이면
+	// /healthz, /readyz, /version, /metrics는 접두사 없이 둔다.
+	PathPrefix          string `yaml:"pathPrefix"`
+	HealthOutsidePrefix bool   `yaml:"healthOutsidePrefix"`
+
+	// JWT.KeyFile이나 JWT.JWKSURL이 있으면 mTLS 인증서가 없는 클라이언트에게 Bearer 토큰을 요구한다.
+	JWT JWTConfig `yaml:"jwt"`
+
+	// BasicAuthFile이 있으면 mTLS 인증서가 없는 클라이언트에게 그 htpasswd 파일의 사용자로 Basic 인증을 요구한다.
+	// 서버에 SIGHUP을 보내면 파일을 다시 읽는다.
+	BasicAuthFile string `yaml:"basicAuthFile"`
+
+	// AuditFile이 있으면 produce, consume 요청의 감사 로그를 그 파일에 JSON 줄로 덧붙인다. "-"이면 표준 출력에 쓴다.
+	AuditFile string `yaml:"auditFile"`
+
+	// Backup.Bucket이 있으면 POST /backup으로 로그를 S3에 증분 백업하고, Backup.Interval마다 자동으로 백업한다.
+	Backup BackupConfig `yaml:"backup"`
+
+	// RestoreFrom이 s3://bucket/prefix이면 시작할 때 로그가 비어있는 경우에만 그 백업으로 로그를 복원한다.
+	// 리전과 엔드포인트는 Backup의 설정을 쓴다.
+	RestoreFrom string `yaml:"restoreFrom"`
+}
+
+// TLSConfig는 인증서 파일 경로다. CertFile과 KeyFile이 비어있으면 평문으로 서비스한다.
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// RaftConfig는 클러스터 노드 설정이다. NodeID가 비어있으면 혼자 실행하는 서버가 된다.
+// Addr와 AdvertiseAddr는 다른 노드와 클라이언트가 접속할 수 있는 host:port여야 한다.
+type RaftConfig struct {
+	NodeID string `yaml:"nodeID"`
+	// Addr는 노드끼리 Raft 메시지를 주고받는 주소다.
+	Addr string `yaml:"addr"`
+	// AdvertiseAddr는 팔로워가 쓰기 요청을 이 노드로 전달하거나 리다이렉트할 때 쓰는 HTTP 주소다.
+	AdvertiseAddr string `yaml:"advertiseAddr"`
+	// Redirect가 true이면 팔로워가 쓰기 요청을 리더에게 전달하지 않고 307로 리다이렉트한다.
+	Redirect bool `yaml:"redirect"`
+	// DataDir가 비어있으면 Raft 상태를 메모리에만 둔다.
+	DataDir   string `yaml:"dataDir"`
+	Bootstrap bool   `yaml:"bootstrap"`
+}
+
+// JWTConfig는 Bearer 토큰의 서명을 확인할 키와 확인할 클레임이다. KeyFile과 JWKSURL 중 하나만 준다.
+type JWTConfig struct {
+	// KeyFile은 PEM 공개 키나 HMAC 비밀 키 파일이다.
+	KeyFile string `yaml:"keyFile"`
+	// JWKSURL은 공개 키 목록을 받아올 주소다.
+	JWKSURL  string `yaml:"jwksURL"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+}
+
+// BackupConfig는 로그를 백업할 S3 버킷이다. 자격 증명은 AWS SDK와 같은 기본 체인(환경 변수, ~/.aws/credentials, IAM 역할)에서 찾는다.
+type BackupConfig struct {
+	Bucket string `yaml:"bucket"`
+	// Prefix는 버킷 안에서 백업 오브젝트와 매니페스트를 둘 경로다. 로그마다 다른 접두사를 쓴다.
+	Prefix string `yaml:"prefix"`
+	// Region이 비어있으면 AWS_REGION 환경 변수를 쓴다.
+	Region string `yaml:"region"`
+	// Endpoint는 MinIO처럼 S3 호환 저장소의 주소다. 비어있으면 AWS S3다.
+	Endpoint string `yaml:"endpoint"`
+	// Interval이 0이면 POST /backup으로만 백업한다.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// SerfConfig는 노드를 찾는 가십 설정이다. Raft.NodeID가 Serf 노드 이름으로 쓰인다.
+type SerfConfig struct {
+	// Addr는 노드끼리 가십 메시지를 주고받는 host:port다.
+	Addr string `yaml:"addr"`
+	// Join은 시작할 때 접속할, 이미 클러스터에 있는 노드들의 Serf 주소다.
+	Join []string `yaml:"join"`
+}
+
+// Default는 설정 파일에서 생략한 필드에 쓰이는 기본 설정을 리턴한다.
+// WriteTimeout은 stream 응답이 끊기지 않도록 기본적으로 두지 않는다.
+func Default() Config {
+	return Config{
+		Addr:                ":8080",
+		GRPCAddr:            ":8400",
+		ReadTimeout:         10 * time.Second,
+		ShutdownGrace:       10 * time.Second,
+		ProduceTimeout:      10 * time.Second,
+		ConsumeTimeout:      10 * time.Second,
+		LongPollTimeout:     70 * time.Second,
+		MaxRecordBytes:      1 << 20,
+		MaxHeaderBytes:      64 << 10,
+		RetentionInterval:   time.Minute,
+		ExpirySweepInterval: time.Minute,
+		MaxInFlightAppends:  1024,
+		MaxConsumeOffsets:   1000,
+		GzipMinBytes:        1024,
+	}
+}
+
+// LoadConfig는 path의 YAML 파일을 기본 설정 위에 덮어써서 읽는다.
+// 오타를 잡기 위해 Config에 없는 키가 있으면 에러를 리턴한다.
+// 환경 변수나 플래그를 더 덮어쓸 때는 그 뒤에 Validate를 다시 호출한다.
+func LoadConfig(path string) (Config, error) {
+	c := Default()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	// 빈 파일은 기본 설정을 그대로 사용한다
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate는 서로 맞지 않거나 범위를 벗어난 값이 있는지 확인한다.
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return errors.New("addr is required")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.ShutdownGrace < 0 ||
+		c.ProduceTimeout < 0 || c.ConsumeTimeout < 0 || c.LongPollTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if c.MaxRecordBytes < 0 {
+		return errors.New("maxRecordBytes must not be negative")
+	}
+	if c.AppendWorkers < 0 {
+		return errors.New("appendWorkers must not be negative")
+	}
+	if c.DeadLetterAttempts < 0 {
+		return errors.New("deadLetterAttempts must not be negative")
+	}
+	if c.MaxHeaderBytes < 0 || c.MaxBodyBytes < 0 {
+		return errors.New("maxHeaderBytes and maxBodyBytes must not be negative")
+	}
+	if c.Retention < 0 || c.RetentionInterval < 0 {
+		return errors.New("retention must not be negative")
+	}
+	if c.ExpirySweepInterval < 0 {
+		return errors.New("expirySweepInterval must not be negative")
+	}
+	if c.GzipMinBytes < 0 {
+		return errors.New("gzipMinBytes must not be negative")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls.certFile and tls.keyFile must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return errors.New("tls.clientCAFile requires tls.certFile")
+	}
+	if c.Raft.NodeID != "" && c.Raft.Addr == "" {
+		return errors.New("raft.addr is required with raft.nodeID")
+	}
+	// Raft 노드는 시작할 때 Raft 로그와 스냅숏으로 로컬 Log를 다시 만들므로 로컬 Log를 파일에 두면 레코드가 두 번 들어간다
+	if c.Raft.NodeID != "" && c.DataDir != "" {
+		return errors.New("dataDir cannot be used with raft.nodeID; use raft.dataDir")
+	}
+	if c.Fsync != "" && c.DataDir == "" {
+		return errors.New("fsync requires dataDir")
+	}
+	if c.EncryptionKeyFile != "" && c.DataDir == "" {
+		return errors.New("encryptionKeyFile requires dataDir")
+	}
+	if c.Raft.NodeID == "" && c.Raft.Bootstrap {
+		return errors.New("raft.bootstrap requires raft.nodeID")
+	}
+	if c.Raft.NodeID == "" && (c.Serf.Addr != "" || len(c.Serf.Join) > 0) {
+		return errors.New("serf requires raft.nodeID")
+	}
+	if c.Serf.Addr == "" && len(c.Serf.Join) > 0 {
+		return errors.New("serf.join requires serf.addr")
+	}
+	if c.JWT.KeyFile != "" && c.JWT.JWKSURL != "" {
+		return errors.New("jwt.keyFile and jwt.jwksURL cannot be used together")
+	}
+	if c.JWT.KeyFile == "" && c.JWT.JWKSURL == "" && (c.JWT.Issuer != "" || c.JWT.Audience != "") {
+		return errors.New("jwt.issuer and jwt.audience require jwt.keyFile or jwt.jwksURL")
+	}
+	if strings.ContainsAny(c.PathPrefix, "{}?#") {
+		return errors.New("pathPrefix must be a plain path")
+	}
+	if c.Backup.Bucket == "" && (c.Backup.Prefix != "" || c.Backup.Interval != 0) {
+		return errors.New("backup requires backup.bucket")
+	}
+	if c.Backup.Bucket == "" && c.RestoreFrom == "" && c.Backup.Endpoint != "" {
+		return errors.New("backup.endpoint requires backup.bucket or restoreFrom")
+	}
+	if c.RestoreFrom != "" && !strings.HasPrefix(c.RestoreFrom, "s3://") {
+		return errors.New("restoreFrom must be an s3://bucket/prefix location")
+	}
+	if c.Backup.Interval < 0 {
+		return errors.New("backup.interval must not be negative")
+	}
+	return nil
+}
+
+// RegisterFlags는 fs에 c의 필드를 바꾸는 플래그를 등록한다. 플래그의 기본값은 c의 현재 값이다.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "HTTP listen address")
+	fs.StringVar(&c.GRPCAddr, "grpc-addr", c.GRPCAddr, "gRPC listen address")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "HTTP read timeout (0 disables)")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "HTTP write timeout (0 disables; also cuts off streams)")
+	fs.DurationVar(&c.ShutdownGrace, "grace", c.ShutdownGrace, "graceful shutdown period")
+	fs.DurationVar(&c.ProduceTimeout, "produce-timeout", c.ProduceTimeout, "maximum produce request duration (0 disables)")
+	fs.DurationVar(&c.ConsumeTimeout, "consume-timeout", c.ConsumeTimeout, "maximum consume request duration (0 disables)")
+	fs.DurationVar(&c.LongPollTimeout, "long-poll-timeout", c.LongPollTimeout, "maximum duration of consume requests with wait (0 disables)")
+	fs.IntVar(&c.MaxRecordBytes, "max-record-bytes", c.MaxRecordBytes, "maximum record value size (0 disables)")
+	fs.IntVar(&c.MaxHeaderBytes, "max-header-bytes", c.MaxHeaderBytes, "maximum request header size (0 uses the net/http default)")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "maximum request body size (0 disables)")
+	fs.DurationVar(&c.Retention, "retention", c.Retention, "delete segments older than this (0 disables)")
+	fs.DurationVar(&c.RetentionInterval, "retention-interval", c.RetentionInterval, "how often to check retention")
+	fs.DurationVar(&c.ExpirySweepInterval, "expiry-sweep-interval", c.ExpirySweepInterval, "how often to drop the values of expired records (0 disables)")
+	fs.IntVar(&c.MaxInFlightAppends, "max-inflight-appends", c.MaxInFlightAppends, "maximum concurrent write requests before returning 503 (negative disables)")
+	fs.IntVar(&c.AppendWorkers, "append-workers", c.AppendWorkers, "number of goroutines that append produced records (0 appends on the request goroutine)")
+	fs.IntVar(&c.MaxConsumeOffsets, "max-consume-offsets", c.MaxConsumeOffsets, "maximum offsets in one POST /consume-multi request (negative disables)")
+	fs.StringVar(&c.DataDir, "data-dir", c.DataDir, "directory for the log segment files (in memory if empty)")
+	fs.StringVar(&c.Fsync, "fsync", c.Fsync, "fsync policy of the -data-dir log: always, never, or a background sync interval (1s if empty)")
+	fs.StringVar(&c.StoreCompression, "store-compression", c.StoreCompression, "compress records in new segments: none, gzip or snappy")
+	fs.StringVar(&c.EncryptionKeyFile, "encryption-key-file", c.EncryptionKeyFile, "file with a hex-encoded 16, 24 or 32 byte AES key for encrypting -data-dir segments")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "TLS certificate file (plaintext if empty)")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "TLS key file")
+	fs.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", c.TLS.ClientCAFile, "CA file for verifying client certificates (mTLS)")
+	fs.StringVar(&c.Raft.NodeID, "raft-node-id", c.Raft.NodeID, "raft node ID (standalone server if empty)")
+	fs.StringVar(&c.Raft.Addr, "raft-addr", c.Raft.Addr, "raft host:port other nodes connect to")
+	fs.StringVar(&c.Raft.AdvertiseAddr, "raft-advertise-addr", c.Raft.AdvertiseAddr, "HTTP host:port followers forward writes to")
+	fs.BoolVar(&c.Raft.Redirect, "raft-redirect", c.Raft.Redirect, "redirect writes on followers to the leader with 307 instead of forwarding them")
+	fs.StringVar(&c.Raft.DataDir, "raft-data-dir", c.Raft.DataDir, "raft log and snapshot directory (in memory if empty)")
+	fs.BoolVar(&c.Raft.Bootstrap, "raft-bootstrap", c.Raft.Bootstrap, "bootstrap a new cluster with this node")
+	fs.StringVar(&c.Serf.Addr, "serf-addr", c.Serf.Addr, "serf host:port for discovering cluster nodes (disabled if empty)")
+	fs.Var((*listFlag)(&c.Serf.Join), "serf-join", "comma-separated serf addresses of existing nodes to join")
+	fs.StringVar(&c.ACLFile, "acl", c.ACLFile, "ACL policy file (authorization disabled if empty)")
+	fs.BoolVar(&c.Pprof, "pprof", c.Pprof, "serve net/http/pprof at /debug/pprof/ (never enable on a public listener without -acl)")
+	fs.IntVar(&c.GzipMinBytes, "gzip-min-bytes", c.GzipMinBytes, "gzip responses of at least this many bytes (0 disables compression)")
+	fs.Var((*listFlag)(&c.CORSOrigins), "cors-origins", "comma-separated origins allowed to call the API from a browser (* for any, same-origin only if empty)")
+	fs.BoolVar(&c.H2C, "h2c", c.H2C, "accept HTTP/2 without TLS (prior knowledge) alongside HTTP/1.1 on a plaintext listener")
+	fs.BoolVar(&c.Webhooks, "webhooks", c.Webhooks, "serve /subscriptions and push new records to registered webhook URLs")
+	fs.IntVar(&c.DeadLetterAttempts, "dead-letter-attempts", c.DeadLetterAttempts, "move a -webhooks record to the dead letter log after this many failed attempts (0 retries forever)")
+	fs.BoolVar(&c.Snapshot, "snapshot", c.Snapshot, "serve POST /snapshot and POST /restore (restore replaces the whole log)")
+	fs.BoolVar(&c.TopicDeletion, "topic-deletion", c.TopicDeletion, "serve DELETE /topics/{topic} (deletes the topic and its records)")
+	fs.StringVar(&c.PathPrefix, "path-prefix", c.PathPrefix, "mount every route under this path, such as /api/proglog")
+	fs.BoolVar(&c.HealthOutsidePrefix, "health-outside-prefix", c.HealthOutsidePrefix, "serve /healthz, /readyz, /version and /metrics without the path prefix")
+	fs.StringVar(&c.JWT.KeyFile, "jwt-key-file", c.JWT.KeyFile, "PEM public key or HMAC secret file for verifying bearer tokens")
+	fs.StringVar(&c.JWT.JWKSURL, "jwt-jwks-url", c.JWT.JWKSURL, "JWKS URL for verifying bearer tokens")
+	fs.StringVar(&c.JWT.Issuer, "jwt-issuer", c.JWT.Issuer, "required iss claim of bearer tokens")
+	fs.StringVar(&c.JWT.Audience, "jwt-audience", c.JWT.Audience, "required aud claim of bearer tokens")
+	fs.StringVar(&c.BasicAuthFile, "basic-auth-file", c.BasicAuthFile, "htpasswd file for HTTP basic auth (reloaded on SIGHUP)")
+	fs.StringVar(&c.AuditFile, "audit-file", c.AuditFile, "append an audit log of produce and consume requests to this file (- for stdout, disabled if empty)")
+	fs.StringVar(&c.Backup.Bucket, "backup-bucket", c.Backup.Bucket, "S3 bucket for POST /backup and scheduled backups (disabled if empty)")
+	fs.StringVar(&c.Backup.Prefix, "backup-prefix", c.Backup.Prefix, "key prefix of backup objects in the bucket")
+	fs.StringVar(&c.Backup.Region, "backup-region", c.Backup.Region, "S3 region (AWS_REGION if empty)")
+	fs.StringVar(&c.Backup.Endpoint, "backup-endpoint", c.Backup.Endpoint, "S3-compatible endpoint URL such as http://minio:9000 (AWS S3 if empty)")
+	fs.DurationVar(&c.Backup.Interval, "backup-interval", c.Backup.Interval, "back up new records this often (0 backs up only on POST /backup)")
+	fs.StringVar(&c.RestoreFrom, "restore-from", c.RestoreFrom, "restore an empty log from this s3://bucket/prefix backup on startup")
+}
+
+// EnvPrefix는 설정을 바꾸는 환경 변수의 접두사다.
+const EnvPrefix = "PROGLOG_"
+
+// EnvName은 플래그 이름에 해당하는 환경 변수 이름을 리턴한다. 예를 들어 max-record-bytes는 PROGLOG_MAX_RECORD_BYTES다.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv는 RegisterFlags의 플래그마다 EnvName의 환경 변수가 있으면 그 값으로 c를 덮어쓴다.
+// lookup은 보통 os.LookupEnv이고, 값은 플래그와 같은 형식으로 적는다.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := lookup(EnvName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("%s=%q: %w", EnvName(f.Name), v, serr)
+		}
+	})
+	return err
+}
+
+// listFlag는 쉼표로 구분한 값들을 받는 플래그다. 빈 문자열은 빈 목록이다.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
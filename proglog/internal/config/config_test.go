@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	for flagName, want := range map[string]string{
+		"addr":             "PROGLOG_ADDR",
+		"max-record-bytes": "PROGLOG_MAX_RECORD_BYTES",
+		"raft-node-id":     "PROGLOG_RAFT_NODE_ID",
+	} {
+		if got := EnvName(flagName); got != want {
+			t.Errorf("EnvName(%q): got %q, want %q", flagName, got, want)
+		}
+	}
+}
+
+// 환경 변수는 설정 파일의 값을 덮어쓰고, 환경 변수가 없는 필드는 파일의 값을 그대로 둔다.
+func TestApplyEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "addr: :9000\ngrpcAddr: :9400\nmaxRecordBytes: 100\nraft:\n  nodeID: file-node\n  addr: 127.0.0.1:8500\n"
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvName("addr"), ":9001")
+	t.Setenv(EnvName("max-record-bytes"), "200")
+	t.Setenv(EnvName("read-timeout"), "3s")
+	t.Setenv(EnvName("webhooks"), "true")
+	t.Setenv(EnvName("serf-join"), "10.0.0.1:7946, 10.0.0.2:7946")
+	t.Setenv(EnvName("raft-node-id"), "env-node")
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":9001" {
+		t.Errorf("addr: got %q, want the env value", cfg.Addr)
+	}
+	if cfg.GRPCAddr != ":9400" {
+		t.Errorf("grpcAddr: got %q, want the file value", cfg.GRPCAddr)
+	}
+	if cfg.MaxRecordBytes != 200 {
+		t.Errorf("maxRecordBytes: got %d, want 200", cfg.MaxRecordBytes)
+	}
+	if cfg.ReadTimeout != 3*time.Second {
+		t.Errorf("readTimeout: got %v, want 3s", cfg.ReadTimeout)
+	}
+	if !cfg.Webhooks {
+		t.Error("webhooks: got false, want true")
+	}
+	if want := []string{"10.0.0.1:7946", "10.0.0.2:7946"}; !reflect.DeepEqual(cfg.Serf.Join, want) {
+		t.Errorf("serf.join: got %q, want %q", cfg.Serf.Join, want)
+	}
+	if cfg.Raft.NodeID != "env-node" || cfg.Raft.Addr != "127.0.0.1:8500" {
+		t.Errorf("raft: got %+v, want the env node ID and the file addr", cfg.Raft)
+	}
+	if cfg.ShutdownGrace != Default().ShutdownGrace {
+		t.Errorf("shutdownGrace: got %v, want the default", cfg.ShutdownGrace)
+	}
+}
+
+// 형식이 틀린 값은 어느 환경 변수인지 알려주는 에러를 리턴한다.
+func TestApplyEnvInvalidValue(t *testing.T) {
+	t.Setenv(EnvName("read-timeout"), "soon")
+	cfg := Default()
+	err := cfg.ApplyEnv(os.LookupEnv)
+	if err == nil {
+		t.Fatal("ApplyEnv accepted an invalid duration")
+	}
+	if !strings.Contains(err.Error(), EnvName("read-timeout")) {
+		t.Fatalf("error %q does not name %s", err, EnvName("read-timeout"))
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// appendPool은 produce 요청의 Append를 고정된 수의 워커 고루틴이 처리하게 한다.
+// 동시에 들어온 요청이 많아도 Log의 락을 잡으려고 다투는 고루틴은 워커 수만큼이므로,
+// HTTP 요청 고루틴 수와 상관없이 쓰기 처리량이 일정하다. 요청 고루틴은 작업을 넣고 오프셋이 나올 때까지 기다린다.
+type appendPool struct {
+	jobs    chan appendJob
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	waiting atomic.Int64
+	once    sync.Once
+}
+
+type appendJob struct {
+	ctx      context.Context
+	log      CommitLog
+	record   Record
+	expected *uint64 // nil이 아니면 AppendIf로 추가한다
+	result   chan appendResult
+}
+
+type appendResult struct {
+	offset uint64
+	err    error
+}
+
+// newAppendPool은 workers개의 워커를 시작한다. workers가 0 이하이면 워커 없이 요청 고루틴에서 바로 추가하는 nil을 리턴한다.
+func newAppendPool(workers int) *appendPool {
+	if workers <= 0 {
+		return nil
+	}
+	p := &appendPool{
+		jobs: make(chan appendJob),
+		stop: make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *appendPool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case job := <-p.jobs:
+			p.waiting.Add(-1)
+			var res appendResult
+			if job.expected != nil {
+				res.offset, res.err = appendIf(job.ctx, job.log, *job.expected, job.record)
+			} else {
+				res.offset, res.err = appendContext(job.ctx, job.log, job.record)
+			}
+			job.result <- res
+		}
+	}
+}
+
+// append는 레코드를 워커에게 넘기고 추가된 오프셋을 기다린다. 워커를 기다리는 동안 ctx가 끝나면 추가하지 않고 ctx.Err()를 리턴한다.
+// 워커가 이미 추가하기 시작했다면 끝날 때까지 기다려서 결과를 리턴하므로, 추가된 레코드의 오프셋을 잃지 않는다.
+func (p *appendPool) append(ctx context.Context, log CommitLog, expected *uint64, record Record) (uint64, error) {
+	if p == nil {
+		if expected != nil {
+			return appendIf(ctx, log, *expected, record)
+		}
+		return appendContext(ctx, log, record)
+	}
+	job := appendJob{ctx: ctx, log: log, record: record, expected: expected, result: make(chan appendResult, 1)}
+	p.waiting.Add(1)
+	select {
+	case p.jobs <- job:
+	case <-ctx.Done():
+		p.waiting.Add(-1)
+		return 0, ctx.Err()
+	case <-p.stop:
+		p.waiting.Add(-1)
+		return 0, ErrLogClosed
+	}
+	res := <-job.result
+	return res.offset, res.err
+}
+
+// depth는 워커를 기다리는 추가 요청 수다.
+func (p *appendPool) depth() int {
+	if p == nil {
+		return 0
+	}
+	return int(p.waiting.Load())
+}
+
+// Close는 워커를 멈추고 처리 중인 추가가 끝날 때까지 기다린다. 서버가 셧다운한 뒤, Log를 닫기 전에 호출한다.
+func (p *appendPool) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+	})
+	return nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthenticated는 인증이 필요한데 자격 증명이 없거나 맞지 않는 요청에 401과 함께 리턴한다.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// 감사 로그에서 인증에 실패한 요청의 작업 이름
+const authenticateAction = "authenticate"
+
+// TokenVerifier는 Authorization: Bearer로 받은 토큰을 확인하고 토큰의 요청자(subject)를 리턴한다.
+// auth.JWTVerifier가 기본 구현이다. 요청마다 호출되므로 여러 고루틴에서 동시에 호출해도 안전해야 한다.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (subject string, err error)
+}
+
+// PasswordVerifier는 HTTP Basic 인증으로 받은 사용자 이름과 비밀번호를 확인한다.
+// auth.Htpasswd와 auth.StaticCredentials가 구현한다. 여러 고루틴에서 동시에 호출해도 안전해야 한다.
+type PasswordVerifier interface {
+	VerifyPassword(username, password string) error
+}
+
+// 401 응답의 WWW-Authenticate에 쓰는 realm
+const authRealm = "proglog"
+
+// authenticate는 Authorization 헤더의 Bearer 토큰은 bearer로, Basic 자격 증명은 basic으로 확인해서
+// 토큰의 subject나 사용자 이름을 요청 컨텍스트에 담는다. 그래서 Authorizer는 mTLS 인증서의 CommonName과 같은 방식으로 확인한다.
+// 설정하지 않은 방식은 nil이다. 자격 증명이 없어도 검증된 클라이언트 인증서가 있으면 통과시키고,
+// 둘 다 없거나 자격 증명이 맞지 않으면 설정한 방식마다 WWW-Authenticate를 붙여서 401을 반환한다.
+// 쿠버네티스 프로브는 자격 증명을 보내지 않으므로 /healthz와 /readyz는 확인하지 않는다.
+func (s *httpServer) authenticate(bearer TokenVerifier, basic PasswordVerifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var subject string
+			var err error
+			if token, ok := bearerToken(r.Header.Get("Authorization")); ok && bearer != nil {
+				if subject, err = bearer.Verify(r.Context(), token); err != nil {
+					w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`", error="invalid_token"`)
+				}
+			} else if username, password, ok := r.BasicAuth(); ok && basic != nil {
+				if err = basic.VerifyPassword(username, password); err == nil {
+					subject = username
+				}
+			} else if _, ok := SubjectFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			} else {
+				err = errors.New("missing credentials")
+			}
+			if err != nil {
+				if bearer != nil && w.Header().Get("WWW-Authenticate") == "" {
+					w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+				}
+				if basic != nil {
+					w.Header().Add("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+				}
+				s.unauthenticated(w, r, fmt.Errorf("%w: %v", ErrUnauthenticated, err))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withSubject(r.Context(), subject)))
+		})
+	}
+}
+
+// unauthenticated는 401을 응답하고, 감사 로그를 쓴다면 거절한 요청을 authenticate 작업으로 남긴다.
+func (s *httpServer) unauthenticated(w http.ResponseWriter, r *http.Request, err error) {
+	s.audit(authenticateAction, func(w http.ResponseWriter, r *http.Request) {
+		s.httpError(w, err, http.StatusUnauthorized)
+	})(w, r)
+}
+
+// bearerToken은 Authorization 헤더에서 Bearer 토큰을 꺼낸다. 스킴 이름은 대소문자를 가리지 않는다.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// isProbe는 인증 없이 받아야 하는 헬스 체크 요청인지 확인한다. 접두사 아래에 둔 경우도 포함한다.
+func (s *httpServer) isProbe(r *http.Request) bool {
+	p := strings.TrimPrefix(r.URL.Path, s.pathPrefix)
+	return p == "/healthz" || p == "/readyz"
+}
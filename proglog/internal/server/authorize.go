@@ -0,0 +1,39 @@
+package server
+
+import "net/http"
+
+// Authorizer는 요청자(subject)가 대상(object)에 작업(action)을 할 수 있는지 확인한다.
+// 허용하지 않으면 에러를 리턴한다. auth.ACL이 기본 구현이고, 직접 구현해서 WithAuthorizer로 넘길 수도 있다.
+type Authorizer interface {
+	Authorize(subject, object, action string) error
+}
+
+const (
+	objectWildcard = "*"
+	produceAction  = "produce"
+	consumeAction  = "read"
+	truncateAction = "truncate"
+	debugAction    = "debug"
+	clusterAction  = "cluster"
+	snapshotAction = "snapshot"
+	backupAction   = "backup"
+	// 구독을 등록하면 서버가 그 URL로 요청을 보내므로 read와 따로 관리자에게만 준다
+	subscribeAction = "subscribe"
+)
+
+// authorize는 핸들러를 감싸서 요청 컨텍스트의 subject가 action을 할 수 있는지 먼저 확인한다.
+// 권한이 없으면 403 에러를 반환하고, Authorizer가 없으면 모든 요청을 허용한다.
+func (s *httpServer) authorize(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authorizer == nil {
+			next(w, r)
+			return
+		}
+		subject, _ := SubjectFromContext(r.Context())
+		if err := s.authorizer.Authorize(subject, objectWildcard, action); err != nil {
+			s.httpError(w, err, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// actionAuthorizer는 actions에 있는 작업만 허용한다.
+type actionAuthorizer map[string]bool
+
+func (a actionAuthorizer) Authorize(subject, object, action string) error {
+	if !a[action] {
+		return errors.New("not authorized: " + action)
+	}
+	return nil
+}
+
+// 구독을 만들고 지우면 서버가 임의의 URL로 요청을 보내므로 read 권한만으로는 할 수 없다.
+func TestSubscriptionsRequireSubscribe(t *testing.T) {
+	const body = `{"url":"http://127.0.0.1:1/hook"}`
+	h := newTestHandler(t, WithWebhooks(true), WithAuthorizer(actionAuthorizer{consumeAction: true, produceAction: true}))
+	if w := serve(h, http.MethodPost, "/subscriptions", body); w.Code != http.StatusForbidden {
+		t.Fatalf("subscribe with read and produce: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(h, http.MethodDelete, "/subscriptions/abc", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("unsubscribe with read and produce: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(h, http.MethodGet, "/subscriptions", ""); w.Code != http.StatusOK {
+		t.Fatalf("list subscriptions with read: got %d: %s", w.Code, w.Body)
+	}
+
+	h = newTestHandler(t, WithWebhooks(true), WithAuthorizer(actionAuthorizer{subscribeAction: true}))
+	if w := serve(h, http.MethodPost, "/subscriptions", body); w.Code != http.StatusCreated {
+		t.Fatalf("subscribe with subscribe: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodDelete, "/subscriptions/abc", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unsubscribe an unknown id with subscribe: got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrAppendQueueFull은 처리 중인 쓰기 요청이 appendQueue의 용량만큼 있어서 새 요청을 받지 않을 때 리턴한다.
+var ErrAppendQueueFull = errors.New("append queue is full")
+
+// 처리 중인 쓰기 요청 수의 기본 제한
+const defaultMaxInFlightAppends = 1024
+
+// appendQueue는 동시에 처리 중인 쓰기 요청 수를 제한하는 세마포어다.
+// 디스크가 느려서 Append가 밀리면 요청 바디와 고루틴이 계속 쌓이므로, 용량을 넘는 요청은 기다리게 하지 않고 바로 거절한다.
+type appendQueue struct {
+	slots chan struct{}
+}
+
+// newAppendQueue는 capacity가 0이면 기본 용량을, 음수이면 제한하지 않는 nil을 리턴한다.
+func newAppendQueue(capacity int) *appendQueue {
+	if capacity < 0 {
+		return nil
+	}
+	if capacity == 0 {
+		capacity = defaultMaxInFlightAppends
+	}
+	return &appendQueue{slots: make(chan struct{}, capacity)}
+}
+
+func (q *appendQueue) tryAcquire() bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *appendQueue) release() {
+	<-q.slots
+}
+
+// depth는 지금 처리 중인 쓰기 요청 수다.
+func (q *appendQueue) depth() int {
+	if q == nil {
+		return 0
+	}
+	return len(q.slots)
+}
+
+// limitAppends는 쓰기 핸들러를 감싸서 appendQueue에 자리가 없으면 Retry-After와 함께 503 에러를 반환한다.
+// 자리는 바디를 읽기 전에 잡고 응답을 다 쓴 뒤에 놓으므로 처리 중인 요청의 바디만큼만 메모리를 쓴다.
+func (s *httpServer) limitAppends(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := s.appendQueue
+		if q == nil {
+			next(w, r)
+			return
+		}
+		if !q.tryAcquire() {
+			w.Header().Set("Retry-After", "1")
+			s.httpError(w, ErrAppendQueueFull, http.StatusServiceUnavailable)
+			return
+		}
+		defer q.release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Backuper는 로그를 외부 저장소에 백업한다. backup.Backup이 기본 구현이다.
+// POST /backup과 주기적인 백업이 동시에 호출할 수 있으므로 여러 고루틴에서 호출해도 안전해야 한다.
+type Backuper interface {
+	Backup(ctx context.Context) (BackupResult, error)
+}
+
+// BackupResult는 백업 한 번의 결과다. 지난 백업 뒤에 추가된 레코드만 올리므로 FirstOffset은 지난 백업의 NextOffset이고,
+// 새 레코드가 없었으면 Object가 비어있다. NextOffset이 다음 백업이 시작할 오프셋이다.
+type BackupResult struct {
+	Object      string `json:"object,omitempty"`
+	FirstOffset uint64 `json:"firstOffset"`
+	NextOffset  uint64 `json:"nextOffset"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// ExportFrom은 log의 from부터 지금 마지막 레코드까지를 Log.Reader와 같은 NDJSON으로 읽는 io.Reader와
+// 그 다음 오프셋을 리턴한다. 범위를 먼저 고정하므로 읽는 동안 추가된 레코드는 포함하지 않고, 다음 ExportFrom(next)가 이어서 읽는다.
+// from이 next 이상이면 빈 Reader를 리턴하고, from이 이미 삭제되었으면 ErrOffsetOutOfRange를 리턴한다.
+func ExportFrom(log CommitLog, from uint64) (io.Reader, uint64, error) {
+	lowest, highest, count := bounds(log)
+	next := lowest
+	if count > 0 {
+		next = highest + 1
+	}
+	if from >= next {
+		return eofReader{}, next, nil
+	}
+	it, err := readFrom(log, from)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newRecordReader(&limitIterator{RecordIterator: it, end: next}), next, nil
+}
+
+// limitIterator는 end 이상인 오프셋의 레코드를 읽지 않는다.
+type limitIterator struct {
+	RecordIterator
+	end uint64
+}
+
+func (it *limitIterator) Next() (Record, bool) {
+	record, ok := it.RecordIterator.Next()
+	if !ok || record.Offset >= it.end {
+		return Record{}, false
+	}
+	return record, true
+}
+
+// eofReader는 바로 io.EOF를 리턴한다.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// backup 핸들러는 지난 백업 뒤에 추가된 레코드를 바로 백업하고 결과를 응답한다.
+// Raft 노드라면 주기적인 백업과 같은 prefix에 쓰지 않도록 리더에서만 실행한다(팔로워는 리더에게 전달한다).
+// 백업은 요청이 끝나도 멈추지 않도록 요청 컨텍스트의 취소를 따르지 않는다.
+func (s *httpServer) handleBackup(w http.ResponseWriter, r *http.Request) {
+	result, err := s.backuper.Backup(context.WithoutCancel(r.Context()))
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrOffsetOutOfRange):
+		s.httpError(w, err, http.StatusConflict)
+		return
+	default:
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// 한 줄로 읽을 수 있는 최대 바이트 수. maxRecordBytes가 더 크면 그에 맞게 늘린다.
+const defaultMaxBulkLineBytes = 1024 * 1024
+
+// BulkResponse는 bulk 업로드로 추가한 레코드 수와 첫 번째, 마지막 오프셋을 담는다.
+// 추가한 레코드가 없으면 FirstOffset과 LastOffset은 0이다.
+type BulkResponse struct {
+	Appended    uint64 `json:"appended"`
+	FirstOffset uint64 `json:"firstOffset"`
+	LastOffset  uint64 `json:"lastOffset"`
+}
+
+// bulk 핸들러는 한 줄에 Record 하나씩 JSON으로 적힌 NDJSON 바디를 읽어서 차례로 로그에 추가한다.
+// 바디 전체를 메모리에 올리지 않고 한 줄씩 읽어서 바로 추가하므로 큰 파일도 한 번에 올릴 수 있다.
+// 디코딩에 실패하면 몇 번째 줄인지 알려주는 400 에러를 반환하는데,
+// append-only 로그이므로 그 전까지 추가된 레코드는 그대로 남는다. 빈 줄은 건너뛴다.
+func (s *httpServer) handleBulk(w http.ResponseWriter, r *http.Request) {
+	maxLine := defaultMaxBulkLineBytes
+	if limit := int(s.maxProduceBodyBytes()); limit > maxLine {
+		maxLine = limit
+	}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	var res BulkResponse
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(b, &record); err != nil {
+			s.httpError(w, fmt.Errorf("line %d: %w", line, err), http.StatusBadRequest)
+			return
+		}
+		if err := s.checkRecordSize(record); err != nil {
+			s.httpError(w, fmt.Errorf("line %d: %w", line, err), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		off, err := appendContext(r.Context(), s.logFor(r), record)
+		if code, ok := contextErrorStatus(err); ok {
+			s.httpError(w, err, code)
+			return
+		}
+		if err == ErrReadOnly {
+			s.httpError(w, err, http.StatusMethodNotAllowed)
+			return
+		}
+		if err == ErrNotLeader && res.Appended == 0 {
+			s.notLeader(w, r)
+			return
+		}
+		if err != nil {
+			s.httpError(w, err, http.StatusInternalServerError)
+			return
+		}
+		s.metrics.recordsAppended.Inc()
+
+		if res.Appended == 0 {
+			res.FirstOffset = off
+		}
+		res.LastOffset = off
+		res.Appended++
+	}
+	if err := scanner.Err(); err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// ErrInvalidMember는 join이나 leave 요청에 노드 ID나 Raft 주소가 없을 때 리턴한다.
+var ErrInvalidMember = errors.New("member id and raft address are required")
+
+// clusterLog는 Raft 클러스터의 멤버십을 바꿀 수 있는 백엔드다. DistributedLog가 구현한다.
+type clusterLog interface {
+	IsLeader() bool
+	Leader() (id, httpAddr string)
+	Servers() ([]Server, error)
+	Join(id, raftAddr, httpAddr string) error
+	Leave(id string) error
+}
+
+var _ clusterLog = (*DistributedLog)(nil)
+
+type JoinRequest struct {
+	ID       string `json:"id"`
+	RaftAddr string `json:"raftAddr"`
+	HTTPAddr string `json:"httpAddr"`
+}
+
+type LeaveRequest struct {
+	ID string `json:"id"`
+}
+
+type ClusterResponse struct {
+	Servers []Server `json:"servers"`
+}
+
+// cluster 핸들러는 Raft 클러스터 구성에 있는 노드들과 리더를 응답한다.
+func (s *httpServer) handleCluster(w http.ResponseWriter, r *http.Request) {
+	c := s.Log.(clusterLog)
+	servers, err := c.Servers()
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(ClusterResponse{Servers: servers}); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// join 핸들러는 새 노드를 클러스터에 추가한다. 새 노드는 Bootstrap 없이 시작한 뒤
+// 리더에게 자기 ID와 Raft 주소, HTTP 주소를 보내면 리더의 로그를 복제받기 시작한다.
+// 팔로워가 받으면 쓰기 요청처럼 리더에게 전달하거나 리다이렉트한다.
+func (s *httpServer) handleJoin(w http.ResponseWriter, r *http.Request) {
+	var req JoinRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" || req.RaftAddr == "" {
+		s.httpError(w, ErrInvalidMember, http.StatusBadRequest)
+		return
+	}
+	s.changeMembership(w, r, s.Log.(clusterLog).Join(req.ID, req.RaftAddr, req.HTTPAddr))
+}
+
+// leave 핸들러는 노드를 클러스터에서 제거한다. 제거된 노드는 더 이상 레코드를 복제받지 않는다.
+func (s *httpServer) handleLeave(w http.ResponseWriter, r *http.Request) {
+	var req LeaveRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		s.httpError(w, ErrInvalidMember, http.StatusBadRequest)
+		return
+	}
+	s.changeMembership(w, r, s.Log.(clusterLog).Leave(req.ID))
+}
+
+func (s *httpServer) changeMembership(w http.ResponseWriter, r *http.Request, err error) {
+	if err == ErrNotLeader {
+		s.notLeader(w, r)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.handleCluster(w, r)
+}
+
+// notLeader는 핸들러가 ErrNotLeader를 받았을 때 응답한다. WithLeaderRedirect를 켰으면 리더의 같은 경로로
+// 307 리다이렉트하고, 307은 클라이언트가 메서드와 바디를 바꾸지 않고 다시 보내게 한다(curl은 -L).
+// 전달하는 모드에서는 forwardToLeader를 지난 뒤에 리더가 바뀐 것이고 바디를 이미 읽었으므로,
+// 리더가 아직 없거나 리더의 HTTP 주소를 모를 때처럼 잠시 뒤에 다시 시도하도록 Retry-After와 함께 503을 반환한다.
+func (s *httpServer) notLeader(w http.ResponseWriter, r *http.Request) {
+	var addr string
+	if c, ok := s.Log.(clusterLog); ok {
+		_, addr = c.Leader()
+	}
+	if addr == "" {
+		w.Header().Set("Retry-After", "1")
+		s.httpError(w, ErrNoLeader, http.StatusServiceUnavailable)
+		return
+	}
+	if !s.leaderRedirect {
+		w.Header().Set("Retry-After", "1")
+		s.httpError(w, ErrNotLeader, http.StatusServiceUnavailable)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: addr, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	w.Header().Set("Location", u.String())
+	s.httpError(w, ErrNotLeader, http.StatusTemporaryRedirect)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	api "github.com/mokpolar/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// protoDecodable은 protobuf 메시지로부터 채울 수 있는 요청 타입이다.
+type protoDecodable interface {
+	newProto() proto.Message
+	fromProto(proto.Message)
+}
+
+// protoEncodable은 protobuf 메시지로 바꿀 수 있는 응답 타입이다.
+type protoEncodable interface {
+	toProto() proto.Message
+}
+
+var (
+	// ErrEmptyBody는 요청 바디가 비어있을 때 리턴한다.
+	ErrEmptyBody = errors.New("request body is empty")
+	// ErrMalformedJSON은 요청 바디가 올바른 JSON이 아닐 때 디코딩에 실패한 위치와 함께 감싸서 리턴한다.
+	ErrMalformedJSON = errors.New("malformed JSON")
+)
+
+// decodeRequest는 Content-Type이 application/x-protobuf이면 바디를 protobuf로, 아니면 JSON으로 디코딩한다.
+// 바디가 비어있으면 ErrEmptyBody를 리턴한다.
+// 바디는 풀에서 꺼낸 버퍼에 한 번에 읽어서 디코딩하므로 JSON 바디에는 값이 하나만 있어야 한다.
+func decodeRequest(r *http.Request, v protoDecodable) error {
+	body := getBody()
+	defer putBody(body)
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		return err
+	}
+	b := body.Bytes()
+	if !hasMediaType(r.Header.Get("Content-Type"), contentTypeProtobuf) {
+		return unmarshalJSON(b, v)
+	}
+	if len(b) == 0 {
+		return ErrEmptyBody
+	}
+	m := v.newProto()
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	v.fromProto(m)
+	return nil
+}
+
+// unmarshalJSON은 decodeJSON과 같은 에러를 리턴하는 json.Unmarshal이다.
+func unmarshalJSON(b []byte, v any) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return ErrEmptyBody
+	}
+	return jsonError(json.Unmarshal(b, v))
+}
+
+// decodeJSON은 JSON 바디를 v로 디코딩한다. 바디가 비어있으면 ErrEmptyBody를 리턴하고,
+// 올바른 JSON이 아니면 바디의 몇 번째 바이트에서 실패했는지 알려주는 ErrMalformedJSON을 리턴한다.
+func decodeJSON(body io.Reader, v any) error {
+	err := json.NewDecoder(body).Decode(v)
+	if err == io.EOF {
+		return ErrEmptyBody
+	}
+	return jsonError(err)
+}
+
+// jsonError는 JSON 디코딩 에러를 실패한 위치를 담은 ErrMalformedJSON으로 감싼다.
+func jsonError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: unexpected end of body", ErrMalformedJSON)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w at offset %d: %w", ErrMalformedJSON, syntaxErr.Offset, err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%w at offset %d: %w", ErrMalformedJSON, typeErr.Offset, err)
+	}
+	return err
+}
+
+// ErrInvalidOffset은 offset 쿼리 파라미터가 0 이상의 정수가 아닐 때 감싸서 리턴한다.
+var ErrInvalidOffset = errors.New("invalid offset")
+
+// offsetParam은 offset 쿼리 파라미터를 읽는다. 파라미터가 없으면 ok가 false다.
+func offsetParam(r *http.Request) (offset uint64, ok bool, err error) {
+	v := r.URL.Query().Get("offset")
+	if v == "" {
+		return 0, false, nil
+	}
+	offset, err = strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w %q: must be a non-negative integer", ErrInvalidOffset, v)
+	}
+	return offset, true, nil
+}
+
+// encodeResponse는 Accept가 application/x-protobuf를 포함하면 protobuf로, 아니면 JSON으로 응답을 인코딩한다.
+// Accept 헤더가 없으면 기존처럼 JSON으로 응답한다. code는 응답의 상태 코드다.
+// 바디를 먼저 인코딩하므로 Content-Length를 알려주고, HEAD 요청이면 net/http가 바디를 버리고 헤더만 보낸다.
+func encodeResponse(w http.ResponseWriter, r *http.Request, code int, v protoEncodable) error {
+	if !hasMediaType(r.Header.Get("Accept"), contentTypeProtobuf) {
+		// 풀에서 꺼낸 버퍼에 먼저 인코딩하므로 인코딩에 실패해도 상태 코드를 쓰기 전이다
+		b := getJSONBuffer()
+		defer putJSONBuffer(b)
+		if err := b.enc.Encode(v); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.Header().Set("Content-Length", strconv.Itoa(b.buf.Len()))
+		w.WriteHeader(code)
+		_, err := w.Write(b.buf.Bytes())
+		return err
+	}
+	b, err := proto.Marshal(v.toProto())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentTypeProtobuf)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(code)
+	_, err = w.Write(b)
+	return err
+}
+
+// hasMediaType은 콤마로 구분된 헤더 값 중에 mediaType이 있는지 확인한다.
+func hasMediaType(header, mediaType string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (req *ProduceRequest) newProto() proto.Message { return &api.ProduceRequest{} }
+
+func (req *ProduceRequest) fromProto(m proto.Message) {
+	req.Record = recordFromProto(m.(*api.ProduceRequest).GetRecord())
+}
+
+func (res ProduceResponse) toProto() proto.Message {
+	return &api.ProduceResponse{Offset: res.Offset}
+}
+
+func (req *ConsumeRequest) newProto() proto.Message { return &api.ConsumeRequest{} }
+
+func (req *ConsumeRequest) fromProto(m proto.Message) {
+	req.Offset = m.(*api.ConsumeRequest).GetOffset()
+}
+
+func (res ConsumeResponse) toProto() proto.Message {
+	return &api.ConsumeResponse{Record: recordToProto(res.Record)}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// CommitLog는 서버가 레코드를 저장하고 읽는 로그 백엔드다.
+// Log가 기본 구현이고, 다른 저장소나 테스트용 목을 넘겨서 서버 코드를 고치지 않고 바꿔 쓸 수 있다.
+//
+// 백엔드가 아래 메서드를 추가로 구현하면 서버가 그 기능을 사용하고, 없으면 대신 동작하거나 501을 반환한다.
+//
+//	AppendContext(ctx, Record) (uint64, error)  요청 컨텍스트 취소를 반영한 추가
+//	ReadContext(ctx, uint64) (Record, error)    요청 컨텍스트 취소를 반영한 읽기
+//	AppendBatch([]Record) ([]uint64, error)     한 번에 여러 레코드 추가
+//	AppendIf(uint64, Record) (uint64, error)    다음 오프셋이 맞을 때만 추가 (없으면 501)
+//	Appended() <-chan struct{}                  새 레코드 알림 (없으면 주기적으로 다시 읽는다)
+//	Bounds() (lowest, highest, count uint64)    같은 시점의 오프셋 범위
+//	ReadFrom(uint64) (RecordIterator, error)    오프셋부터 순서대로 읽는 이터레이터
+//	ReadKey([]byte) (Record, error)             키로 가장 최근 레코드 읽기
+//	OffsetForTime(time.Time) (uint64, error)    시각 이후의 첫 레코드 오프셋 찾기
+//	Reset() error                               로그 비우기
+//	Ready() bool                                시작할 때 복구나 재적용이 끝났는지 (없으면 항상 준비됨)
+//	SizeBytes() uint64                          로그가 차지하는 바이트 수 (없으면 /stats에서 빠진다)
+type CommitLog interface {
+	Append(Record) (uint64, error)
+	Read(uint64) (Record, error)
+	LowestOffset() uint64
+	HighestOffset() uint64
+}
+
+var _ CommitLog = (*Log)(nil)
+
+type contextAppender interface {
+	AppendContext(context.Context, Record) (uint64, error)
+}
+
+type contextReader interface {
+	ReadContext(context.Context, uint64) (Record, error)
+}
+
+type batchAppender interface {
+	AppendBatch([]Record) ([]uint64, error)
+}
+
+type conditionalAppender interface {
+	AppendIf(expected uint64, record Record) (uint64, error)
+}
+
+type appendNotifier interface {
+	Appended() <-chan struct{}
+}
+
+type boundsReporter interface {
+	Bounds() (lowest, highest, count uint64)
+}
+
+type rangeReader interface {
+	ReadFrom(uint64) (RecordIterator, error)
+}
+
+type keyReader interface {
+	ReadKey([]byte) (Record, error)
+}
+
+type timeIndexer interface {
+	OffsetForTime(time.Time) (uint64, error)
+}
+
+type resetter interface {
+	Reset() error
+}
+
+// replicaAppender는 다른 노드가 정한 타임스탬프를 바꾸지 않고 레코드를 추가할 수 있는 백엔드다.
+type readinessReporter interface {
+	Ready() bool
+}
+
+type sizeReporter interface {
+	SizeBytes() uint64
+}
+
+type replicaAppender interface {
+	appendReplicated(Record) (uint64, error)
+}
+
+// Appended를 구현하지 않은 백엔드에서 새 레코드를 기다릴 때 다시 읽어보는 간격
+const appendPollInterval = 100 * time.Millisecond
+
+func appendContext(ctx context.Context, l CommitLog, record Record) (uint64, error) {
+	if a, ok := l.(contextAppender); ok {
+		return a.AppendContext(ctx, record)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return l.Append(record)
+}
+
+func readContext(ctx context.Context, l CommitLog, offset uint64) (Record, error) {
+	if r, ok := l.(contextReader); ok {
+		return r.ReadContext(ctx, offset)
+	}
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	return l.Read(offset)
+}
+
+// appendIf는 다음 오프셋이 expected일 때만 record를 추가한다. 확인과 추가 사이에 다른 레코드가 끼어들지 않아야 하므로
+// AppendIf가 없는 백엔드에서는 흉내 내지 않고 errors.ErrUnsupported를 리턴한다.
+func appendIf(ctx context.Context, l CommitLog, expected uint64, record Record) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if a, ok := l.(conditionalAppender); ok {
+		return a.AppendIf(expected, record)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// nextOffset은 다음에 추가될 레코드의 오프셋이다.
+func nextOffset(l CommitLog) uint64 {
+	lowest, highest, count := bounds(l)
+	if count == 0 {
+		return lowest
+	}
+	return highest + 1
+}
+
+// appendBatch는 AppendBatch가 없으면 레코드를 하나씩 추가한다.
+func appendBatch(l CommitLog, records []Record) ([]uint64, error) {
+	if b, ok := l.(batchAppender); ok {
+		return b.AppendBatch(records)
+	}
+	offsets := make([]uint64, 0, len(records))
+	for _, record := range records {
+		off, err := l.Append(record)
+		if err != nil {
+			return offsets, err
+		}
+		offsets = append(offsets, off)
+	}
+	return offsets, nil
+}
+
+// appended는 다음 레코드가 추가되면 닫히는 채널을 리턴한다.
+// Appended가 없으면 appendPollInterval 뒤에 신호가 오는 채널을 리턴해서 기다리는 쪽이 다시 읽게 한다.
+func appended(l CommitLog) <-chan struct{} {
+	if n, ok := l.(appendNotifier); ok {
+		return n.Appended()
+	}
+	ch := make(chan struct{})
+	time.AfterFunc(appendPollInterval, func() { close(ch) })
+	return ch
+}
+
+// bounds는 Bounds가 없으면 LowestOffset과 HighestOffset으로 범위를 구하고,
+// HighestOffset을 읽을 수 없으면 빈 로그로 본다.
+func bounds(l CommitLog) (lowest, highest, count uint64) {
+	if b, ok := l.(boundsReporter); ok {
+		return b.Bounds()
+	}
+	lowest, highest = l.LowestOffset(), l.HighestOffset()
+	if _, err := l.Read(highest); err != nil {
+		return lowest, lowest, 0
+	}
+	return lowest, highest, highest - lowest + 1
+}
+
+// readFrom은 ReadFrom이 없으면 Read를 반복해서 호출하는 이터레이터를 리턴한다.
+func readFrom(l CommitLog, offset uint64) (RecordIterator, error) {
+	if rr, ok := l.(rangeReader); ok {
+		return rr.ReadFrom(offset)
+	}
+	lowest, highest, count := bounds(l)
+	if offset < lowest {
+		return nil, ErrOffsetOutOfRange
+	}
+	end := lowest
+	if count > 0 {
+		end = highest + 1
+	}
+	return &readIterator{log: l, next: offset, end: end}, nil
+}
+
+func readKey(l CommitLog, key []byte) (Record, error) {
+	if k, ok := l.(keyReader); ok {
+		return k.ReadKey(key)
+	}
+	return Record{}, errors.ErrUnsupported
+}
+
+func offsetForTime(l CommitLog, t time.Time) (uint64, error) {
+	if i, ok := l.(timeIndexer); ok {
+		return i.OffsetForTime(t)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// appendReplicated는 appendReplicated가 없는 백엔드에서는 Append로 추가하므로 타임스탬프가 노드마다 다를 수 있다.
+func appendReplicated(l CommitLog, record Record) (uint64, error) {
+	if a, ok := l.(replicaAppender); ok {
+		return a.appendReplicated(record)
+	}
+	return l.Append(record)
+}
+
+// logReady는 Ready를 구현하지 않은 백엔드를 만들어진 순간부터 준비된 것으로 본다.
+func logReady(l CommitLog) bool {
+	if r, ok := l.(readinessReporter); ok {
+		return r.Ready()
+	}
+	return true
+}
+
+func sizeBytes(l CommitLog) (uint64, bool) {
+	if s, ok := l.(sizeReporter); ok {
+		return s.SizeBytes(), true
+	}
+	return 0, false
+}
+
+func reset(l CommitLog) error {
+	if r, ok := l.(resetter); ok {
+		return r.Reset()
+	}
+	return errors.ErrUnsupported
+}
+
+// readOnlyLog는 SetReadOnly를 구현하지 않은 백엔드를 감싸서 쓰기를 막는다.
+type readOnlyLog struct {
+	CommitLog
+}
+
+func (readOnlyLog) Append(Record) (uint64, error) {
+	return 0, ErrReadOnly
+}
+
+func (l readOnlyLog) Ready() bool {
+	return logReady(l.CommitLog)
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Codec은 세그먼트가 레코드를 store에 쓰기 전에 압축하는 방식이다.
+// 제로 값인 CodecNone은 압축하지 않는다.
+type Codec string
+
+const (
+	CodecNone   Codec = ""
+	CodecGzip   Codec = "gzip"
+	CodecSnappy Codec = "snappy"
+)
+
+// ErrUnknownCodec은 지원하지 않는 압축 방식을 설정했거나 세그먼트의 .codec 파일에 모르는 방식이 적혀 있을 때 리턴한다.
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// ParseCodec은 "none", "gzip", "snappy"를 Codec으로 바꾼다. 빈 문자열은 none과 같다.
+func ParseCodec(s string) (Codec, error) {
+	switch c := Codec(strings.ToLower(strings.TrimSpace(s))); c {
+	case "none", CodecNone:
+		return CodecNone, nil
+	case CodecGzip, CodecSnappy:
+		return c, nil
+	}
+	return CodecNone, fmt.Errorf("%w: %q", ErrUnknownCodec, s)
+}
+
+func (c Codec) String() string {
+	if c == CodecNone {
+		return "none"
+	}
+	return string(c)
+}
+
+// gzipWriters는 레코드마다 새로 만들면 비싼 gzip.Writer를 재사용한다.
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// compress는 p를 c로 압축한다. CodecNone이면 p를 그대로 리턴한다.
+func (c Codec) compress(p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecSnappy:
+		return snappy.Encode(nil, p), nil
+	case CodecGzip:
+		var buf bytes.Buffer
+		zw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(zw)
+		zw.Reset(&buf)
+		if _, err := zw.Write(p); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, string(c))
+}
+
+// decompress는 compress로 압축한 p를 되돌린다. 압축이 풀리지 않으면 ErrCorruptRecord를 감싸서 리턴한다.
+func (c Codec) decompress(p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecSnappy:
+		out, err := snappy.Decode(nil, p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+		}
+		return out, nil
+	case CodecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(p))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+		}
+		out, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, string(c))
+}
+
+// SetCompression은 앞으로 만드는 세그먼트의 압축 방식을 바꾼다. 이미 레코드가 있는 세그먼트는 만들 때의 방식을 계속 쓰고,
+// 아직 비어있는 활성 세그먼트는 바로 새 방식으로 쓴다.
+func (c *Log) SetCompression(codec Codec) error {
+	if _, err := codec.compress(nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Config.Segment.Compression = codec
+	return c.reconfigureActive()
+}
+
+// reconfigureActive는 활성 세그먼트가 비어있으면 지금의 압축 방식과 암호화 키를 다시 적용한다. c.mu의 쓰기 락을 잡고 호출한다.
+func (c *Log) reconfigureActive() error {
+	s := c.activeSegment
+	if c.closed || s == nil || s.store.Size() > 0 {
+		return nil
+	}
+	s.config = c.Config
+	if s.dir == "" {
+		return s.useConfigured(c.Config)
+	}
+	return s.loadCodec(c.Config)
+}
+
+// useConfigured는 설정한 압축 방식과 암호화 키를 새 세그먼트에 적용한다.
+func (s *segment) useConfigured(c Config) error {
+	if _, err := c.Segment.Compression.compress(nil); err != nil {
+		return err
+	}
+	s.codec = c.Segment.Compression
+	s.aead = nil
+	if c.Segment.EncryptionKey == nil {
+		return nil
+	}
+	var err error
+	s.aead, err = newAEAD(c.Segment.EncryptionKey)
+	return err
+}
+
+// loadCodec은 파일 세그먼트가 쓰는 압축 방식과 암호화 여부를 정한다. store에 이미 레코드가 있으면 .codec 파일에 적힌 방식을 따르고,
+// 파일이 없으면 압축하지도 암호화하지도 않은 세그먼트다. 그래서 설정을 바꾼 뒤에도 예전 세그먼트는 쓸 때의 방식으로 읽는다.
+// 비어있는 store는 설정한 방식으로 시작하고 그 방식을 .codec 파일에 기록한다.
+// .codec 파일의 첫 줄은 압축 방식이고, 암호화한 세그먼트는 둘째 줄에 aes-gcm을 적는다.
+func (s *segment) loadCodec(c Config) error {
+	if s.store.Size() > 0 {
+		p, err := os.ReadFile(s.codecPath())
+		if os.IsNotExist(err) {
+			s.codec = CodecNone
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, cipherName, _ := strings.Cut(strings.TrimSpace(string(p)), "\n")
+		if s.codec, err = ParseCodec(name); err != nil {
+			return err
+		}
+		switch cipherName {
+		case "":
+			return nil
+		case cipherAESGCM:
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownCodec, cipherName)
+		}
+		if c.Segment.EncryptionKey == nil {
+			return fmt.Errorf("%w: segment %d is encrypted", ErrInvalidEncryptionKey, s.baseOffset)
+		}
+		s.aead, err = newAEAD(c.Segment.EncryptionKey)
+		return err
+	}
+	if err := s.useConfigured(c); err != nil {
+		return err
+	}
+	if s.codec == CodecNone && s.aead == nil {
+		if err := os.Remove(s.codecPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	content := s.codec.String()
+	if s.aead != nil {
+		content += "\n" + cipherAESGCM
+	}
+	// 레코드보다 먼저 디스크에 있어야 크래시한 뒤에도 압축하거나 암호화한 레코드를 그대로 읽으려 하지 않는다
+	f, err := os.OpenFile(s.codecPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 압축 방식마다 로그 줄 같은 레코드를 파일 Log에 쓰고, ns/op와 함께 레코드 하나가 디스크에서 차지하는 바이트를 disk-B/op로 남긴다.
+//
+//	go test ./internal/server -run '^$' -bench BenchmarkStoreCompression
+func BenchmarkStoreCompression(b *testing.B) {
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecSnappy} {
+		b.Run(codec.String(), func(b *testing.B) {
+			var c Config
+			c.Segment.Compression = codec
+			c.Fsync = FsyncNever
+			dir := b.TempDir()
+			log, err := NewLogWithConfig(dir, c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer log.Close()
+
+			values := make([][]byte, 100)
+			for i := range values {
+				values[i] = logLines(i, 1024)
+			}
+			b.ReportAllocs()
+			n := 0
+			for b.Loop() {
+				if _, err := log.Append(Record{Value: values[n%len(values)]}); err != nil {
+					b.Fatal(err)
+				}
+				n++
+			}
+			b.StopTimer()
+			if err := log.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(storeBytes(b, dir))/float64(n), "disk-B/op")
+		})
+	}
+}
+
+// 압축한 레코드는 읽을 때 풀어야 하므로 읽기도 따로 잰다.
+func BenchmarkStoreCompressionRead(b *testing.B) {
+	const records = 2000
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecSnappy} {
+		b.Run(codec.String(), func(b *testing.B) {
+			var c Config
+			c.Segment.Compression = codec
+			c.Fsync = FsyncNever
+			log, err := NewLogWithConfig(b.TempDir(), c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer log.Close()
+			for i := 0; i < records; i++ {
+				if _, err := log.Append(Record{Value: logLines(i, 1024)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportAllocs()
+			off := uint64(0)
+			for b.Loop() {
+				if _, err := log.Read(off % records); err != nil {
+					b.Fatal(err)
+				}
+				off++
+			}
+		})
+	}
+}
+
+// SetCompression은 비어있는 활성 세그먼트에도 바로 적용되고, 다시 열어도 .codec 파일의 방식으로 읽는다.
+func TestSetCompression(t *testing.T) {
+	dir := t.TempDir()
+	log, err := NewPersistentLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.SetCompression(Codec("zstd")); err == nil {
+		t.Fatal("SetCompression accepted an unknown codec")
+	}
+	if err := log.SetCompression(CodecGzip); err != nil {
+		t.Fatal(err)
+	}
+	value := logLines(0, 4096)
+	if _, err := log.Append(Record{Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := storeBytes(t, dir); size >= int64(len(value)) {
+		t.Fatalf("store has %d bytes for a %d byte record, want it compressed", size, len(value))
+	}
+
+	if log, err = NewPersistentLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	record, err := log.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(record.Value) != string(value) {
+		t.Fatal("record changed after reopening a gzip segment without the codec configured")
+	}
+}
+
+// logLines는 i번째 레코드의 값으로 size 바이트 정도의 로그 줄들을 만든다.
+func logLines(i, size int) []byte {
+	var b strings.Builder
+	for j := 0; b.Len() < size; j++ {
+		fmt.Fprintf(&b, "ts=2024-01-01T00:00:%02d level=info msg=\"request handled\" method=GET path=/orders/%d status=200 duration_ms=%d\n",
+			j%60, i*7+j, (i+j)%250)
+	}
+	return []byte(b.String())
+}
+
+// storeBytes는 dir에 있는 store 파일 크기의 합이다.
+func storeBytes(tb testing.TB, dir string) int64 {
+	stores, err := filepath.Glob(filepath.Join(dir, "*.store"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var total int64
+	for _, name := range stores {
+		fi, err := os.Stat(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		total += fi.Size()
+	}
+	return total
+}
@@ -0,0 +1,25 @@
+package server
+
+// Config는 Log의 동작을 조정하는 설정이다.
+// Segment.MaxStoreBytes는 세그먼트 하나의 store가 가질 수 있는 최대 바이트 수이고,
+// 이 크기를 넘으면 새 세그먼트를 만든다. 0이면 기본값을 사용한다.
+// MaxRecords는 보관할 최대 레코드 수로, 0이면 제한하지 않는다.
+// Fsync는 파일 Log가 언제 디스크에 동기화할지 정하고, 제로 값이면 1초마다 동기화한다.
+// Segment.Mmap이 true이면 파일 Log가 store 파일을 메모리에 매핑해서 ReadAt 시스템 콜 없이 읽는다.
+// 읽기가 많은 경우에 유리하고, 매핑을 지원하지 않는 플랫폼에서는 무시한다.
+// Segment.Compression은 새로 만드는 세그먼트가 레코드를 압축할 방식이다. 이미 레코드가 있는 세그먼트는
+// 만들 때의 방식을 계속 쓰므로 설정을 바꿔도 예전 레코드를 읽을 수 있다. MaxStoreBytes는 압축한 크기로 센다.
+// Segment.EncryptionKey가 있으면 새로 만드는 세그먼트의 레코드를 AES-GCM으로 암호화한다. 키는 16, 24, 32바이트
+// 중 하나여야 하고, 암호화한 세그먼트가 있는 Log를 열 때는 같은 키를 줘야 한다.
+type Config struct {
+	Segment struct {
+		MaxStoreBytes uint64
+		Mmap          bool
+		Compression   Codec
+		EncryptionKey []byte
+	}
+	MaxRecords uint64
+	Fsync      FsyncPolicy
+}
+
+const defaultMaxStoreBytes = 1024 * 1024
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS로 허용하는 메서드. 브라우저 클라이언트는 produce와 consume만 하므로 DELETE, PUT 같은 관리 요청은 허용하지 않는다.
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+
+const (
+	// 브라우저가 보낼 수 있는 요청 헤더와, 스크립트가 읽을 수 있는 응답 헤더
+	corsAllowHeaders  = "Authorization, Content-Type, Accept, If-None-Match, " + idempotencyKeyHeader + ", traceparent, tracestate"
+	corsExposeHeaders = "ETag, Location, Retry-After, Idempotent-Replayed, " + recordSizeHeader
+	// 브라우저가 preflight 응답을 캐시하는 시간
+	corsMaxAge = 10 * time.Minute
+)
+
+// cors는 allowedOrigins에 있는 Origin의 요청에 Access-Control-Allow-* 헤더를 붙인다. "*"가 있으면 모든 Origin을 허용한다.
+// preflight(Access-Control-Request-Method가 있는 OPTIONS)는 라우터까지 가지 않고 204로 응답하므로 인증도 확인하지 않는다.
+// 허용하지 않은 Origin의 요청은 헤더를 붙이지 않고 그대로 처리하므로 브라우저가 응답을 막는다.
+// 쿠키를 쓰지 않으므로 Access-Control-Allow-Credentials는 보내지 않고, 토큰은 Authorization 헤더로 받는다.
+func cors(allowedOrigins []string) Middleware {
+	wildcard := slices.Contains(allowedOrigins, "*")
+	allowed := func(origin string) bool {
+		return wildcard || slices.ContainsFunc(allowedOrigins, func(o string) bool {
+			return strings.EqualFold(strings.TrimSuffix(o, "/"), origin)
+		})
+	}
+	methods := strings.Join(corsMethods, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// 허용하는 Origin이 여러 개면 응답이 Origin마다 다르므로 캐시가 구분하도록 한다
+			if !wildcard {
+				w.Header().Add("Vary", "Origin")
+			}
+			if !allowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if wildcard {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 데드레터의 Source. 지금은 웹훅만 데드레터를 남긴다
+const deadLetterSourceWebhook = "webhook"
+
+// DeadLetter는 전달에 계속 실패해서 건너뛴 레코드와 마지막 실패 이유다.
+// Offset과 Time은 데드레터 로그의 오프셋과 기록한 시각이고, 원래 로그의 오프셋은 Record.Offset이다.
+type DeadLetter struct {
+	Offset       uint64    `json:"offset"`
+	Time         time.Time `json:"time"`
+	Source       string    `json:"source"`
+	Subscription string    `json:"subscription,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Attempts     int       `json:"attempts"`
+	Reason       string    `json:"reason"`
+	Record       Record    `json:"record"`
+}
+
+// DeadLettersResponse의 NextOffset부터 다시 요청하면 이어서 읽는다.
+type DeadLettersResponse struct {
+	DeadLetters []DeadLetter `json:"deadLetters"`
+	NextOffset  uint64       `json:"nextOffset"`
+}
+
+// newDeadLetterLog는 영속 Log라면 Log 디렉터리 안의 deadletter 디렉터리에, 아니면 메모리에 데드레터 로그를 만든다.
+// 원래 레코드를 그대로 담으므로 세그먼트 설정과 암호화 키는 기본 Log와 같게 한다.
+func newDeadLetterLog(log CommitLog) (*Log, error) {
+	l, ok := log.(*Log)
+	if !ok || l.Dir == "" {
+		return NewLog(), nil
+	}
+	return NewLogWithConfig(filepath.Join(l.Dir, "deadletter"), l.Config)
+}
+
+// appendDeadLetter는 dl을 JSON으로 데드레터 로그에 추가한다. Offset과 Time은 읽을 때 데드레터 레코드에서 채운다.
+func appendDeadLetter(log CommitLog, dl DeadLetter) (uint64, error) {
+	value, err := json.Marshal(dl)
+	if err != nil {
+		return 0, err
+	}
+	return log.Append(Record{Value: value})
+}
+
+// deadletter 핸들러는 offset 쿼리 파라미터(기본값은 남아있는 가장 앞의 오프셋)부터 max개(기본값 100)까지의 데드레터를 응답한다.
+// 데드레터가 없으면 빈 배열을 응답한다.
+func (s *httpServer) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	offset, ok, err := offsetParam(r)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		offset, _, _ = bounds(s.deadLetters)
+	}
+	limit := defaultMaxRangeRecords
+	if v := r.URL.Query().Get("max"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			s.httpError(w, fmt.Errorf("invalid max: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	it, err := readFrom(s.deadLetters, offset)
+	if err == ErrOffsetOutOfRange {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	res := DeadLettersResponse{DeadLetters: []DeadLetter{}}
+	for len(res.DeadLetters) < limit {
+		record, ok := it.Next()
+		if !ok {
+			break
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(record.Value, &dl); err != nil {
+			s.httpError(w, fmt.Errorf("dead letter %d: %w", record.Offset, ErrCorruptRecord), http.StatusInternalServerError)
+			return
+		}
+		dl.Offset, dl.Time = record.Offset, record.Timestamp
+		res.DeadLetters = append(res.DeadLetters, dl)
+	}
+	if err := it.Err(); err == ErrOffsetOutOfRange {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	res.NextOffset = it.Offset()
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
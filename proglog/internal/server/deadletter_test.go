@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 구독자가 모든 레코드에 실패해도 데드레터로 넘길 때마다 연속 실패 횟수가 지워지므로 구독은 꺼지지 않는다.
+func TestDeadLetterResetsFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+	h := newTestHandler(t, WithWebhooks(true), WithDeadLetter(1))
+
+	w := serve(h, http.MethodPost, "/subscriptions", `{"url":"`+receiver.URL+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribe: got %d: %s", w.Code, w.Body)
+	}
+	const records = webhookMaxFailures + 5
+	for i := 0; i < records; i++ {
+		if w := serve(h, http.MethodPost, "/", produceBody([]byte("a"))); w.Code != http.StatusCreated {
+			t.Fatalf("produce %d: got %d: %s", i, w.Code, w.Body)
+		}
+	}
+
+	var res DeadLettersResponse
+	for deadline := time.Now().Add(5 * time.Second); len(res.DeadLetters) < records; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d dead letters, want %d", len(res.DeadLetters), records)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w := serve(h, http.MethodGet, "/deadletter", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("deadletter: got %d: %s", w.Code, w.Body)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, dl := range res.DeadLetters {
+		if dl.Record.Offset != uint64(i) || dl.Attempts != 1 {
+			t.Fatalf("dead letter %d: got record %d after %d attempts", i, dl.Record.Offset, dl.Attempts)
+		}
+	}
+
+	var subs SubscriptionsResponse
+	if err := json.Unmarshal(serve(h, http.MethodGet, "/subscriptions", "").Body.Bytes(), &subs); err != nil {
+		t.Fatal(err)
+	}
+	if len(subs.Subscriptions) != 1 {
+		t.Fatalf("got %d subscriptions, want 1", len(subs.Subscriptions))
+	}
+	if sub := subs.Subscriptions[0]; sub.Disabled || sub.Failures != 0 || sub.NextOffset != records {
+		t.Fatalf("subscription after dead letters: %+v", sub)
+	}
+}
+
+// maxAttempts번 실패한 레코드를 데드레터로 넘기면 다음 레코드로 넘어가고 연속 실패 횟수를 지운다.
+func TestDeadLetterAdvances(t *testing.T) {
+	deadLetters := NewLog()
+	h, err := newWebhooks(NewLog(), "", deadLetters, 3, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := &webhook{Subscription: Subscription{ID: "sub", URL: "http://example.com", NextOffset: 4, Failures: 2}}
+	if !h.deadLetter(wh, Record{Offset: 4, Value: []byte("a")}, 3, errors.New("webhook responded 500")) {
+		t.Fatal("deadLetter returned false")
+	}
+	if wh.NextOffset != 5 || wh.Failures != 0 || wh.LastError != "webhook responded 500" {
+		t.Fatalf("subscription after dead letter: %+v", wh.Subscription)
+	}
+	if _, err := deadLetters.Read(0); err != nil {
+		t.Fatalf("read dead letter: %v", err)
+	}
+	if got := h.maxFailures(); got != webhookMaxFailures {
+		t.Fatalf("maxFailures with 3 attempts: got %d, want %d", got, webhookMaxFailures)
+	}
+	h.maxAttempts = webhookMaxFailures * 2
+	if got := h.maxFailures(); got != h.maxAttempts {
+		t.Fatalf("maxFailures with %d attempts: got %d", h.maxAttempts, got)
+	}
+}
+
+// 데드레터는 웹훅만 남기므로 웹훅 없이 WithDeadLetter만 주면 GET /deadletter가 없다.
+// attempts는 웹훅을 끄는 연속 실패 횟수보다 커도 된다.
+func TestDeadLetterRequiresWebhooks(t *testing.T) {
+	h := newTestHandler(t, WithDeadLetter(3))
+	if w := serve(h, http.MethodGet, "/deadletter", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("deadletter without webhooks: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+	h = newTestHandler(t, WithWebhooks(true), WithDeadLetter(webhookMaxFailures*2))
+	if w := serve(h, http.MethodGet, "/deadletter", ""); w.Code != http.StatusOK {
+		t.Fatalf("deadletter with %d attempts: got %d: %s", webhookMaxFailures*2, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,665 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// DistributedConfig는 DistributedLog가 Raft 클러스터에 참여하는 방법을 정한다.
+type DistributedConfig struct {
+	// NodeID는 클러스터 안에서 노드를 구분하는 이름이다. 재시작해도 바뀌지 않아야 한다.
+	NodeID string
+	// BindAddr는 노드끼리 Raft 메시지를 주고받는 TCP 주소다. 다른 노드가 접속할 수 있는 host:port여야 한다.
+	BindAddr string
+	// HTTPAddr는 클라이언트가 이 노드의 HTTP 서버에 접속하는 host:port다.
+	// 팔로워가 쓰기 요청을 리더에게 전달하거나 리다이렉트할 때 사용하고, 비어있으면 팔로워는 503을 반환한다.
+	HTTPAddr string
+	// DataDir에 Raft 로그와 상태, 스냅숏을 저장한다. 비어있으면 메모리에 저장하므로 재시작하면 클러스터 상태를 잃는다.
+	DataDir string
+	// Bootstrap이 true이면 이 노드 하나로 새 클러스터를 만든다. 이미 Raft 상태가 있으면 무시한다.
+	Bootstrap bool
+	// Logger는 Raft의 로그를 남길 로거다. 지정하지 않으면 slog.Default()를 사용한다.
+	Logger *slog.Logger
+}
+
+// DistributedLog는 CommitLog를 감싸서 Raft로 복제한다. 리더만 Append를 받고,
+// 리더가 Raft 로그에 커밋한 레코드를 모든 노드의 FSM이 같은 순서로 로컬 로그에 추가하므로
+// 노드마다 같은 오프셋에 같은 레코드가 있다. 타임스탬프도 리더가 정한 값을 그대로 쓴다.
+//
+// 읽기는 로컬 로그에서 바로 하므로 팔로워는 리더보다 조금 늦은 레코드까지만 보일 수 있다.
+// 팔로워의 Append는 ErrNotLeader를 리턴하고, HTTP 서버는 쓰기 요청을 Leader의 주소로 전달하거나 리다이렉트한다.
+//
+// Raft 로그와 스냅숏이 원본이므로 감싼 로컬 로그는 시작할 때 비우고 Raft로 다시 만든다.
+// 재시작한 노드는 마지막 스냅숏과 그 뒤의 Raft 로그를 모두 다시 적용해야 읽을 수 있다.
+type DistributedLog struct {
+	config DistributedConfig
+	log    CommitLog
+	fsm    *fsm
+
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	store     *raftStore // DataDir가 없으면 nil
+
+	// replayIndex는 시작할 때 Raft 로그에 있던 마지막 인덱스이고, FSM이 그만큼 적용하면 replayed가 true가 된다
+	replayIndex uint64
+	replayed    atomic.Bool
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ CommitLog = (*DistributedLog)(nil)
+
+// ErrNotLeader는 리더가 아닌 노드에 쓰기나 멤버십 변경을 요청할 때 리턴한다.
+var ErrNotLeader = fmt.Errorf("not the leader")
+
+// ErrNoLeader는 리더가 선출되기 전이라 요청을 보낼 곳이 없을 때 리턴한다.
+var ErrNoLeader = fmt.Errorf("no leader")
+
+// Raft 로그 적용과 멤버십 변경을 기다리는 기본 시간
+const raftTimeout = 10 * time.Second
+
+// NewDistributedLog는 log를 로컬 로그로 쓰는 Raft 노드를 시작한다. log는 비어있어야 하고,
+// 이미 Raft 상태가 있는 노드가 재시작하는 경우에는 Reset으로 비운 뒤에 Raft로 다시 만든다.
+// 새 클러스터는 한 노드를 Bootstrap으로 시작하고, 나머지 노드는 리더의 Join으로 추가한다.
+func NewDistributedLog(log CommitLog, config DistributedConfig) (*DistributedLog, error) {
+	if config.NodeID == "" || config.BindAddr == "" {
+		return nil, fmt.Errorf("raft node ID and bind address are required")
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	d := &DistributedLog{
+		config: config,
+		log:    log,
+		fsm:    newFSM(log),
+		stop:   make(chan struct{}),
+	}
+	logger := hclog.FromStandardLogger(slog.NewLogLogger(config.Logger.Handler(), slog.LevelInfo), &hclog.LoggerOptions{
+		Name:  "raft",
+		Level: hclog.Info,
+	})
+
+	var (
+		logs   raft.LogStore
+		stable raft.StableStore
+		snaps  raft.SnapshotStore
+		err    error
+	)
+	if config.DataDir == "" {
+		mem := raft.NewInmemStore()
+		logs, stable, snaps = mem, mem, raft.NewInmemSnapshotStore()
+	} else {
+		if d.store, err = newRaftStore(filepath.Join(config.DataDir, "raft")); err != nil {
+			return nil, err
+		}
+		logs, stable = d.store, d.store
+		if snaps, err = raft.NewFileSnapshotStoreWithLogger(config.DataDir, 2, logger); err != nil {
+			d.store.Close()
+			return nil, err
+		}
+	}
+	existing, err := raft.HasExistingState(logs, stable, snaps)
+	if err != nil {
+		d.closeStore()
+		return nil, err
+	}
+	if _, _, count := bounds(log); count > 0 {
+		if !existing {
+			d.closeStore()
+			return nil, fmt.Errorf("local log must be empty to start a raft node")
+		}
+		if err := reset(log); err != nil {
+			d.closeStore()
+			return nil, fmt.Errorf("reset local log: %w", err)
+		}
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", config.BindAddr)
+	if err != nil {
+		d.closeStore()
+		return nil, err
+	}
+	if d.transport, err = raft.NewTCPTransportWithLogger(config.BindAddr, addr, 3, raftTimeout, logger); err != nil {
+		d.closeStore()
+		return nil, err
+	}
+
+	// 리더가 되면 자기 HTTP 주소를 멤버 정보에 기록해서 팔로워가 쓰기 요청을 보낼 수 있게 한다
+	leaderCh := make(chan bool, 1)
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(config.NodeID)
+	rc.Logger = logger
+	rc.NotifyCh = leaderCh
+	if d.raft, err = raft.NewRaft(rc, d.fsm, logs, stable, snaps, d.transport); err != nil {
+		d.transport.Close()
+		d.closeStore()
+		return nil, err
+	}
+	// 부트스트랩이 쓰는 구성 항목은 다시 적용할 레코드가 아니므로 그 전에 기록한다
+	d.replayIndex = d.raft.LastIndex()
+	if config.Bootstrap && !existing {
+		err := d.raft.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{{ID: rc.LocalID, Address: d.transport.LocalAddr()}},
+		}).Error()
+		if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			d.Close()
+			return nil, err
+		}
+	}
+	go d.watchLeadership(leaderCh)
+	return d, nil
+}
+
+// Ready는 재시작한 노드가 시작할 때 Raft 로그에 있던 항목을 모두 로컬 로그에 다시 적용했는지 확인한다.
+// 새 노드는 처음부터 준비되어 있다. 팔로워는 리더가 커밋 인덱스를 알려줘야 적용하므로 리더를 찾을 때까지 준비되지 않는다.
+// 마지막 항목이 커밋되지 않은 채 버려졌다면 새 리더가 그 인덱스 이상의 항목을 커밋할 때 준비된다.
+func (d *DistributedLog) Ready() bool {
+	if d.replayed.Load() {
+		return true
+	}
+	if d.raft.AppliedIndex() < d.replayIndex {
+		return false
+	}
+	d.replayed.Store(true)
+	return true
+}
+
+// watchLeadership은 리더가 될 때마다 자기 멤버 정보를 기록한다.
+// raft는 NotifyCh를 받을 때까지 기다리므로 기록은 다른 고루틴에서 한다.
+func (d *DistributedLog) watchLeadership(leaderCh <-chan bool) {
+	for {
+		select {
+		case <-d.stop:
+			return
+		case isLeader := <-leaderCh:
+			if isLeader && d.config.HTTPAddr != "" {
+				go d.registerSelf()
+			}
+		}
+	}
+}
+
+func (d *DistributedLog) registerSelf() {
+	if d.fsm.member(d.config.NodeID) == d.config.HTTPAddr {
+		return
+	}
+	err := d.applyMember(memberChange{ID: d.config.NodeID, HTTPAddr: d.config.HTTPAddr})
+	if err != nil {
+		d.config.Logger.Warn("failed to register raft member", slog.String("node", d.config.NodeID), slog.Any("error", err))
+	}
+}
+
+func (d *DistributedLog) Append(record Record) (uint64, error) {
+	return d.AppendContext(context.Background(), record)
+}
+
+// AppendContext는 레코드를 Raft 로그에 커밋하고 리더의 로컬 로그에 추가된 오프셋을 리턴한다.
+// ctx에 기한이 있으면 그때까지만 커밋을 기다린다. 리더가 바뀌는 도중에 실패하면 레코드가 이미 커밋되었을 수 있다.
+func (d *DistributedLog) AppendContext(ctx context.Context, record Record) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if d.raft.State() != raft.Leader {
+		return 0, ErrNotLeader
+	}
+	record.Timestamp = time.Now()
+	cmd, err := encodeCommand(appendCommand, record)
+	if err != nil {
+		return 0, err
+	}
+	return d.applyAppend(ctx, cmd)
+}
+
+// AppendIf는 모든 노드의 로그에서 다음 오프셋이 expected일 때만 레코드를 추가한다. FSM이 Raft 로그 순서대로
+// 확인하고 추가하므로 다른 노드에 보낸 쓰기와도 끼어들지 않는다. 다르면 실제 다음 오프셋과 ErrOffsetMismatch를 리턴한다.
+func (d *DistributedLog) AppendIf(expected uint64, record Record) (uint64, error) {
+	if d.raft.State() != raft.Leader {
+		return 0, ErrNotLeader
+	}
+	record.Timestamp = time.Now()
+	cmd, err := encodeCommand(appendIfCommand, conditionalAppend{Expected: expected, Record: record})
+	if err != nil {
+		return 0, err
+	}
+	return d.applyAppend(context.Background(), cmd)
+}
+
+// applyAppend는 레코드를 추가하는 명령을 커밋하고 FSM이 리턴한 오프셋을 돌려준다.
+func (d *DistributedLog) applyAppend(ctx context.Context, cmd []byte) (uint64, error) {
+	timeout := raftTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	f := d.raft.Apply(cmd, timeout)
+	if err := f.Error(); err != nil {
+		return 0, raftError(err)
+	}
+	res := f.Response().(applyResult)
+	return res.offset, res.err
+}
+
+// raftError는 raft의 에러를 이 패키지의 에러로 바꾼다.
+func raftError(err error) error {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrLeadershipLost),
+		errors.Is(err, raft.ErrLeadershipTransferInProgress):
+		return ErrNotLeader
+	case errors.Is(err, raft.ErrEnqueueTimeout):
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	case errors.Is(err, raft.ErrRaftShutdown):
+		return ErrLogClosed
+	}
+	return err
+}
+
+func (d *DistributedLog) Read(offset uint64) (Record, error) {
+	return d.log.Read(offset)
+}
+
+func (d *DistributedLog) ReadContext(ctx context.Context, offset uint64) (Record, error) {
+	return readContext(ctx, d.log, offset)
+}
+
+func (d *DistributedLog) LowestOffset() uint64 {
+	return d.log.LowestOffset()
+}
+
+func (d *DistributedLog) HighestOffset() uint64 {
+	return d.log.HighestOffset()
+}
+
+func (d *DistributedLog) Appended() <-chan struct{} {
+	return appended(d.log)
+}
+
+func (d *DistributedLog) Bounds() (lowest, highest, count uint64) {
+	return bounds(d.log)
+}
+
+// SizeBytes는 로컬 로그의 크기다. Raft 로그와 스냅숏이 DataDir에서 차지하는 크기는 포함하지 않는다.
+func (d *DistributedLog) SizeBytes() uint64 {
+	n, _ := sizeBytes(d.log)
+	return n
+}
+
+func (d *DistributedLog) ReadFrom(offset uint64) (RecordIterator, error) {
+	return readFrom(d.log, offset)
+}
+
+func (d *DistributedLog) ReadKey(key []byte) (Record, error) {
+	return readKey(d.log, key)
+}
+
+// SweepExpired는 로컬 로그의 만료된 레코드를 툼스톤으로 바꾼다. 만료는 레코드의 ExpireAt만으로 정해지고
+// 어느 노드에서 읽어도 스윕 전후의 결과가 같으므로 Raft를 거치지 않고 노드마다 따로 스윕한다.
+func (d *DistributedLog) SweepExpired(now time.Time) (int, error) {
+	if s, ok := d.log.(expirySweeper); ok {
+		return s.SweepExpired(now)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+func (d *DistributedLog) OffsetForTime(t time.Time) (uint64, error) {
+	return offsetForTime(d.log, t)
+}
+
+// IsLeader는 이 노드가 지금 리더인지 리턴한다.
+func (d *DistributedLog) IsLeader() bool {
+	return d.raft.State() == raft.Leader
+}
+
+// Leader는 현재 리더의 노드 ID와 HTTP 주소를 리턴한다. 리더가 없거나 HTTP 주소를 모르면 빈 문자열이다.
+func (d *DistributedLog) Leader() (id, httpAddr string) {
+	_, leaderID := d.raft.LeaderWithID()
+	return string(leaderID), d.fsm.member(string(leaderID))
+}
+
+// WaitForLeader는 리더가 선출될 때까지 최대 timeout 동안 기다린다.
+func (d *DistributedLog) WaitForLeader(timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if _, id := d.raft.LeaderWithID(); id != "" {
+			return nil
+		}
+		select {
+		case <-deadline:
+			return ErrNoLeader
+		case <-ticker.C:
+		}
+	}
+}
+
+// Server는 클러스터 구성에 있는 노드 하나다.
+type Server struct {
+	ID       string `json:"id"`
+	RaftAddr string `json:"raftAddr"`
+	HTTPAddr string `json:"httpAddr,omitempty"`
+	Leader   bool   `json:"leader"`
+}
+
+// Servers는 Raft 클러스터 구성에 있는 노드들을 리턴한다.
+func (d *DistributedLog) Servers() ([]Server, error) {
+	f := d.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, raftError(err)
+	}
+	_, leaderID := d.raft.LeaderWithID()
+	var servers []Server
+	for _, srv := range f.Configuration().Servers {
+		servers = append(servers, Server{
+			ID:       string(srv.ID),
+			RaftAddr: string(srv.Address),
+			HTTPAddr: d.fsm.member(string(srv.ID)),
+			Leader:   srv.ID == leaderID,
+		})
+	}
+	return servers, nil
+}
+
+// Join은 id 노드를 투표권이 있는 멤버로 클러스터에 추가한다. 리더에서만 호출할 수 있다.
+// 같은 ID나 같은 Raft 주소의 노드가 이미 있으면 그 노드를 먼저 제거하므로, 주소를 바꿔서 재시작한 노드도 다시 추가할 수 있다.
+func (d *DistributedLog) Join(id, raftAddr, httpAddr string) error {
+	if d.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	f := d.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return raftError(err)
+	}
+	serverID, serverAddr := raft.ServerID(id), raft.ServerAddress(raftAddr)
+	member := false
+	for _, srv := range f.Configuration().Servers {
+		if srv.ID == serverID && srv.Address == serverAddr {
+			member = true
+			continue
+		}
+		if srv.ID == serverID || srv.Address == serverAddr {
+			if err := d.raft.RemoveServer(srv.ID, 0, raftTimeout).Error(); err != nil {
+				return raftError(err)
+			}
+		}
+	}
+	if !member {
+		if err := d.raft.AddVoter(serverID, serverAddr, 0, raftTimeout).Error(); err != nil {
+			return raftError(err)
+		}
+	}
+	if d.fsm.member(id) == httpAddr {
+		return nil
+	}
+	return d.applyMember(memberChange{ID: id, HTTPAddr: httpAddr})
+}
+
+// Leave는 id 노드를 클러스터에서 제거한다. 리더에서만 호출할 수 있고, 리더 자신을 제거하면 새 리더가 선출된다.
+func (d *DistributedLog) Leave(id string) error {
+	if d.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	// 멤버 정보를 먼저 지운다. 리더 자신을 제거한 뒤에는 더 이상 Raft 로그에 쓸 수 없다
+	if err := d.applyMember(memberChange{ID: id, Remove: true}); err != nil {
+		return err
+	}
+	return raftError(d.raft.RemoveServer(raft.ServerID(id), 0, raftTimeout).Error())
+}
+
+func (d *DistributedLog) applyMember(change memberChange) error {
+	cmd, err := encodeCommand(memberCommand, change)
+	if err != nil {
+		return err
+	}
+	return raftError(d.raft.Apply(cmd, raftTimeout).Error())
+}
+
+// Snapshot은 Raft 스냅숏을 만들어서 Raft 로그를 줄인 뒤, 로컬 로그와 멤버 정보를 FSM 스냅숏과 같은 형식으로 w에 쓴다.
+// 팔로워에서도 호출할 수 있고, 그 노드가 지금까지 적용한 상태를 쓴다.
+func (d *DistributedLog) Snapshot(w io.Writer) error {
+	if err := d.raft.Snapshot().Error(); err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return raftError(err)
+	}
+	sn, err := snapshotOf(d.log, d.fsm.memberSnapshot())
+	if err != nil {
+		return err
+	}
+	return sn.writeTo(w)
+}
+
+// Restore는 리더에서 r의 스냅숏으로 클러스터의 상태를 바꾼다. 리더가 먼저 복원한 뒤 팔로워에게 스냅숏을 보내므로
+// 잠시 동안 팔로워가 이전 상태를 읽을 수 있다. 재해 복구용이고, 복원하기 전에 커밋된 레코드는 모두 사라진다.
+// raft는 스냅숏의 크기를 미리 알아야 하므로 r을 임시 파일에 먼저 받는다.
+func (d *DistributedLog) Restore(r io.Reader) error {
+	if d.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	f, err := os.CreateTemp(d.config.DataDir, "restore-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	// raft가 FSM의 에러를 감싸면 ErrInvalidSnapshot인지 알 수 없고 리더의 로그도 이미 비워졌으므로 먼저 확인한다
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := validateSnapshot(f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	meta := &raft.SnapshotMeta{Version: raft.SnapshotVersionMax, Size: n}
+	return raftError(d.raft.Restore(meta, f, 0))
+}
+
+// Close는 Raft 노드를 멈추고 Raft 저장소와 감싼 로컬 로그를 닫는다.
+// 다른 노드에게 떠난다고 알리지 않으므로 클러스터에서 빼려면 먼저 리더에서 Leave를 호출한다.
+func (d *DistributedLog) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		err := d.raft.Shutdown().Error()
+		if terr := d.transport.Close(); err == nil {
+			err = terr
+		}
+		if serr := d.closeStore(); err == nil {
+			err = serr
+		}
+		if c, ok := d.log.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		d.closeErr = err
+	})
+	return d.closeErr
+}
+
+func (d *DistributedLog) closeStore() error {
+	if d.store == nil {
+		return nil
+	}
+	return d.store.Close()
+}
+
+// raftCommand는 Raft 로그 엔트리의 첫 바이트로, 뒤에 오는 JSON의 종류를 나타낸다.
+type raftCommand byte
+
+const (
+	appendCommand   raftCommand = iota // Record를 로컬 로그에 추가한다
+	memberCommand                      // memberChange로 노드의 HTTP 주소를 기록하거나 지운다
+	appendIfCommand                    // conditionalAppend의 Expected가 다음 오프셋일 때만 Record를 추가한다
+)
+
+// conditionalAppend는 AppendIf로 추가할 레코드와 그 레코드가 받아야 할 오프셋이다.
+type conditionalAppend struct {
+	Expected uint64 `json:"expected"`
+	Record   Record `json:"record"`
+}
+
+// memberChange는 Raft 구성에는 없는 노드의 HTTP 주소를 모든 노드가 알 수 있도록 Raft 로그로 복제한다.
+type memberChange struct {
+	ID       string `json:"id"`
+	HTTPAddr string `json:"httpAddr,omitempty"`
+	Remove   bool   `json:"remove,omitempty"`
+}
+
+func encodeCommand(cmd raftCommand, v any) ([]byte, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(cmd)}, p...), nil
+}
+
+// applyResult는 FSM.Apply의 결과로, 리더의 AppendContext가 ApplyFuture.Response로 받는다.
+type applyResult struct {
+	offset uint64
+	err    error
+}
+
+// fsm은 커밋된 Raft 로그 엔트리를 로컬 로그와 멤버 정보에 적용한다.
+// raft는 Apply, Snapshot, Restore를 한 고루틴에서만 호출하므로 last는 락 없이 쓴다.
+type fsm struct {
+	log CommitLog
+
+	mu      sync.RWMutex
+	members map[string]string // 노드 ID -> HTTP 주소
+
+	// last는 마지막으로 적용한 레코드의 타임스탬프다. 리더가 바뀌면서 시계가 뒤로 가도
+	// 오프셋 순서와 타임스탬프 순서가 같도록 그보다 이른 타임스탬프는 last로 올린다.
+	last time.Time
+}
+
+var _ raft.FSM = (*fsm)(nil)
+
+func newFSM(log CommitLog) *fsm {
+	return &fsm{log: log, members: make(map[string]string)}
+}
+
+func (f *fsm) member(id string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.members[id]
+}
+
+func (f *fsm) Apply(l *raft.Log) any {
+	if len(l.Data) == 0 {
+		return applyResult{err: fmt.Errorf("empty raft command at index %d", l.Index)}
+	}
+	switch raftCommand(l.Data[0]) {
+	case appendCommand:
+		var record Record
+		if err := json.Unmarshal(l.Data[1:], &record); err != nil {
+			return applyResult{err: err}
+		}
+		return f.append(record)
+	case appendIfCommand:
+		var c conditionalAppend
+		if err := json.Unmarshal(l.Data[1:], &c); err != nil {
+			return applyResult{err: err}
+		}
+		// 모든 노드가 같은 순서로 적용하므로 노드마다 같은 결과가 나온다
+		if next := nextOffset(f.log); next != c.Expected {
+			return applyResult{offset: next, err: ErrOffsetMismatch}
+		}
+		return f.append(c.Record)
+	case memberCommand:
+		var change memberChange
+		if err := json.Unmarshal(l.Data[1:], &change); err != nil {
+			return applyResult{err: err}
+		}
+		f.mu.Lock()
+		if change.Remove {
+			delete(f.members, change.ID)
+		} else {
+			f.members[change.ID] = change.HTTPAddr
+		}
+		f.mu.Unlock()
+		return applyResult{}
+	}
+	return applyResult{err: fmt.Errorf("unknown raft command %d at index %d", l.Data[0], l.Index)}
+}
+
+// append는 리더가 정한 타임스탬프로 레코드를 로컬 로그에 추가한다. 리더가 바뀌어서 시계가 뒤로 가도
+// 타임스탬프가 오프셋 순서대로 커지도록 마지막 레코드보다 이르면 마지막 레코드의 시각을 쓴다.
+func (f *fsm) append(record Record) applyResult {
+	if record.Timestamp.Before(f.last) {
+		record.Timestamp = f.last
+	}
+	off, err := appendReplicated(f.log, record)
+	if err == nil {
+		f.last = record.Timestamp
+	}
+	return applyResult{offset: off, err: err}
+}
+
+// Snapshot은 지금까지 적용한 상태를 고정한다. 레코드는 추가된 뒤 바뀌지 않으므로
+// 지금의 오프셋 범위까지 읽는 이터레이터만 만들어두면 Persist가 Apply와 동시에 실행되어도 같은 내용을 쓴다.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	sn, err := snapshotOf(f.log, f.memberSnapshot())
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{sn}, nil
+}
+
+func (f *fsm) memberSnapshot() map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	members := make(map[string]string, len(f.members))
+	for id, addr := range f.members {
+		members[id] = addr
+	}
+	return members
+}
+
+// Restore는 로컬 로그를 비우고 스냅숏의 레코드를 같은 오프셋으로 다시 만든다.
+// 멤버 정보가 없는 스냅숏은 로컬 Log의 백업이므로 지금의 멤버 정보를 그대로 둔다.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	header, last, err := restoreSnapshot(f.log, rc)
+	if err != nil {
+		return err
+	}
+	f.last = last
+	if header.Members != nil {
+		f.mu.Lock()
+		f.members = header.Members
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+type fsmSnapshot struct {
+	*logSnapshot
+}
+
+// Persist는 멤버 정보와 레코드를 NDJSON으로 sink에 쓴다.
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.writeTo(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var c Config
+	c.Segment.EncryptionKey = bytes.Repeat([]byte{7}, 32)
+	log, err := NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := []byte("card=4111-1111-1111-1111")
+	if _, err := log.Append(Record{Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := os.ReadFile(filepath.Join(dir, "0.store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(store, value) {
+		t.Fatal("store file contains the plaintext value")
+	}
+
+	if _, err := NewPersistentLog(dir); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("open without the key: got %v, want %v", err, ErrInvalidEncryptionKey)
+	}
+	log, err = NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	record, err := log.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(record.Value, value) {
+		t.Fatalf("got %q, want %q", record.Value, value)
+	}
+}
+
+// WithEncryption은 WithLog로 준 Log의 비어있는 활성 세그먼트부터 암호화한다.
+func TestWithEncryption(t *testing.T) {
+	dir := t.TempDir()
+	log, err := NewPersistentLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{1}, 16)
+	srv, err := NewHTTPServerE(":0", WithLog(log), WithEncryption(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown(context.Background())
+	value := []byte("secret value")
+	if _, err := log.Append(Record{Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := os.ReadFile(filepath.Join(dir, "0.store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(store, value) {
+		t.Fatal("store file contains the plaintext value")
+	}
+	var c Config
+	c.Segment.EncryptionKey = key
+	reopened, err := NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if record, err := reopened.Read(0); err != nil || !bytes.Equal(record.Value, value) {
+		t.Fatalf("read after reopen: got %q, %v", record.Value, err)
+	}
+}
+
+func TestEncryptionBadKey(t *testing.T) {
+	for _, n := range []int{1, 15, 17, 31, 33} {
+		key := make([]byte, n)
+		if _, err := NewHTTPServerE(":0", WithEncryption(key)); !errors.Is(err, ErrInvalidEncryptionKey) {
+			t.Errorf("WithEncryption with a %d byte key: got %v, want %v", n, err, ErrInvalidEncryptionKey)
+		}
+		var c Config
+		c.Segment.EncryptionKey = key
+		if _, err := NewLogWithConfig(t.TempDir(), c); !errors.Is(err, ErrInvalidEncryptionKey) {
+			t.Errorf("NewLogWithConfig with a %d byte key: got %v, want %v", n, err, ErrInvalidEncryptionKey)
+		}
+	}
+}
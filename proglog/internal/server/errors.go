@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrorResponse는 모든 에러 응답의 JSON 바디다.
+// {"error":{"code":"offset_not_found","message":"offset not found"}}
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail의 Code는 클라이언트가 에러 종류를 구분할 때 쓰는 바뀌지 않는 문자열이고,
+// Message는 사람이 읽기 위한 설명이라 바뀔 수 있다.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// NextOffset은 offset_mismatch 에러에서만 있고, 로그의 실제 다음 오프셋이다.
+	NextOffset *uint64 `json:"nextOffset,omitempty"`
+}
+
+// writeError는 status 상태 코드와 함께 JSON 에러 응답을 보낸다.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeErrorDetail(w, status, ErrorDetail{Code: code, Message: msg})
+}
+
+func writeErrorDetail(w http.ResponseWriter, status int, detail ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: detail})
+}
+
+// errorCodes는 패키지의 에러를 에러 응답의 code로 바꾼다. 감싼 에러도 errors.Is로 찾는다.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrOffsetNotFound, "offset_not_found"},
+	{ErrOffsetOutOfRange, "offset_out_of_range"},
+	{ErrOffsetCompacted, "offset_compacted"},
+	{ErrRecordExpired, "record_expired"},
+	{ErrOffsetMismatch, "offset_mismatch"},
+	{ErrInvalidOffset, "invalid_offset"},
+	{ErrCorruptRecord, "corrupt_record"},
+	{ErrKeyNotFound, "key_not_found"},
+	{ErrReadOnly, "read_only"},
+	{ErrLogClosed, "log_closed"},
+	{ErrRecordTooLarge, "record_too_large"},
+	{ErrRequestTooLarge, "request_too_large"},
+	{ErrEmptyBody, "empty_body"},
+	{ErrMalformedJSON, "malformed_json"},
+	{ErrInvalidProduceArray, "invalid_produce_array"},
+	{ErrTopicNotFound, "topic_not_found"},
+	{ErrInvalidTopic, "invalid_topic"},
+	{ErrDefaultTopic, "default_topic"},
+	{ErrPartitionNotFound, "partition_not_found"},
+	{ErrInvalidPartitions, "invalid_partitions"},
+	{ErrPartitionMismatch, "partition_mismatch"},
+	{ErrNotLeader, "not_leader"},
+	{ErrNoLeader, "no_leader"},
+	{ErrInvalidMember, "invalid_member"},
+	{ErrInvalidSnapshot, "invalid_snapshot"},
+	{ErrAppendQueueFull, "append_queue_full"},
+	{ErrSubscriptionNotFound, "subscription_not_found"},
+	{ErrInvalidSubscription, "invalid_subscription"},
+	{ErrUnknownAPIVersion, "unknown_api_version"},
+	{ErrTooManyOffsets, "too_many_offsets"},
+	{ErrUnauthenticated, "unauthenticated"},
+	{ErrNotReady, "not_ready"},
+	{errors.ErrUnsupported, "unsupported"},
+	{context.Canceled, "canceled"},
+	{context.DeadlineExceeded, "deadline_exceeded"},
+}
+
+// errorCode는 err에 맞는 code를 리턴하고, 등록되지 않은 에러이면
+// 상태 코드 이름을 소문자와 밑줄로 바꾼 값(예: bad_request)을 리턴한다.
+func errorCode(err error, status int) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	if status == statusClientClosedRequest {
+		return "client_closed_request"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// 클라이언트가 응답을 받기 전에 연결을 끊었음을 나타내는 비표준 상태 코드(nginx와 같은 값)
+const statusClientClosedRequest = 499
+
+// contextErrorStatus는 요청 컨텍스트가 끝나서 생긴 에러를 상태 코드로 바꾼다.
+// 클라이언트가 취소했으면 499, 기한이 지났으면 503이고, 컨텍스트 에러가 아니면 false를 리턴한다.
+func contextErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, true
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, true
+	}
+	return 0, false
+}
+
+// notFoundHandler는 등록되지 않은 경로에 대해 JSON 에러를 반환한다.
+// /v3/처럼 모르는 API 버전의 경로이면 지원하는 버전을 알려주는 unknown_api_version으로 응답한다.
+func (s *httpServer) notFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.metrics.errors.WithLabelValues("404").Inc()
+		if v := s.unknownAPIVersion(r); v != "" {
+			err := unknownAPIVersionError(v)
+			writeError(w, http.StatusNotFound, errorCode(err, http.StatusNotFound), err.Error())
+			return
+		}
+		writeError(w, http.StatusNotFound, "not_found", "not found")
+	})
+}
+
+// methodNotAllowedHandler는 경로는 있지만 메서드가 맞지 않는 요청에 대해 JSON 에러를 반환한다.
+// 라우터에 같은 경로로 다른 메서드를 매칭해보고, 매칭되는 메서드들을 Allow 헤더에 담는다.
+func (s *httpServer) methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		} {
+			req := r.Clone(r.Context())
+			req.Method = method
+			var match mux.RouteMatch
+			if router.Match(req, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		s.metrics.errors.WithLabelValues("405").Inc()
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	})
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// recordETag는 오프셋과 레코드 내용의 체크섬으로 만든 ETag다. 추가된 레코드는 바뀌지 않으므로 오프셋만으로 충분하지만,
+// Reset이나 Restore 뒤에는 같은 오프셋에 다른 레코드가 올 수 있어서 체크섬을 같이 넣는다.
+// 같은 레코드를 JSON, protobuf, gzip으로 다르게 인코딩해도 같은 ETag를 쓰므로 약한 ETag다.
+func recordETag(record Record) string {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(record.Timestamp.UnixNano()))
+	crc := crc32.Update(0, crcTable, record.Key)
+	crc = crc32.Update(crc, crcTable, record.Value)
+	crc = crc32.Update(crc, crcTable, ts[:])
+	// 맵은 순서가 없으므로 키를 정렬해서 같은 헤더면 같은 체크섬이 나오게 한다
+	for _, k := range slices.Sorted(maps.Keys(record.Headers)) {
+		crc = crc32.Update(crc, crcTable, []byte(k))
+		crc = crc32.Update(crc, crcTable, []byte{0})
+		crc = crc32.Update(crc, crcTable, []byte(record.Headers[k]))
+		crc = crc32.Update(crc, crcTable, []byte{0})
+	}
+	return fmt.Sprintf(`W/"%d-%08x"`, record.Offset, crc)
+}
+
+// etagMatches는 If-None-Match 헤더에 etag가 있는지 약한 비교로 확인한다. *는 어떤 ETag와도 맞는다.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || strings.TrimPrefix(part, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// export 핸들러는 로그의 모든 레코드를 가장 작은 오프셋부터 NDJSON으로 내보낸다.
+// 시작할 때의 오프셋 범위까지만 내보내기 때문에 도중에 추가된 레코드는 포함되지 않고,
+// 레코드는 추가된 뒤 바뀌지 않으므로 그 시점의 일관된 스냅숏이 된다.
+// 로그 전체를 메모리에 올리지 않고 레코드를 하나씩 읽어서 바로 응답에 쓴다.
+// 출력은 Log.Reader와 같은 형식이라 한 줄에 Record 하나씩이므로 다른 서버의 /bulk로 그대로 올려서 복원할 수 있다.
+func (s *httpServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	log := s.logFor(r)
+	it, err := readFrom(log, log.LowestOffset())
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	records := newRecordReader(&contextIterator{ctx: r.Context(), RecordIterator: it})
+	_, err = io.Copy(w, records)
+	s.metrics.recordsRead.Add(float64(records.n))
+	if err != nil && r.Context().Err() == nil {
+		// 이미 응답을 쓰기 시작했으므로 상태 코드를 바꿀 수 없다.
+		// 보존 정책으로 도중에 레코드가 삭제된 경우이므로 연결을 끊어서 알린다.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// contextIterator는 ctx가 끝나면 더 읽지 않고 Err로 ctx.Err()를 리턴한다.
+type contextIterator struct {
+	ctx context.Context
+	RecordIterator
+	err error
+}
+
+func (it *contextIterator) Next() (Record, bool) {
+	if it.err = it.ctx.Err(); it.err != nil {
+		return Record{}, false
+	}
+	return it.RecordIterator.Next()
+}
+
+func (it *contextIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.RecordIterator.Err()
+}
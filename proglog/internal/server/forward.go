@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+)
+
+// forwardedHeader는 팔로워가 리더에게 전달한 요청에 붙인다. 리더가 바뀌는 도중이라 받은 노드도 리더가 아니면
+// 요청이 노드 사이를 돌지 않도록 다시 전달하지 않고 503을 반환한다.
+const forwardedHeader = "X-Proglog-Forwarded"
+
+// forwardToLeader는 복제하는 로그에 쓰는 핸들러를 감싸서, 팔로워가 받은 요청을 리더에게 그대로 전달하고
+// 리더의 응답을 클라이언트에게 돌려준다. 그래서 클라이언트는 어느 노드가 리더인지 몰라도 된다.
+// WithLeaderRedirect를 켜면 전달하지 않고 핸들러가 리더 주소로 307 리다이렉트한다.
+// 리더는 전달한 팔로워를 요청자로 보므로 mTLS와 ACL을 쓴다면 팔로워의 인증서에도 쓰기 권한이 있어야 한다.
+func (s *httpServer) forwardToLeader(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := s.Log.(clusterLog)
+		if !ok || s.leaderRedirect || c.IsLeader() {
+			next(w, r)
+			return
+		}
+		_, addr := c.Leader()
+		if addr == "" {
+			w.Header().Set("Retry-After", "1")
+			s.httpError(w, ErrNoLeader, http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get(forwardedHeader) != "" {
+			w.Header().Set("Retry-After", "1")
+			s.httpError(w, ErrNotLeader, http.StatusServiceUnavailable)
+			return
+		}
+		s.metrics.requestsForwarded.Inc()
+		s.leaderProxy(addr, r.TLS != nil).ServeHTTP(w, r)
+	}
+}
+
+// leaderProxy는 요청을 addr의 리더에게 같은 메서드, 경로, 바디로 보내는 프록시를 만든다.
+// 바디는 읽는 대로 리더에게 보내므로 큰 bulk 요청도 메모리에 모으지 않는다.
+func (s *httpServer) leaderProxy(addr string, useTLS bool) *httputil.ReverseProxy {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = scheme
+			pr.Out.URL.Host = addr
+			pr.Out.Host = addr
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, "1")
+		},
+		Transport: s.forwardTransport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.httpError(w, fmt.Errorf("forward to leader %s: %w", addr, err), http.StatusBadGateway)
+		},
+	}
+}
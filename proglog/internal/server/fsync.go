@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 기본 fsync 정책에서 버퍼를 디스크에 동기화하는 간격
+const defaultFsyncInterval = time.Second
+
+type fsyncMode int
+
+const (
+	fsyncInterval fsyncMode = iota
+	fsyncAlways
+	fsyncNever
+)
+
+// FsyncPolicy는 파일 Log가 언제 store 파일을 fsync 할지 정한다. 메모리 Log에서는 무시한다.
+// 제로 값은 FsyncInterval(time.Second)와 같다.
+//
+//   - FsyncAlways는 Append가 리턴하기 전에 fsync 하므로 Append가 성공한 레코드는 전원이 꺼져도 남는다.
+//     대신 요청마다 디스크 동기화를 기다리므로 처리량이 가장 낮다.
+//   - FsyncInterval(d)는 d마다 백그라운드에서 fsync 한다. 크래시하면 마지막 d 동안 추가된 레코드를 잃을 수 있다.
+//   - FsyncNever는 fsync를 운영체제에 맡긴다. 프로세스가 죽어도 이미 파일에 쓴 레코드는 남지만,
+//     전원이 꺼지거나 커널이 죽으면 페이지 캐시에만 있던 레코드를 얼마나 잃을지 알 수 없다.
+//
+// 어떤 정책이든 Close는 버퍼를 flush 하고 fsync 한다.
+type FsyncPolicy struct {
+	mode     fsyncMode
+	interval time.Duration
+}
+
+var (
+	FsyncAlways = FsyncPolicy{mode: fsyncAlways}
+	FsyncNever  = FsyncPolicy{mode: fsyncNever}
+)
+
+// FsyncInterval은 d마다 fsync 하는 정책을 리턴한다. d가 0 이하이면 기본 간격인 1초를 사용한다.
+func FsyncInterval(d time.Duration) FsyncPolicy {
+	return FsyncPolicy{mode: fsyncInterval, interval: d}
+}
+
+// ParseFsyncPolicy는 "always", "never" 또는 "500ms"처럼 간격을 나타내는 문자열을 FsyncPolicy로 바꾼다.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return FsyncAlways, nil
+	case "never":
+		return FsyncNever, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return FsyncPolicy{}, fmt.Errorf("invalid fsync policy %q: want always, never or a positive duration", s)
+	}
+	return FsyncInterval(d), nil
+}
+
+func (p FsyncPolicy) String() string {
+	switch p.mode {
+	case fsyncAlways:
+		return "always"
+	case fsyncNever:
+		return "never"
+	}
+	return p.syncInterval().String()
+}
+
+// syncInterval은 백그라운드 fsync 간격을 리턴한다. 간격 정책이 아니면 0이다.
+func (p FsyncPolicy) syncInterval() time.Duration {
+	if p.mode != fsyncInterval {
+		return 0
+	}
+	if p.interval <= 0 {
+		return defaultFsyncInterval
+	}
+	return p.interval
+}
+
+// startSync는 Fsync 정책이 간격이면 그 간격마다 모든 세그먼트를 fsync 하는 고루틴을 시작한다.
+// 쓰기 락을 잡은 상태에서 호출해야 한다.
+func (c *Log) startSync() {
+	if c.stopSync != nil {
+		c.stopSync()
+		c.stopSync = nil
+	}
+	interval := c.Config.Fsync.syncInterval()
+	if c.Dir == "" || interval == 0 {
+		return
+	}
+	c.stopSync = every(interval, func() {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if c.closed {
+			return
+		}
+		// 동기화는 다음 주기에 다시 시도하므로 에러는 무시한다
+		syncSegments(c.segments)
+	})
+}
+
+// SetFsync는 fsync 정책을 바꾼다. 간격 정책이면 백그라운드 fsync를 새 간격으로 다시 시작한다.
+func (c *Log) SetFsync(p FsyncPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Config.Fsync = p
+	if !c.closed {
+		c.startSync()
+	}
+}
+
+// syncSegments는 세그먼트들의 버퍼를 파일에 쓰고 fsync 한다. 실패해도 나머지 세그먼트는 계속 동기화하고 첫 에러를 리턴한다.
+func syncSegments(segments []*segment) error {
+	var first error
+	for _, s := range segments {
+		if err := s.Sync(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// groupOffsets는 컨슈머 그룹마다 커밋한 오프셋을 기억한다.
+// path가 있으면 커밋할 때마다 JSON 파일로 저장하고, 시작할 때 그 파일을 다시 읽는다.
+type groupOffsets struct {
+	mu      sync.Mutex
+	path    string
+	offsets map[string]uint64
+}
+
+// newGroupOffsets는 path 파일에서 커밋된 오프셋을 읽어온다. path가 비어있으면 메모리에만 저장한다.
+func newGroupOffsets(path string) (*groupOffsets, error) {
+	g := &groupOffsets{
+		path:    path,
+		offsets: make(map[string]uint64),
+	}
+	if path == "" {
+		return g, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &g.offsets); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Get은 group이 커밋한 오프셋을 리턴한다. 커밋한 적이 없으면 false를 리턴한다.
+func (g *groupOffsets) Get(group string) (uint64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	off, ok := g.offsets[group]
+	return off, ok
+}
+
+// Commit은 group의 오프셋을 기록한다. 파일은 임시 파일에 쓴 뒤 이름을 바꾸기 때문에
+// 도중에 프로세스가 죽어도 이전에 커밋한 내용이 남는다.
+func (g *groupOffsets) Commit(group string, offset uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	prev, existed := g.offsets[group]
+	g.offsets[group] = offset
+	if g.path == "" {
+		return nil
+	}
+	if err := g.save(); err != nil {
+		if existed {
+			g.offsets[group] = prev
+		} else {
+			delete(g.offsets, group)
+		}
+		return err
+	}
+	return nil
+}
+
+func (g *groupOffsets) save() error {
+	b, err := json.Marshal(g.offsets)
+	if err != nil {
+		return err
+	}
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.path)
+}
+
+// groupOffsetsPath는 영속 Log라면 Log 디렉터리 안의 groups.json을,
+// 메모리 Log나 다른 CommitLog 구현이라면 빈 문자열을 리턴한다.
+func groupOffsetsPath(log CommitLog) string {
+	l, ok := log.(*Log)
+	if !ok || l.Dir == "" {
+		return ""
+	}
+	return filepath.Join(l.Dir, "groups.json")
+}
+
+type CommitRequest struct {
+	Offset uint64 `json:"offset"`
+}
+
+type GroupOffsetResponse struct {
+	Group  string `json:"group"`
+	Offset uint64 `json:"offset"`
+}
+
+// commit 핸들러는 컨슈머 그룹이 어디까지 처리했는지 기록한다.
+// 컨슈머는 크래시 후에 group offset 핸들러로 커밋한 위치를 받아서 이어서 읽으면 된다.
+func (s *httpServer) handleCommit(w http.ResponseWriter, r *http.Request) {
+	group := mux.Vars(r)["group"]
+	var req CommitRequest
+	err := decodeJSON(r.Body, &req)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := s.groups.Commit(group, req.Offset); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	err = json.NewEncoder(w).Encode(GroupOffsetResponse{Group: group, Offset: req.Offset})
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// group offset 핸들러는 컨슈머 그룹이 커밋한 오프셋을 응답한다.
+// 처음 보는 그룹이면 로그의 가장 작은 오프셋부터 읽도록 LowestOffset을 응답한다.
+func (s *httpServer) handleGroupOffset(w http.ResponseWriter, r *http.Request) {
+	group := mux.Vars(r)["group"]
+	off, ok := s.groups.Get(group)
+	if !ok {
+		off = s.Log.LowestOffset()
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	err := json.NewEncoder(w).Encode(GroupOffsetResponse{Group: group, Offset: off})
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
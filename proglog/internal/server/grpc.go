@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"io"
+
+	api "github.com/mokpolar/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer는 HTTP 서버와 같은 Log를 사용해서 gRPC로 produce와 consume을 제공한다.
+type grpcServer struct {
+	api.UnimplementedLogServer
+	Log CommitLog
+}
+
+// NewGRPCServer는 log를 사용하는 gRPC 서버를 만들어서 Log 서비스를 등록한다.
+// HTTP 서버와 같은 log를 넘기면 두 서버가 같은 레코드를 공유한다.
+func NewGRPCServer(log CommitLog, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	gsrv := grpc.NewServer(opts...)
+	srv, err := newgrpcServer(log)
+	if err != nil {
+		return nil, err
+	}
+	api.RegisterLogServer(gsrv, srv)
+	return gsrv, nil
+}
+
+func newgrpcServer(log CommitLog) (*grpcServer, error) {
+	return &grpcServer{Log: log}, nil
+}
+
+func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
+	if !logReady(s.Log) {
+		return nil, grpcError(ErrNotReady)
+	}
+	off, err := appendContext(ctx, s.Log, recordFromProto(req.GetRecord()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &api.ProduceResponse{Offset: off}, nil
+}
+
+func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
+	if !logReady(s.Log) {
+		return nil, grpcError(ErrNotReady)
+	}
+	record, err := readContext(ctx, s.Log, req.Offset)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &api.ConsumeResponse{Record: recordToProto(record)}, nil
+}
+
+// ProduceStream은 클라이언트가 보내는 레코드를 하나씩 추가하고 레코드마다 오프셋을 응답한다.
+// 클라이언트가 스트림을 닫으면 Recv가 io.EOF를 리턴하고 nil을 리턴해서 정상 종료한다.
+func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res, err := s.Produce(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// ConsumeStream은 요청한 오프셋부터 레코드를 차례로 보낸다.
+// 로그의 끝에 도달하면 에러를 리턴하지 않고 새 레코드가 추가될 때까지 기다리며,
+// 클라이언트가 취소하면 스트림 컨텍스트가 끝나서 종료한다.
+func (s *grpcServer) ConsumeStream(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
+	if !logReady(s.Log) {
+		return grpcError(ErrNotReady)
+	}
+	offset := req.Offset
+	for {
+		// Read보다 먼저 채널을 받아야 그 사이에 추가된 레코드를 놓치지 않는다
+		appended := appended(s.Log)
+		record, err := s.Log.Read(offset)
+		switch err {
+		case nil:
+			if err = stream.Send(&api.ConsumeResponse{Record: recordToProto(record)}); err != nil {
+				return err
+			}
+			offset++
+			continue
+		case ErrOffsetCompacted, ErrRecordExpired:
+			offset++
+			continue
+		case ErrOffsetNotFound:
+		default:
+			return grpcError(err)
+		}
+
+		select {
+		case <-appended:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// grpcError는 Log의 에러를 gRPC 상태 코드로 바꾼다.
+// ErrOffsetNotFound와 ErrOffsetCompacted, ErrRecordExpired는 codes.NotFound, ErrOffsetOutOfRange는 codes.OutOfRange,
+// 팔로워에 쓰려고 한 ErrNotLeader와 재적용이 끝나지 않은 ErrNotReady는 다시 시도하라는 뜻으로 codes.Unavailable이 되고,
+// 나머지는 codes.Internal이 된다.
+func grpcError(err error) error {
+	switch err {
+	case ErrOffsetNotFound, ErrOffsetCompacted, ErrRecordExpired:
+		return status.Error(codes.NotFound, err.Error())
+	case ErrOffsetOutOfRange:
+		return status.Error(codes.OutOfRange, err.Error())
+	case ErrNotLeader, ErrNotReady:
+		return status.Error(codes.Unavailable, err.Error())
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func recordFromProto(r *api.Record) Record {
+	record := Record{
+		Value:   r.GetValue(),
+		Offset:  r.GetOffset(),
+		Key:     r.GetKey(),
+		Headers: r.GetHeaders(),
+	}
+	if ts := r.GetTimestamp(); ts != nil {
+		record.Timestamp = ts.AsTime()
+	}
+	if ts := r.GetExpireAt(); ts != nil {
+		record.ExpireAt = ts.AsTime()
+	}
+	return record
+}
+
+func recordToProto(r Record) *api.Record {
+	record := &api.Record{
+		Value:   r.Value,
+		Offset:  r.Offset,
+		Key:     r.Key,
+		Headers: r.Headers,
+	}
+	// 타임스탬프가 없는 예전 레코드는 0001년이 아니라 빈 필드로 보낸다
+	if !r.Timestamp.IsZero() {
+		record.Timestamp = timestamppb.New(r.Timestamp)
+	}
+	if !r.ExpireAt.IsZero() {
+		record.ExpireAt = timestamppb.New(r.ExpireAt)
+	}
+	return record
+}
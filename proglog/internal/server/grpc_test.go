@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	api "github.com/mokpolar/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCTestClient는 log를 쓰는 gRPC 서버를 메모리 리스너에서 실행하고 그 서버에 접속한 클라이언트를 리턴한다.
+func newGRPCTestClient(t *testing.T, log CommitLog) api.LogClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	gsrv, err := NewGRPCServer(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gsrv.Serve(ln)
+	t.Cleanup(gsrv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return api.NewLogClient(conn)
+}
+
+func TestGRPCProduceConsume(t *testing.T) {
+	client := newGRPCTestClient(t, NewLog())
+	ctx := context.Background()
+
+	for i, v := range []string{"first", "second"} {
+		res, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{
+			Value:   []byte(v),
+			Key:     []byte("k"),
+			Headers: map[string]string{"content-type": "text/plain"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Offset != uint64(i) {
+			t.Fatalf("produce %q: got offset %d, want %d", v, res.Offset, i)
+		}
+	}
+	res, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := res.GetRecord()
+	if string(record.GetValue()) != "second" || record.GetOffset() != 1 || string(record.GetKey()) != "k" {
+		t.Fatalf("consume 1: got %v", record)
+	}
+	if record.GetHeaders()["content-type"] != "text/plain" || record.GetTimestamp() == nil {
+		t.Fatalf("consume 1: headers or timestamp missing: %v", record)
+	}
+}
+
+func TestGRPCStreams(t *testing.T) {
+	client := newGRPCTestClient(t, NewLog())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	produce, err := client.ProduceStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := produce.Send(&api.ProduceRequest{Record: &api.Record{Value: []byte{byte(i)}}}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := produce.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Offset != uint64(i) {
+			t.Fatalf("stream produce %d: got offset %d", i, res.Offset)
+		}
+	}
+	if err := produce.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := produce.Recv(); err != io.EOF {
+		t.Fatalf("after CloseSend: got %v, want EOF", err)
+	}
+
+	consume, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want < 3; want++ {
+		res, err := consume.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetRecord().GetOffset() != want {
+			t.Fatalf("stream consume: got offset %d, want %d", res.GetRecord().GetOffset(), want)
+		}
+	}
+}
+
+// errorLog는 Append와 Read가 모두 err를 리턴하는 CommitLog다.
+type errorLog struct{ err error }
+
+func (l errorLog) Append(Record) (uint64, error) { return 0, l.err }
+func (l errorLog) Read(uint64) (Record, error)   { return Record{}, l.err }
+func (errorLog) LowestOffset() uint64            { return 0 }
+func (errorLog) HighestOffset() uint64           { return 0 }
+
+func TestGRPCErrorCodes(t *testing.T) {
+	truncated := NewLog()
+	for i := 0; i < 3; i++ {
+		truncated.Append(Record{Value: []byte("v")})
+	}
+	if err := truncated.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	expired := NewLog()
+	expired.Append(Record{Value: []byte("v"), ExpireAt: time.Now().Add(-time.Second)})
+
+	tests := []struct {
+		name   string
+		log    CommitLog
+		offset uint64
+		code   codes.Code
+	}{
+		{"past the end", NewLog(), 0, codes.NotFound},
+		{"truncated", truncated, 0, codes.OutOfRange},
+		{"expired", expired, 0, codes.NotFound},
+		{"not leader", errorLog{ErrNotLeader}, 0, codes.Unavailable},
+		{"not ready", errorLog{ErrNotReady}, 0, codes.Unavailable},
+		{"other", errorLog{errors.New("disk on fire")}, 0, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newGRPCTestClient(t, tt.log)
+			_, err := client.Consume(context.Background(), &api.ConsumeRequest{Offset: tt.offset})
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("consume: got %v (%v), want %v", got, err, tt.code)
+			}
+		})
+	}
+
+	client := newGRPCTestClient(t, errorLog{ErrNotLeader})
+	_, err := client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("v")}})
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Fatalf("produce on a follower: got %v, want %v", got, codes.Unavailable)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressGzip은 Accept-Encoding에 gzip이 있는 요청의 응답 바디를 gzip으로 압축한다.
+// 응답이 minBytes보다 작거나, 이미 압축된 Content-Type이거나, 핸들러가 Content-Encoding을 직접 정했으면 압축하지 않는다.
+// stream처럼 바디를 다 쓰기 전에 flush 하는 응답도 이벤트가 바로 전달되도록 압축하지 않는다.
+func compressGzip(minBytes int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minBytes: minBytes}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip은 Accept-Encoding 헤더가 gzip을 허용하는지 확인한다. q=0이면 허용하지 않는 것이다.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(v, 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// compressedContentTypes는 이미 압축되어 있어서 gzip으로 더 줄어들지 않는 Content-Type이다.
+var compressedContentTypes = map[string]bool{
+	"application/gzip":   true,
+	"application/x-gzip": true,
+	"application/zip":    true,
+	"application/zstd":   true,
+	"image/jpeg":         true,
+	"image/png":          true,
+	"image/gif":          true,
+	"image/webp":         true,
+}
+
+func isCompressedContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return compressedContentTypes[mt] || strings.HasPrefix(mt, "video/") || strings.HasPrefix(mt, "audio/")
+}
+
+// gzipResponseWriter는 바디가 minBytes만큼 모일 때까지 상태 코드와 바디를 미뤄두었다가
+// 압축할지 정한 뒤에 원래의 ResponseWriter에 쓴다.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes int
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// 1xx 응답은 최종 응답이 아니므로 그대로 보낸다
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		h := w.Header()
+		if h.Get("Content-Encoding") != "" || isCompressedContentType(h.Get("Content-Type")) {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) < w.minBytes {
+				return len(p), nil
+			}
+			return len(p), w.decide(true)
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide는 압축 여부를 정하고 미뤄둔 상태 코드와 바디를 쓴다.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress {
+		// 압축한 바이트로는 Content-Type을 추측할 수 없으므로 원래 바디로 먼저 정한다
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush는 압축 여부가 정해지지 않았으면 압축하지 않기로 하고 지금까지의 응답을 보낸다.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close는 핸들러가 끝난 뒤에 호출된다. minBytes보다 작은 응답은 압축하지 않고 그대로 보낸다.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// Unwrap은 http.ResponseController가 원래의 ResponseWriter에 접근할 수 있게 한다.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// healthz 핸들러는 로그에 접근하지 않고 프로세스가 살아있는지만 알려준다.
+// 쿠버네티스 liveness probe 용도이므로 인증을 추가하더라도 예외로 둬야 한다.
+func (s *httpServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, "ok")
+}
+
+// readyz 핸들러는 Log 백엔드가 초기화되고 시작할 때의 복구나 재적용을 마치기 전에는 503을, 그 후에는 200을 반환한다.
+// 쿠버네티스 readiness probe 용도이다.
+func (s *httpServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.isReady() {
+		writeHealth(w, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+	writeHealth(w, http.StatusOK, "ok")
+}
+
+func writeHealth(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(HealthResponse{Status: status})
+}
+
+// ErrNotReady는 Log가 시작할 때의 복구나 재적용을 마치기 전에 받은 요청에 503과 함께 리턴한다.
+var ErrNotReady = errors.New("log is not ready")
+
+// isReady는 Log가 요청을 받을 준비가 되었는지 확인한다. Raft 노드처럼 시작한 뒤에도 레코드를 다시 적용하는 백엔드는
+// Ready로 알려주고, 한 번 준비되면 다시 확인하지 않는다.
+func (s *httpServer) isReady() bool {
+	if s.ready.Load() {
+		return true
+	}
+	if !logReady(s.Log) {
+		return false
+	}
+	s.ready.Store(true)
+	return true
+}
+
+// requireReady는 Log가 준비되기 전에는 핸들러를 부르지 않고 Retry-After와 함께 503(not_ready)을 반환한다.
+// 반쯤 복구된 로그에서 읽거나 그 뒤에 쓰지 않도록 produce와 consume 요청을 모두 감싼다.
+func (s *httpServer) requireReady(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isReady() {
+			w.Header().Set("Retry-After", "1")
+			s.httpError(w, ErrNotReady, http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
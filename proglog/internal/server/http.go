@@ -1,10 +1,24 @@
 package server
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // 서버의 주소를 파라미터로 받아서 *http.Server를 리턴
@@ -12,17 +26,259 @@ import (
 // / 엔드포인트를 호출하는 POST 요청은 produceHandler가 처리하여 레코드를 로그에 추가
 // / 엔드포인트를 호출하는 GET 요청은 consumeHandler가 처리하여 로그에서 레코드를 읽음
 // 생성한 httpServer는 *net/http.Server로 다시 래핑하여 ListenAndServer()를 이용해서 요청을 처리할 수 있음
-func NewHTTPServer(addr string) *http.Server {
-	httpsrv := newHTTPServer()
-	r := mux.NewRouter()
-	r.HandleFunc("/", httpsrv.handleProduce).Methods("POST")
-	r.HandleFunc("/", httpsrv.handleConsume).Methods("GET")
+// opts로 타임아웃과 레코드 크기 제한 등을 설정할 수 있음
+// 모든 API 엔드포인트는 /v1/produce처럼 버전 경로 아래에도 등록되고, 버전 없는 경로는 v1과 같음
+// 옵션이 잘못되었거나 인증서, 토픽 Log를 열 수 없으면 패닉을 일으키므로, 설정 파일에서 옵션을 만든다면 NewHTTPServerE를 쓴다.
+func NewHTTPServer(addr string, opts ...Option) *http.Server {
+	srv, err := NewHTTPServerE(addr, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return srv
+}
+
+// NewHTTPServerE는 NewHTTPServer와 같지만 패닉 대신 에러를 리턴한다.
+// 옵션을 먼저 확인하고 TLS 인증서를 읽은 뒤에 컨슈머 그룹 오프셋, 웹훅 구독, 토픽 Log를 열기 때문에
+// 에러를 리턴할 때는 고루틴을 남기지 않는다. 서버가 만든 것이 아닌 WithLog의 Log는 닫지 않는다.
+func NewHTTPServerE(addr string, opts ...Option) (*http.Server, error) {
+	o := options{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	// TLS 설정이 있으면 Run이 ListenAndServeTLS로 서버를 실행한다
+	var tlsConfig *tls.Config
+	if o.certFile != "" || o.keyFile != "" {
+		var err error
+		if tlsConfig, err = LoadTLSConfig(o.certFile, o.keyFile); err != nil {
+			return nil, err
+		}
+		if o.clientCAs != nil {
+			tlsConfig.ClientCAs = o.clientCAs
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	httpsrv, err := newHTTPServer(o)
+	if err != nil {
+		return nil, err
+	}
+	root := mux.NewRouter()
+	// 접두사가 있으면 모든 엔드포인트를 접두사 아래의 서브라우터에 등록한다
+	r := root
+	if httpsrv.pathPrefix != "" {
+		r = root.PathPrefix(httpsrv.pathPrefix).Subrouter()
+	}
+	// API 엔드포인트는 /v1 같은 버전 경로 아래에 등록하고, 기존 클라이언트를 위해 버전 없는 경로에도 v1을 등록한다
+	for _, v := range apiVersions {
+		vr := r.PathPrefix("/" + v.name).Subrouter()
+		vr.Use(withAPIVersion(v.name))
+		v.register(httpsrv, vr, o)
+	}
+	apiVersions[0].register(httpsrv, r, o)
+	if o.profiling {
+		debug := func(h http.HandlerFunc) http.HandlerFunc {
+			return httpsrv.authorize(debugAction, h)
+		}
+		r.HandleFunc("/debug/pprof/cmdline", debug(pprof.Cmdline))
+		r.HandleFunc("/debug/pprof/profile", debug(pprof.Profile))
+		r.HandleFunc("/debug/pprof/symbol", debug(pprof.Symbol))
+		r.HandleFunc("/debug/pprof/trace", debug(pprof.Trace))
+		// heap, goroutine 같은 나머지 프로파일은 pprof.Index가 이름으로 찾아서 처리한다
+		r.PathPrefix("/debug/pprof/").HandlerFunc(debug(pprof.Index))
+	}
+	ops := r
+	if o.healthOutsidePrefix {
+		ops = root
+	}
+	ops.HandleFunc("/healthz", httpsrv.handleHealthz).Methods("GET")
+	ops.HandleFunc("/readyz", httpsrv.handleReadyz).Methods("GET")
+	ops.HandleFunc("/version", httpsrv.handleVersion).Methods("GET")
+	ops.Handle("/metrics", httpsrv.metrics.Handler()).Methods("GET")
+	root.NotFoundHandler = httpsrv.notFoundHandler()
+	root.MethodNotAllowedHandler = httpsrv.methodNotAllowedHandler(root)
+
+	// 바깥부터 순서대로 라우터를 감싼다. 요청 로그는 복구한 패닉의 500과 압축한 응답 크기까지 남기고,
+	// 패닉을 복구한 500 응답도 압축하고 span에 기록하도록 recoverPanics는 그 안쪽에 둔다
+	middleware := []Middleware{
+		func(next http.Handler) http.Handler { return logRequests(o.logger, next) },
+	}
+	if o.gzipMinBytes > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return compressGzip(o.gzipMinBytes, next) })
+	}
+	if o.tracerProvider != nil {
+		root.Use(nameSpans)
+		middleware = append(middleware, func(next http.Handler) http.Handler { return traceRequests(o.tracerProvider, next) })
+	}
+	middleware = append(middleware, func(next http.Handler) http.Handler { return recoverPanics(o.logger, next) })
+	// preflight는 자격 증명 없이 오므로 인증보다 바깥에서 응답한다
+	if len(o.corsOrigins) > 0 {
+		middleware = append(middleware, cors(o.corsOrigins))
+	}
+	middleware = append(middleware, identifyClient)
+	if o.maxBodyBytes > 0 {
+		middleware = append(middleware, httpsrv.limitBody(o.maxBodyBytes))
+	}
+	if o.tokenVerifier != nil || o.passwordVerifier != nil {
+		middleware = append(middleware, httpsrv.authenticate(o.tokenVerifier, o.passwordVerifier))
+	}
+	handler := Chain(middleware...)(root)
+	// 토픽 Log와 옵션 없이 만든 기본 Log는 서버가 만든 것이므로 Run이 셧다운 뒤에 닫는다.
+	// 웹훅은 Log를 읽으므로 Log보다 먼저 멈춘다
+	var closers []io.Closer
+	if httpsrv.webhooks != nil {
+		closers = append(closers, httpsrv.webhooks)
+	}
+	if httpsrv.deadLetters != nil {
+		closers = append(closers, httpsrv.deadLetters)
+	}
+	if httpsrv.appendPool != nil {
+		closers = append(closers, httpsrv.appendPool)
+	}
+	closers = append(closers, httpsrv.topics)
+	if c, ok := httpsrv.Log.(io.Closer); ok && o.log == nil {
+		closers = append(closers, c)
+	}
+	srv := &http.Server{
+		Addr:           addr,
+		Handler:        closingHandler{handler, closers},
+		TLSConfig:      tlsConfig,
+		ReadTimeout:    o.readTimeout,
+		WriteTimeout:   o.writeTimeout,
+		MaxHeaderBytes: o.maxHeaderBytes,
+	}
+	if o.h2c {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
 
-	return &http.Server{
-		Addr:    addr,
-		Handler: r,
+	// 보존 기간이 있으면 오래된 세그먼트를 삭제하는 고루틴을 시작하고, 서버가 종료될 때 멈춘다
+	if o.retention > 0 {
+		interval := o.retentionInterval
+		if interval <= 0 {
+			interval = defaultRetentionInterval
+		}
+		if l, ok := httpsrv.Log.(retainer); ok {
+			srv.RegisterOnShutdown(startRetention(l, o.logger, o.retention, interval))
+		} else {
+			o.logger.Warn("log backend does not support retention")
+		}
 	}
+	if o.compactionInterval > 0 {
+		if l, ok := httpsrv.Log.(compactor); ok {
+			srv.RegisterOnShutdown(startCompaction(l, o.logger, o.compactionInterval))
+		} else {
+			o.logger.Warn("log backend does not support compaction")
+		}
+	}
+	if o.expirySweep > 0 {
+		if _, ok := httpsrv.Log.(expirySweeper); !ok {
+			o.logger.Warn("log backend does not support expiry sweep")
+		}
+		srv.RegisterOnShutdown(startExpirySweep(httpsrv.Log, httpsrv.topics, o.logger, o.expirySweep))
+	}
+	return srv, nil
+}
 
+// registerV1은 v1 API의 엔드포인트를 r에 등록한다.
+func (s *httpServer) registerV1(r *mux.Router, o options) {
+	// /produce와 /consume이 정식 엔드포인트이고,
+	// / 엔드포인트는 기존 클라이언트를 위해 남겨둔 것이므로 새 클라이언트는 /produce, /consume을 사용한다
+	// 요청 시간 제한은 감사 로그 안쪽에 두어서 시간이 지난 요청도 503으로 남긴다
+	guard := func(action string, limiter *rateLimiter, timeout func(*http.Request) time.Duration, h http.HandlerFunc) http.HandlerFunc {
+		return s.audit(action, s.withTimeout(timeout, s.requireReady(s.rateLimit(limiter, s.authorize(action, h)))))
+	}
+	producer := func(h http.HandlerFunc) http.HandlerFunc {
+		return guard(produceAction, o.produceLimiter, o.produceTimeoutFor, h)
+	}
+	consumer := func(h http.HandlerFunc) http.HandlerFunc {
+		return guard(consumeAction, o.consumeLimiter, o.consumeTimeoutFor, h)
+	}
+	// stream과 export는 응답을 계속 흘려보내므로 요청 시간을 제한하지 않는다
+	streamer := func(h http.HandlerFunc) http.HandlerFunc {
+		return guard(consumeAction, o.consumeLimiter, noTimeout, h)
+	}
+	// 복제하는 로그에 쓰는 요청은 팔로워가 받으면 리더에게 전달하고, 리더에서는 처리 중인 쓰기 요청 수를 제한한다
+	writer := func(h http.HandlerFunc) http.HandlerFunc {
+		return producer(s.forwardToLeader(s.limitAppends(h)))
+	}
+	// bulk는 큰 파일을 한 줄씩 올리므로 요청 시간을 제한하지 않는다
+	bulkWriter := guard(produceAction, o.produceLimiter, noTimeout, s.forwardToLeader(s.limitAppends(s.handleBulk)))
+	produce := writer(s.handleProduce)
+	consume := consumer(s.handleConsume)
+	r.HandleFunc("/produce", produce).Methods("POST")
+	r.HandleFunc("/consume", consume).Methods("GET", "HEAD")
+	r.HandleFunc("/", produce).Methods("POST")
+	r.HandleFunc("/", consume).Methods("GET", "HEAD")
+	r.HandleFunc("/batch", writer(s.handleProduceBatch)).Methods("POST")
+	r.HandleFunc("/bulk", bulkWriter).Methods("POST")
+	r.HandleFunc("/range", consumer(s.handleConsumeRange)).Methods("GET")
+	r.HandleFunc("/consume-multi", consumer(s.handleConsumeMulti)).Methods("POST")
+	r.HandleFunc("/stream", streamer(s.handleStream)).Methods("GET")
+	r.HandleFunc("/offsets", consumer(s.handleOffsets)).Methods("GET")
+	r.HandleFunc("/stats", consumer(s.handleStats)).Methods("GET")
+	r.HandleFunc("/export", streamer(s.handleExport)).Methods("GET")
+	r.HandleFunc("/key/{key}", consumer(s.handleConsumeKey)).Methods("GET")
+	r.HandleFunc("/at", consumer(s.handleOffsetForTime)).Methods("GET")
+	r.HandleFunc("/groups/{group}/commit", consumer(s.handleCommit)).Methods("POST")
+	r.HandleFunc("/groups/{group}/offset", consumer(s.handleGroupOffset)).Methods("GET")
+	// 토픽마다 독립된 로그를 사용하고, 처음 produce 할 때 토픽이 만들어진다
+	r.HandleFunc("/topics", consumer(s.handleListTopics)).Methods("GET")
+	r.HandleFunc("/topics/{topic}", producer(s.limitAppends(s.withTopic(true, s.handleProduce)))).Methods("POST")
+	r.HandleFunc("/topics/{topic}", consumer(s.withTopic(false, s.handleConsume))).Methods("GET", "HEAD")
+	r.HandleFunc("/topics/{topic}", producer(s.handleCreateTopic)).Methods("PUT")
+	r.HandleFunc("/topics/{topic}/offsets", consumer(s.withTopic(false, s.handleOffsets))).Methods("GET")
+	r.HandleFunc("/topics/{topic}/stats", consumer(s.withTopic(false, s.handleStats))).Methods("GET")
+	if o.truncateEnabled {
+		truncate := s.audit(truncateAction, s.authorize(truncateAction, s.handleTruncate))
+		r.HandleFunc("/", truncate).Methods("DELETE")
+		r.HandleFunc("/log", truncate).Methods("DELETE")
+	}
+	if o.topicDeletionEnabled {
+		r.HandleFunc("/topics/{topic}", s.audit(truncateAction, s.authorize(truncateAction, s.handleDeleteTopic))).Methods("DELETE")
+	}
+	if o.snapshotEnabled {
+		r.HandleFunc("/snapshot", s.audit(snapshotAction, s.authorize(snapshotAction, s.handleSnapshot))).Methods("POST")
+		r.HandleFunc("/restore", s.audit(snapshotAction, s.authorize(snapshotAction, s.forwardToLeader(s.handleRestore)))).Methods("POST")
+	}
+	if s.backuper != nil {
+		r.HandleFunc("/backup", s.audit(backupAction, s.authorize(backupAction, s.forwardToLeader(s.handleBackup)))).Methods("POST")
+	}
+	// Raft로 복제하는 Log라면 클러스터 구성을 보고 바꾸는 엔드포인트를 등록한다
+	if _, ok := s.Log.(clusterLog); ok {
+		cluster := func(h http.HandlerFunc) http.HandlerFunc {
+			return s.authorize(clusterAction, s.forwardToLeader(h))
+		}
+		r.HandleFunc("/cluster", consumer(s.handleCluster)).Methods("GET")
+		r.HandleFunc("/cluster/join", cluster(s.handleJoin)).Methods("POST")
+		r.HandleFunc("/cluster/leave", cluster(s.handleLeave)).Methods("POST")
+	}
+	if s.membership != nil {
+		r.HandleFunc("/members", consumer(s.handleMembers)).Methods("GET")
+	}
+	if s.webhooks != nil {
+		subscriber := func(h http.HandlerFunc) http.HandlerFunc {
+			return guard(subscribeAction, o.produceLimiter, o.produceTimeoutFor, h)
+		}
+		r.HandleFunc("/subscriptions", subscriber(s.handleSubscribe)).Methods("POST")
+		r.HandleFunc("/subscriptions", consumer(s.handleListSubscriptions)).Methods("GET")
+		r.HandleFunc("/subscriptions/{id}", subscriber(s.handleUnsubscribe)).Methods("DELETE")
+	}
+	if s.deadLetters != nil {
+		r.HandleFunc("/deadletter", consumer(s.handleDeadLetters)).Methods("GET")
+	}
+}
+
+// NewHTTPServerWithLog는 주어진 로그 백엔드를 사용하는 서버를 만든다.
+// 여러 서버가 같은 Log를 공유하거나 영속 Log, 테스트용 CommitLog를 넘길 때 사용하고,
+// NewHTTPServer에 WithLog(log)를 넘긴 것과 같다.
+func NewHTTPServerWithLog(addr string, log CommitLog, opts ...Option) *http.Server {
+	// 호출자의 opts 슬라이스를 덮어쓰지 않도록 용량을 잘라서 추가한다
+	return NewHTTPServer(addr, append(opts[:len(opts):len(opts)], WithLog(log))...)
 }
 
 // 서버는 로그를 참조하고, 참조하는 로그를 핸들러에 전달한다.
@@ -32,21 +288,244 @@ func NewHTTPServer(addr string) *http.Server {
 // ConsumeResponse는 오프셋에 위치하는 레코드를 보내준다.
 
 type httpServer struct {
-	Log *Log // Log 구조체 포인터
+	Log CommitLog // 로그 백엔드, 기본값은 메모리 Log
+
+	maxRecordBytes int
+	metrics        *metrics
+	authorizer     Authorizer
+	idempotency    *idempotencyCache
+	groups         *groupOffsets
+	topics         *TopicManager
+	tracer         trace.Tracer
+	membership     *Membership
+	appendQueue    *appendQueue
+	appendPool     *appendPool // WithAppendWorkers를 주지 않으면 nil
+	webhooks       *webhooks   // WithWebhooks를 켜지 않으면 nil
+	deadLetters    *Log        // WithDeadLetter를 주지 않으면 nil
+	backuper       Backuper    // WithBackup을 주지 않으면 nil
+
+	// leaderRedirect가 false이면 팔로워가 받은 쓰기 요청을 forwardTransport로 리더에게 전달한다
+	leaderRedirect   bool
+	forwardTransport http.RoundTripper
+
+	// maxConsumeOffsets가 0보다 크면 consume-multi 요청의 오프셋 수를 제한한다
+	maxConsumeOffsets int
+
+	// pathPrefix는 WithPathPrefix로 정한 접두사이고, apiBase가 Location 헤더에 붙인다
+	pathPrefix string
+
+	// auditLogger가 있으면 produce, consume 요청마다 감사 이벤트를 남기고, 실패하면 logger에 경고를 남긴다
+	auditLogger AuditLogger
+	logger      *slog.Logger
+
+	// ready는 Log 백엔드가 초기화되고 시작할 때의 재적용까지 마치면 true가 된다
+	ready atomic.Bool
+}
+
+func newHTTPServer(o options) (*httpServer, error) { // *httpServer means that the function returns a pointer to an httpServer
+	log := o.log
+	if log == nil {
+		log = NewLog() // Log 구조체 포인터를 생성
+	}
+	if o.maxRecords > 0 {
+		if l, ok := log.(interface{ SetMaxRecords(uint64) }); ok {
+			l.SetMaxRecords(o.maxRecords)
+		} else {
+			o.logger.Warn("log backend does not support max records")
+		}
+	}
+	if l, ok := log.(*Log); ok {
+		logRecovery(o.logger, l)
+	}
+	if o.fsync != nil {
+		if l, ok := log.(interface{ SetFsync(FsyncPolicy) }); ok {
+			l.SetFsync(*o.fsync)
+		} else {
+			o.logger.Warn("log backend does not support fsync policy")
+		}
+	}
+	if o.storeCompression != nil {
+		if l, ok := log.(interface{ SetCompression(Codec) error }); ok {
+			if err := l.SetCompression(*o.storeCompression); err != nil {
+				return nil, err
+			}
+		} else {
+			o.logger.Warn("log backend does not support store compression")
+		}
+	}
+	if o.encryptionKey != nil {
+		if l, ok := log.(interface{ SetEncryptionKey([]byte) error }); ok {
+			if err := l.SetEncryptionKey(o.encryptionKey); err != nil {
+				return nil, err
+			}
+		} else {
+			o.logger.Warn("log backend does not support encryption")
+		}
+	}
+	if o.readOnly {
+		// SetReadOnly가 없는 백엔드는 Append가 ErrReadOnly를 반환하도록 감싼다
+		if l, ok := log.(interface{ SetReadOnly(bool) }); ok {
+			l.SetReadOnly(true)
+		} else {
+			log = readOnlyLog{log}
+		}
+	}
+	groups, err := newGroupOffsets(groupOffsetsPath(log))
+	if err != nil {
+		return nil, err
+	}
+	// 데드레터는 웹훅만 남기므로 웹훅이 꺼져있으면 데드레터 로그와 GET /deadletter를 만들지 않는다
+	var deadLetters *Log
+	if o.webhooks && o.deadLetterAttempts > 0 {
+		if deadLetters, err = newDeadLetterLog(log); err != nil {
+			return nil, err
+		}
+	}
+	var hooks *webhooks
+	if o.webhooks {
+		// 데드레터가 없을 때 nil *Log가 nil이 아닌 CommitLog가 되지 않게 한다
+		var dl CommitLog
+		if deadLetters != nil {
+			dl = deadLetters
+		}
+		if hooks, err = newWebhooks(log, webhooksPath(log), dl, o.deadLetterAttempts, o.logger); err != nil {
+			if deadLetters != nil {
+				deadLetters.Close()
+			}
+			return nil, err
+		}
+	}
+	// 토픽 Log는 기본 Log와 같은 세그먼트 설정과 레코드 수 제한, fsync 정책, 읽기 전용 설정을 사용한다
+	var config Config
+	if l, ok := log.(*Log); ok {
+		config = l.Config
+	} else {
+		if o.storeCompression != nil {
+			config.Segment.Compression = *o.storeCompression
+		}
+		config.Segment.EncryptionKey = o.encryptionKey
+	}
+	topics, err := newTopicManager(topicsDir(log), config, func(l *Log) {
+		logRecovery(o.logger, l)
+		if o.maxRecords > 0 {
+			l.SetMaxRecords(o.maxRecords)
+		}
+		if o.fsync != nil {
+			l.SetFsync(*o.fsync)
+		}
+		l.SetReadOnly(o.readOnly)
+	})
+	if err != nil {
+		if hooks != nil {
+			hooks.Close()
+		}
+		if deadLetters != nil {
+			deadLetters.Close()
+		}
+		return nil, err
+	}
+	tp := o.tracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	s := &httpServer{
+		Log:            log,
+		tracer:         tp.Tracer(tracerName),
+		maxRecordBytes: o.maxRecordBytes,
+		metrics:        newMetrics(),
+		authorizer:     o.authorizer,
+		idempotency:    newIdempotencyCache(o.idempotencyCacheSize, o.idempotencyTTL),
+		groups:         groups,
+		topics:         topics,
+		membership:     o.membership,
+		appendQueue:    newAppendQueue(o.maxInFlightAppends),
+		appendPool:     newAppendPool(o.appendWorkers),
+		webhooks:       hooks,
+		deadLetters:    deadLetters,
+		backuper:       o.backuper,
+
+		leaderRedirect:   o.leaderRedirect,
+		forwardTransport: o.forwardTransport,
+
+		maxConsumeOffsets: o.maxConsumeOffsets,
+
+		pathPrefix: cleanPathPrefix(o.pathPrefix),
+
+		auditLogger: o.auditLogger,
+		logger:      o.logger,
+	}
+	if s.maxConsumeOffsets == 0 {
+		s.maxConsumeOffsets = defaultMaxConsumeOffsets
+	}
+	s.metrics.observeAppendQueue(s.appendQueue)
+	s.metrics.observeAppendPool(s.appendPool)
+	s.metrics.observeLogSize(s.Log)
+	// 아직 재적용 중인 백엔드는 isReady가 처음 준비된 것을 확인할 때 true가 된다
+	s.ready.Store(logReady(log))
+	return s, nil
 }
 
-func newHTTPServer() *httpServer { // *httpServer means that the function returns a pointer to an httpServer
-	return &httpServer{
-		Log: NewLog(), // Log 구조체 포인터를 생성
+// cleanPathPrefix는 api/proglog/나 /api/proglog처럼 준 접두사를 /api/proglog 형태로 맞춘다. /만 주면 접두사가 없는 것이다.
+func cleanPathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
 	}
+	return "/" + prefix
 }
 
+// checkRecordSize는 레코드 값이 maxRecordBytes를 넘는지 확인한다.
+func (s *httpServer) checkRecordSize(record Record) error {
+	if s.maxRecordBytes > 0 && len(record.Value) > s.maxRecordBytes {
+		return ErrRecordTooLarge
+	}
+	return nil
+}
+
+// maxProduceBodyBytes는 produce 요청 바디의 최대 크기를 리턴한다.
+// 레코드 값은 JSON에서 base64로 인코딩되므로 그만큼 늘어난 크기에 나머지 필드를 위한 여유를 더한다.
+// 바디 크기는 대략적인 상한일 뿐이고 정확한 검사는 디코딩한 뒤 checkRecordSize가 한다.
+func (s *httpServer) maxProduceBodyBytes() int64 {
+	if s.maxRecordBytes <= 0 {
+		return 0
+	}
+	return int64(base64.StdEncoding.EncodedLen(s.maxRecordBytes)) + produceBodyOverhead
+}
+
+const produceBodyOverhead = 1024
+
+// 재시도한 produce 요청을 구분하기 위해 클라이언트가 보내는 헤더
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// HEAD로 consume 할 때 레코드 값의 바이트 수를 알려주는 헤더
+const recordSizeHeader = "X-Record-Size"
+
+var ErrRecordTooLarge = fmt.Errorf("record too large")
+
 type ProduceRequest struct {
 	Record Record `json:"record"`
+	// ExpectedOffset이 있으면 로그의 다음 오프셋이 이 값일 때만 레코드를 추가하고, 다르면 409로 실제 다음 오프셋을 알려준다.
+	// JSON 요청에서만 쓸 수 있다.
+	ExpectedOffset *uint64 `json:"expectedOffset,omitempty"`
 }
 
 type ProduceResponse struct {
 	Offset uint64 `json:"offset"`
+	// Partition은 토픽 경로로 추가한 레코드의 파티션 번호이고, 0이면 생략된다.
+	// 오프셋은 파티션마다 따로 매겨지므로 레코드를 다시 읽을 때 함께 지정해야 한다.
+	Partition int `json:"partition,omitempty"`
+	// Error는 produce 배열의 일부만 추가되어 207로 응답할 때 추가하지 못한 원소에만 있고, 그 원소의 Offset은 의미가 없다.
+	Error *ErrorDetail `json:"error,omitempty"`
+}
+
+// ProduceBatchRequest는 한 번에 추가할 레코드들을 담고,
+// ProduceBatchResponse는 각 레코드에 할당된 오프셋을 같은 순서로 담는다.
+type ProduceBatchRequest struct {
+	Records []Record `json:"records"`
+}
+
+type ProduceBatchResponse struct {
+	Offsets []uint64 `json:"offsets"`
 }
 
 type ConsumeRequest struct {
@@ -57,42 +536,202 @@ type ConsumeResponse struct {
 	Record Record `json:"record"`
 }
 
+// ConsumeRangeRequest는 읽기 시작할 오프셋과 최대 레코드 수를 담고,
+// ConsumeRangeResponse는 읽은 레코드들과 다음에 읽을 오프셋을 담는다.
+// MaxRecords가 0이면 defaultMaxRangeRecords개까지 읽는다.
+// MaxBytes가 있으면 레코드를 JSON으로 인코딩한 크기의 합이 그 값을 넘기 전에 멈춘다.
+// 첫 레코드 하나가 MaxBytes보다 커도 그 레코드는 보내므로 클라이언트는 계속 진행할 수 있다.
+type ConsumeRangeRequest struct {
+	Offset     uint64 `json:"offset"`
+	MaxRecords uint32 `json:"maxRecords"`
+	MaxBytes   uint64 `json:"maxBytes,omitempty"`
+}
+
+type ConsumeRangeResponse struct {
+	Records    []Record `json:"records"`
+	NextOffset uint64   `json:"nextOffset"`
+}
+
+const defaultMaxRangeRecords = 100
+
 // produce Handler의 3 단계 구현
 // 요청을 구조체로 디코딩하고,
 // 로그에 추가한 다음
 // 오프셋을 구조체에 담아 인코딩하여 응답
 
 func (s *httpServer) handleProduce(w http.ResponseWriter, r *http.Request) {
+	defer s.metrics.observe("produce", time.Now())
+
+	// NDJSON 바디는 bulk 핸들러가 한 줄씩 처리
+	if hasMediaType(r.Header.Get("Content-Type"), contentTypeNDJSON) {
+		s.handleBulk(w, r)
+		return
+	}
+	// JSON 배열 바디는 원소마다 ProduceRequest로 추가한다. 레코드 하나의 바디 제한을 걸기 전에 첫 바이트를 본다
+	if !hasMediaType(r.Header.Get("Content-Type"), contentTypeProtobuf) && peekJSONArray(r) {
+		s.handleProduceArray(w, r)
+		return
+	}
 
 	// 요청을 구조체로 디코딩
 	// 요청의 바디를 읽어서 ProduceRequest 구조체로 디코딩
 	// 디코딩에 실패하면 400 에러를 반환
 	// 디코딩에 성공하면 로그에 추가하고 오프셋을 구조체에 담아 인코딩하여 응답
-	var req ProduceRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	// maxRecordBytes가 있으면 바디를 그 이상 읽지 않고 413 에러를 반환
+	if limit := s.maxProduceBodyBytes(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	req := getProduceRequest()
+	defer putProduceRequest(req)
+	err := decodeRequest(r, req)
+	// 서버 전체의 바디 제한에 걸렸으면 httpError가 request_too_large로 응답한다
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) && maxBytesErr.Limit == s.maxProduceBodyBytes() {
+		s.httpError(w, ErrRecordTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	// 레코드 크기 확인
+	// 레코드가 maxRecordBytes보다 크면 413 에러를 반환
+	if err := s.checkRecordSize(req.Record); err != nil {
+		s.httpError(w, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// 토픽 경로라면 레코드를 추가할 파티션을 정한다
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	log, partition := s.produceTarget(r, req.Record, idempotencyKey)
+
+	// Idempotency-Key 확인
+	// 최근에 같은 키로 추가한 레코드가 있으면 다시 추가하지 않고 그 오프셋으로 응답
+	var entry *idempotencyEntry
+	if key := idempotencyKey; key != "" {
+		var off uint64
+		var seen bool
+		// 파티션마다 오프셋이 따로 매겨지므로 키는 토픽과 파티션별로 구분한다
+		if topic := mux.Vars(r)["topic"]; topic != "" {
+			key = fmt.Sprintf("%s/%d/%s", topic, partition, key)
+		}
+		entry, off, seen = s.idempotency.reserve(key)
+		if seen {
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Header().Set("Location", s.consumeLocation(r, partition, off))
+			err = encodeResponse(w, r, http.StatusCreated, ProduceResponse{Offset: off, Partition: partition})
+			if err != nil {
+				s.httpError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
 	// 로그에 추가
 	// ProduceRequest 구조체의 Record 필드를 로그에 추가
 	// 추가에 실패하면 500 에러를 반환
 	// 추가에 성공하면 오프셋을 ProduceResponse 구조체에 담아 인코딩
-	off, err := s.Log.Append(req.Record)
+	ctx, span := s.tracer.Start(r.Context(), "log.append", trace.WithAttributes(
+		attribute.Int("record.size", len(req.Record.Value)),
+		attribute.Int("record.partition", partition),
+	))
+	off, err := s.appendPool.append(ctx, log, req.ExpectedOffset, req.Record)
+	endSpan(span, err, attribute.Int64("record.offset", int64(off)))
+	if entry != nil {
+		s.idempotency.complete(entry, off, err == nil)
+	}
+	if code, ok := contextErrorStatus(err); ok {
+		s.httpError(w, err, code)
+		return
+	}
+	if err == ErrReadOnly {
+		s.httpError(w, err, http.StatusMethodNotAllowed)
+		return
+	}
+	if err == ErrNotLeader {
+		s.notLeader(w, r)
+		return
+	}
+	if err == ErrOffsetMismatch {
+		s.offsetMismatch(w, *req.ExpectedOffset, off)
+		return
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		s.httpError(w, err, http.StatusNotImplemented)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.httpError(w, err, http.StatusInternalServerError)
 		return
 	}
+	s.metrics.recordsAppended.Inc()
+	auditOffset(r, off)
 
 	// 오프셋을 구조체에 담아 인코딩
 	// ProduceResponse 구조체를 인코딩
 	// 인코딩에 실패하면 500 에러를 반환
-	// 인코딩에 성공하면 응답
-	res := ProduceResponse{Offset: off}
+	// 인코딩에 성공하면 201 Created와 함께 저장한 레코드를 읽을 수 있는 위치를 Location 헤더로 응답
+	res := ProduceResponse{Offset: off, Partition: partition}
+	w.Header().Set("Location", s.consumeLocation(r, partition, off))
+	err = encodeResponse(w, r, http.StatusCreated, res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// offsetMismatch는 ExpectedOffset이 맞지 않은 produce 요청에 409와 함께 실제 다음 오프셋을 응답한다.
+// 클라이언트는 next까지 읽어서 상태를 맞춘 뒤 ExpectedOffset을 next로 바꿔서 다시 보내면 된다.
+func (s *httpServer) offsetMismatch(w http.ResponseWriter, expected, next uint64) {
+	s.metrics.errors.WithLabelValues(strconv.Itoa(http.StatusConflict)).Inc()
+	writeErrorDetail(w, http.StatusConflict, ErrorDetail{
+		Code:       errorCode(ErrOffsetMismatch, http.StatusConflict),
+		Message:    fmt.Sprintf("%v: expected %d, next offset is %d", ErrOffsetMismatch, expected, next),
+		NextOffset: &next,
+	})
+}
+
+// produce batch 핸들러는 여러 레코드를 한 번의 락 획득으로 로그에 추가한다.
+// 중간에 추가가 실패하면 500 에러를 반환하는데, append-only 로그이므로
+// 실패 전에 추가된 레코드는 로그에 그대로 남는다.
+func (s *httpServer) handleProduceBatch(w http.ResponseWriter, r *http.Request) {
+	var req ProduceBatchRequest
+	err := decodeJSON(r.Body, &req)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	for _, record := range req.Records {
+		if err := s.checkRecordSize(record); err != nil {
+			s.httpError(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	offsets, err := appendBatch(s.logFor(r), req.Records)
+	s.metrics.recordsAppended.Add(float64(len(offsets)))
+	if len(offsets) > 0 {
+		auditOffset(r, offsets[0])
+	}
+	if err == ErrReadOnly {
+		s.httpError(w, err, http.StatusMethodNotAllowed)
+		return
+	}
+	if err == ErrNotLeader && len(offsets) == 0 {
+		s.notLeader(w, r)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := ProduceBatchResponse{Offsets: offsets}
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.httpError(w, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -102,29 +741,249 @@ func (s *httpServer) handleProduce(w http.ResponseWriter, r *http.Request) {
 // 이 핸들러는 좀 더 많은 에러 체크를 하여 정확한 상태 코드를 클라이언트에 제공한다.
 // 서버가 요청을 핸들링할 수 없다는 에러도 있고,
 // 클라이언트가 요청한 레코드가 존재하지 않는다는 에러도 있다.
+// ?wait=5s처럼 wait 쿼리 파라미터를 주면 레코드가 추가될 때까지 최대 그 시간만큼 기다린다(롱 폴링).
+// HEAD 요청은 레코드를 보내지 않고 오프셋이 있는지만 알려준다. 있으면 200과 함께 GET 응답의 Content-Length와
+// 레코드 값의 크기인 X-Record-Size를, 없으면 404를 바디 없이 응답한다.
+// 응답에는 레코드의 ETag가 있고, If-None-Match가 맞으면 레코드 없이 304를 응답한다.
 func (s *httpServer) handleConsume(w http.ResponseWriter, r *http.Request) {
-	var req ConsumeRequest
-	err := json.NewDecoder(r.Body).Decode(&req) // & means that the function returns a pointer to an httpServer
+	defer s.metrics.observe("consume", time.Now())
+	req := getConsumeRequest()
+	defer putConsumeRequest(req)
+	// GET /?offset=42처럼 offset 쿼리 파라미터가 있으면 요청 바디보다 우선하고,
+	// 없으면 기존 클라이언트를 위해 바디의 offset을 사용한다. 둘 다 없으면 오프셋 0부터 읽는다
+	off, ok, err := offsetParam(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if ok {
+		req.Offset = off
+	} else if err := decodeRequest(r, req); err != nil && err != ErrEmptyBody {
+		s.httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	record, err := s.Log.Read(req.Offset)
-	if err == ErrOffsetNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	// wait 쿼리 파라미터가 있으면 레코드가 아직 없을 때 그 시간만큼 추가되기를 기다린다
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			s.httpError(w, fmt.Errorf("invalid wait duration: %s", v), http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+
+	auditOffset(r, req.Offset)
+	ctx, span := s.tracer.Start(r.Context(), "log.read", trace.WithAttributes(
+		attribute.Int64("record.offset", int64(req.Offset)),
+	))
+	record, err := s.readWait(ctx, s.logFor(r), req.Offset, wait)
+	endSpan(span, err, attribute.Int("record.size", len(record.Value)))
+	if code, ok := contextErrorStatus(err); ok {
+		s.httpError(w, err, code)
+		return
+	}
+	if err == ErrOffsetNotFound || err == ErrOffsetOutOfRange || err == ErrOffsetCompacted || err == ErrRecordExpired {
+		s.httpError(w, err, http.StatusNotFound)
 		return
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// 같은 오프셋의 레코드는 바뀌지 않으므로 클라이언트나 프록시가 캐시한 레코드와 같으면 다시 보내지 않는다
+	etag := recordETag(record)
+	w.Header().Set("ETag", etag)
+	// Accept에 따라 JSON이나 protobuf로 응답하므로 캐시가 인코딩을 섞지 않게 한다
+	w.Header().Add("Vary", "Accept")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
+	if r.Method == http.MethodHead {
+		w.Header().Set(recordSizeHeader, strconv.Itoa(len(record.Value)))
+	} else {
+		s.metrics.recordsRead.Inc()
+	}
+
 	res := ConsumeResponse{Record: record}
+	err = encodeResponse(w, r, http.StatusOK, res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// encodedSize는 레코드 하나가 응답의 records 배열에서 차지하는 바이트 수다. 레코드 사이의 쉼표도 센다.
+func encodedSize(record Record) (uint64, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(b)) + 1, nil
+}
+
+// consume range 핸들러는 Offset부터 최대 MaxRecords개의 레코드를 읽는다.
+// 로그의 끝에 도달하면 에러 없이 멈추고, 다음에 요청할 오프셋을 NextOffset으로 알려준다.
+// 시작 오프셋부터 없는 경우에는 consume 핸들러와 같이 404 에러를 반환한다.
+func (s *httpServer) handleConsumeRange(w http.ResponseWriter, r *http.Request) {
+	var req ConsumeRangeRequest
+	// 바디가 없으면 오프셋 0부터 읽는다
+	err := decodeJSON(r.Body, &req)
+	if err != nil && err != ErrEmptyBody {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.MaxRecords == 0 {
+		req.MaxRecords = defaultMaxRangeRecords
+	}
+
+	auditOffset(r, req.Offset)
+	it, err := readFrom(s.logFor(r), req.Offset)
+	if err == ErrOffsetOutOfRange {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	res := ConsumeRangeResponse{Records: []Record{}}
+	var size uint64
+	full := false
+	for len(res.Records) < int(req.MaxRecords) {
+		record, ok := it.Next()
+		if !ok {
+			break
+		}
+		if req.MaxBytes > 0 {
+			n, err := encodedSize(record)
+			if err != nil {
+				s.httpError(w, err, http.StatusInternalServerError)
+				return
+			}
+			// 이미 읽은 레코드는 응답에 넣지 않으므로 다음 요청이 그 레코드부터 읽게 한다
+			if len(res.Records) > 0 && size+n > req.MaxBytes {
+				res.NextOffset = record.Offset
+				full = true
+				break
+			}
+			size += n
+		}
+		res.Records = append(res.Records, record)
+		s.metrics.recordsRead.Inc()
+	}
+	// 읽는 도중에 보존 정책으로 삭제된 경우에도 시작 오프셋이 없을 때와 같이 404 에러를 반환한다
+	if err := it.Err(); err == ErrOffsetOutOfRange {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	// 컴팩션으로 지워진 오프셋은 건너뛴다
+	if !full {
+		res.NextOffset = it.Offset()
+	}
+	if res.NextOffset == req.Offset {
+		s.httpError(w, ErrOffsetNotFound, http.StatusNotFound)
+		return
+	}
+
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// OffsetsResponse는 로그에서 읽을 수 있는 오프셋의 범위를 담는다.
+// 로그가 비어있으면 Lowest와 Highest는 다음에 추가될 레코드의 오프셋으로 같고 Count는 0이다.
+// 컨슈머는 Lowest부터 읽기 시작하면 된다.
+type OffsetsResponse struct {
+	Lowest  uint64 `json:"lowest"`
+	Highest uint64 `json:"highest"`
+	Count   uint64 `json:"count"`
+}
+
+// offsets 핸들러는 컨슈머가 유효한 위치부터 읽을 수 있도록 로그의 오프셋 범위를 알려준다.
+func (s *httpServer) handleOffsets(w http.ResponseWriter, r *http.Request) {
+	lowest, highest, count := bounds(s.logFor(r))
+	res := OffsetsResponse{Lowest: lowest, Highest: highest, Count: count}
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// StatsResponse는 오프셋 범위와 함께 로그가 차지하는 크기를 담는다.
+// SizeBytes는 디스크의 세그먼트 파일 크기이고, 메모리 Log는 저장한 레코드 크기, 크기를 알려주지 않는 백엔드에서는 빠진다.
+type StatsResponse struct {
+	OffsetsResponse
+	SizeBytes *uint64 `json:"sizeBytes,omitempty"`
+}
+
+// stats 핸들러는 용량 계획과 보존 정책 조정을 위해 로그의 오프셋 범위, 레코드 수, 크기를 알려준다.
+func (s *httpServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	log := s.logFor(r)
+	lowest, highest, count := bounds(log)
+	res := StatsResponse{OffsetsResponse: OffsetsResponse{Lowest: lowest, Highest: highest, Count: count}}
+	if n, ok := sizeBytes(log); ok {
+		res.SizeBytes = &n
+	}
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// truncate 핸들러는 로그를 비우고 204를 반환한다.
+// 영속 Log라면 디스크의 store 파일도 함께 삭제된다.
+func (s *httpServer) handleTruncate(w http.ResponseWriter, r *http.Request) {
+	err := reset(s.logFor(r))
+	if err == ErrReadOnly {
+		s.httpError(w, err, http.StatusMethodNotAllowed)
+		return
+	}
+	if err == errors.ErrUnsupported {
+		s.httpError(w, err, http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// consume key 핸들러는 경로의 키를 가진 가장 최근 레코드를 응답하고, 없으면 404 에러를 반환한다.
+func (s *httpServer) handleConsumeKey(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	record, err := readKey(s.logFor(r), []byte(key))
+	if err == ErrKeyNotFound {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err == errors.ErrUnsupported {
+		s.httpError(w, err, http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.metrics.recordsRead.Inc()
+
+	res := ConsumeResponse{Record: record}
+	err = encodeResponse(w, r, http.StatusOK, res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
 		return
 	}
 }
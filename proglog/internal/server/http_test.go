@@ -0,0 +1,562 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve는 h에 요청을 보내고 응답을 기록한다. body가 비어있으면 바디 없이 보낸다.
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, r))
+	return w
+}
+
+// errorCodeOf는 JSON 에러 응답의 code를 리턴한다.
+func errorCodeOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var res struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error body %q: %v", w.Body, err)
+	}
+	return res.Error.Code
+}
+
+func TestMethodNotAllowedAndNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		w := serve(h, method, "/", "")
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s /: got %d, want %d", method, w.Code, http.StatusMethodNotAllowed)
+		}
+		if got := w.Header().Get("Allow"); got != "GET, HEAD, POST" {
+			t.Fatalf("%s /: Allow is %q, want %q", method, got, "GET, HEAD, POST")
+		}
+		if code := errorCodeOf(t, w); code != "method_not_allowed" {
+			t.Fatalf("%s /: error code %q", method, code)
+		}
+	}
+
+	w := serve(h, http.MethodGet, "/no/such/path", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("GET /no/such/path: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if code := errorCodeOf(t, w); code != "not_found" {
+		t.Fatalf("GET /no/such/path: error code %q", code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentTypeJSON) {
+		t.Fatalf("GET /no/such/path: Content-Type %q", ct)
+	}
+}
+
+// produceBody는 value를 레코드 값으로 담은 produce 요청 바디다.
+func produceBody(value []byte) string {
+	b, _ := json.Marshal(ProduceRequest{Record: Record{Value: value}})
+	return string(b)
+}
+
+func TestMaxRecordBytes(t *testing.T) {
+	const limit = 1024
+	log := NewLog()
+	h := newTestHandler(t, WithLog(log), WithMaxRecordBytes(limit))
+
+	w := serve(h, http.MethodPost, "/", produceBody(make([]byte, limit)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("record of exactly %d bytes: got %d: %s", limit, w.Code, w.Body)
+	}
+	w = serve(h, http.MethodPost, "/", produceBody(make([]byte, limit+1)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("record of %d bytes: got %d, want %d", limit+1, w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if code := errorCodeOf(t, w); code != "record_too_large" {
+		t.Fatalf("record of %d bytes: error code %q", limit+1, code)
+	}
+	// 레코드가 아니라 바디가 큰 요청은 다 읽기 전에 MaxBytesReader가 끊는다
+	w = serve(h, http.MethodPost, "/", `{"record":{"value":""},"pad":"`+strings.Repeat("x", 1<<20)+`"}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("1MiB body: got %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if _, _, count := log.Bounds(); count != 1 {
+		t.Fatalf("log has %d records, want only the one under the limit", count)
+	}
+}
+
+func TestProduceCreatedLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		target   string
+		location string
+	}{
+		{"root", nil, "/", "/consume?offset=1"},
+		{"produce", nil, "/produce", "/consume?offset=1"},
+		{"v1", nil, "/v1/produce", "/v1/consume?offset=1"},
+		{"prefix", []Option{WithPathPrefix("/api")}, "/api/", "/api/consume?offset=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.opts...)
+			serve(h, http.MethodPost, tt.target, produceBody([]byte("first")))
+			w := serve(h, http.MethodPost, tt.target, produceBody([]byte("second")))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("got %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Fatalf("Location is %q, want %q", got, tt.location)
+			}
+			var res ProduceResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Offset != 1 {
+				t.Fatalf("body %s: %v", w.Body, err)
+			}
+
+			// Location을 그대로 따라가면 방금 추가한 레코드를 읽는다
+			w = serve(h, http.MethodGet, tt.location, "")
+			var consumed ConsumeResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &consumed); err != nil || string(consumed.Record.Value) != "second" {
+				t.Fatalf("GET %s: got %d %s: %v", tt.location, w.Code, w.Body, err)
+			}
+		})
+	}
+}
+
+// panicLog는 panicOffset을 읽으면 패닉하는 Log다.
+type panicLog struct {
+	*Log
+	panicOffset uint64
+}
+
+func (l panicLog) Read(off uint64) (Record, error) {
+	return l.ReadContext(context.Background(), off)
+}
+
+func (l panicLog) ReadContext(ctx context.Context, off uint64) (Record, error) {
+	if off == l.panicOffset {
+		panic("boom")
+	}
+	return l.Log.ReadContext(ctx, off)
+}
+
+func TestRecoverPanics(t *testing.T) {
+	var logs bytes.Buffer
+	log := NewLog()
+	log.Append(Record{Value: []byte("ok")})
+	log.Append(Record{Value: []byte("panics")})
+	srv, err := NewHTTPServerE(":0",
+		WithLog(panicLog{Log: log, panicOffset: 1}),
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/consume?offset=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("panicking handler: got %d, want %d", res.StatusCode, http.StatusInternalServerError)
+	}
+	if !strings.Contains(logs.String(), "panic recovered") || !strings.Contains(logs.String(), "goroutine") {
+		t.Fatalf("panic was not logged with a stack: %s", logs.String())
+	}
+
+	// 패닉한 뒤에도 서버는 계속 요청을 처리한다
+	for i := 0; i < 3; i++ {
+		res, err := http.Get(ts.URL + "/consume?offset=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("request %d after the panic: got %d", i, res.StatusCode)
+		}
+	}
+}
+
+// 같은 Log를 받은 두 서버는 한쪽에서 추가한 레코드를 다른 쪽에서 읽는다.
+func TestNewHTTPServerWithLogShared(t *testing.T) {
+	log := NewLog()
+	a := NewHTTPServerWithLog(":0", log, WithLogger(slog.New(slog.DiscardHandler)))
+	b := NewHTTPServerWithLog(":0", log, WithLogger(slog.New(slog.DiscardHandler)))
+
+	w := serve(a.Handler, http.MethodPost, "/", produceBody([]byte("shared")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("produce through a: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(b.Handler, http.MethodGet, "/consume?offset=0", "")
+	var res ConsumeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || string(res.Record.Value) != "shared" {
+		t.Fatalf("consume through b: got %d %s: %v", w.Code, w.Body, err)
+	}
+	if _, _, count := log.Bounds(); count != 1 {
+		t.Fatalf("shared log has %d records, want 1", count)
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	log := NewLog()
+	large := bytes.Repeat([]byte("compressible "), 1000)
+	log.Append(Record{Value: large})
+	log.Append(Record{Value: []byte("tiny")})
+	h := newTestHandler(t, WithLog(log), WithCompression(1024))
+
+	get := func(offset, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/consume?offset="+offset, nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("0", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large response: Content-Encoding %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.Len() >= len(large) {
+		t.Fatalf("large response: %d compressed bytes for a %d byte record", w.Body.Len(), len(large))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ConsumeResponse
+	if err := json.NewDecoder(zr).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Record.Value, large) {
+		t.Fatal("decompressed record does not match")
+	}
+
+	// 작은 응답과 gzip을 받지 않는 클라이언트에게는 압축하지 않는다
+	for _, tt := range []struct{ offset, accept string }{{"1", "gzip"}, {"0", ""}, {"0", "gzip;q=0"}} {
+		w := get(tt.offset, tt.accept)
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("offset %s with Accept-Encoding %q: got Content-Encoding %q", tt.offset, tt.accept, w.Header().Get("Content-Encoding"))
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("offset %s with Accept-Encoding %q: %v", tt.offset, tt.accept, err)
+		}
+	}
+}
+
+func TestHeadConsume(t *testing.T) {
+	log := NewLog()
+	log.Append(Record{Value: []byte("hello")})
+	ts := httptest.NewServer(newTestHandler(t, WithLog(log)))
+	defer ts.Close()
+
+	get, err := http.Get(ts.URL + "/consume?offset=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	getBody, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+
+	res, err := http.Head(ts.URL + "/consume?offset=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD present offset: got %d", res.StatusCode)
+	}
+	if len(body) != 0 {
+		t.Fatalf("HEAD returned a %d byte body", len(body))
+	}
+	if res.ContentLength != int64(len(getBody)) {
+		t.Fatalf("HEAD Content-Length %d, GET body is %d bytes", res.ContentLength, len(getBody))
+	}
+	if got := res.Header.Get(recordSizeHeader); got != "5" {
+		t.Fatalf("%s is %q, want 5", recordSizeHeader, got)
+	}
+
+	res, err = http.Head(ts.URL + "/consume?offset=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound || len(body) != 0 {
+		t.Fatalf("HEAD absent offset: got %d with a %d byte body, want 404 with none", res.StatusCode, len(body))
+	}
+}
+
+func TestConsumeETag(t *testing.T) {
+	log := NewLog()
+	log.Append(Record{Value: []byte("a")})
+	log.Append(Record{Value: []byte("b")})
+	h := newTestHandler(t, WithLog(log))
+
+	get := func(offset, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/consume?offset="+offset, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w := get("0", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: got %d with ETag %q", w.Code, etag)
+	}
+	if other := get("1", "").Header().Get("ETag"); other == etag {
+		t.Fatalf("offsets 0 and 1 have the same ETag %q", etag)
+	}
+
+	for _, inm := range []string{etag, `"other", ` + etag, "*"} {
+		w := get("0", inm)
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("If-None-Match %s: got %d, want %d", inm, w.Code, http.StatusNotModified)
+		}
+		if w.Body.Len() != 0 {
+			t.Fatalf("If-None-Match %s: 304 has a body: %s", inm, w.Body)
+		}
+	}
+	w = get("0", `"not-the-etag"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != etag {
+		t.Fatalf("non-matching If-None-Match: got %d with ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+	// 다른 오프셋의 ETag로는 304가 되지 않는다
+	if w := get("1", etag); w.Code != http.StatusOK {
+		t.Fatalf("offset 1 with the ETag of offset 0: got %d", w.Code)
+	}
+}
+
+func TestHeaderAndBodyLimits(t *testing.T) {
+	const maxBody = 512
+	srv, err := NewHTTPServerE(":0",
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithMaxHeaderBytes(4096),
+		WithMaxBodyBytes(maxBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.Config = srv
+	ts.Start()
+	defer ts.Close()
+
+	// net/http는 MaxHeaderBytes에 여유를 조금 더 주므로 확실히 넘도록 보낸다
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/healthz", nil)
+	req.Header.Set("X-Big", strings.Repeat("x", 16<<10))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("oversized headers: got %d, want %d", res.StatusCode, http.StatusRequestHeaderFieldsTooLarge)
+	}
+
+	post := func(body io.Reader) *http.Response {
+		t.Helper()
+		res, err := http.Post(ts.URL+"/", contentTypeJSON, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return res
+	}
+	// 바디 크기가 딱 제한이면 받는다
+	body := produceBody(nil)
+	body = body[:len(body)-1] + `,"pad":"` + strings.Repeat("x", maxBody-len(body)-9) + `"}`
+	if len(body) != maxBody {
+		t.Fatalf("test body is %d bytes, want %d", len(body), maxBody)
+	}
+	if res := post(strings.NewReader(body)); res.StatusCode != http.StatusCreated {
+		t.Fatalf("body of exactly %d bytes: got %d", maxBody, res.StatusCode)
+	}
+	// Content-Length가 제한을 넘으면 바디를 읽지 않고, 길이를 모르는 바디는 제한을 넘는 순간 413이다
+	if res := post(strings.NewReader(body + " ")); res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body of %d bytes: got %d, want %d", maxBody+1, res.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+	if res := post(io.MultiReader(strings.NewReader(body), strings.NewReader(" "))); res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked body of %d bytes: got %d, want %d", maxBody+1, res.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	srv, err := NewHTTPServerE(":0", WithLogger(slog.New(slog.DiscardHandler)), WithH2C(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.Config = srv
+	ts.Start()
+	defer ts.Close()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	h2 := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	defer h2.CloseIdleConnections()
+	res, err := h2.Post(ts.URL+"/", contentTypeJSON, strings.NewReader(produceBody([]byte("over h2c"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.ProtoMajor != 2 || res.StatusCode != http.StatusCreated {
+		t.Fatalf("h2c produce: got %s %d, want HTTP/2.0 201", res.Proto, res.StatusCode)
+	}
+
+	// 같은 리스너가 HTTP/1.1도 계속 받는다
+	res, err = http.Get(ts.URL + "/consume?offset=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.ProtoMajor != 1 || res.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP/1.1 consume: got %s %d", res.Proto, res.StatusCode)
+	}
+}
+
+// produce 배열은 원소 수와 바디 크기를 디코딩하기 전에 제한하고, 제한에 걸리면 아무것도 추가하지 않는다.
+func TestProduceArrayLimits(t *testing.T) {
+	log := NewLog()
+	h := newTestHandler(t, WithLog(log), WithMaxRecordBytes(16))
+
+	elems := make([]string, maxProduceArrayRecords+1)
+	for i := range elems {
+		elems[i] = produceBody([]byte("a"))
+	}
+	w := serve(h, http.MethodPost, "/", "["+strings.Join(elems, ",")+"]")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("%d elements: got %d, want %d", len(elems), w.Code, http.StatusBadRequest)
+	}
+	if code := errorCodeOf(t, w); code != "invalid_produce_array" {
+		t.Fatalf("%d elements: error code %q", len(elems), code)
+	}
+
+	// 원소 하나의 값이 배열 바디 제한보다 크면 레코드 크기를 확인하기 전에 읽기를 멈춘다
+	limit := (&httpServer{maxRecordBytes: 16}).maxProduceBodyBytes() * maxProduceArrayRecords
+	huge := `[{"record":{"value":"` + strings.Repeat("A", int(limit)) + `"}}]`
+	w = serve(h, http.MethodPost, "/", huge)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("%d byte array: got %d, want %d", len(huge), w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if code := errorCodeOf(t, w); code != "request_too_large" {
+		t.Fatalf("%d byte array: error code %q", len(huge), code)
+	}
+
+	if _, err := log.Read(0); err != ErrOffsetNotFound {
+		t.Fatalf("read 0 after rejected arrays: got %v, want %v", err, ErrOffsetNotFound)
+	}
+	w = serve(h, http.MethodPost, "/", "["+strings.Join(elems[:maxProduceArrayRecords], ",")+"]")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("%d elements: got %d: %s", maxProduceArrayRecords, w.Code, w.Body)
+	}
+}
+
+// 토픽 경로의 produce 배열이 한 파티션에만 추가된 뒤에 실패하면 207로 원소마다 결과를 응답한다.
+func TestProduceArrayPartialWrite(t *testing.T) {
+	s, err := newHTTPServer(options{logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.topics.Close()
+	failing := NewLog()
+	failing.Close()
+	topic := &Topic{name: "events", partitions: []*Log{NewLog(), failing}}
+
+	// 키가 없는 레코드는 파티션을 돌아가면서 사용하므로 0, 1, 0번 파티션에 간다
+	body := "[" + produceBody([]byte("a")) + "," + produceBody([]byte("b")) + "," + produceBody([]byte("c")) + "]"
+	r := httptest.NewRequest(http.MethodPost, "/topics/events", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), topicRouteKey{}, topicRoute{topic: topic, partition: -1}))
+	w := httptest.NewRecorder()
+	s.handleProduceArray(w, r)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("got %d, want %d: %s", w.Code, http.StatusMultiStatus, w.Body)
+	}
+	var res []ProduceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d results, want 3", len(res))
+	}
+	for i, want := range []struct {
+		partition int
+		offset    uint64
+	}{{0, 0}, {1, 0}, {0, 1}} {
+		if res[i].Partition != want.partition {
+			t.Fatalf("element %d: partition %d, want %d", i, res[i].Partition, want.partition)
+		}
+		if want.partition == 1 {
+			if res[i].Error == nil || res[i].Error.Code != "log_closed" {
+				t.Fatalf("element %d: got error %+v, want log_closed", i, res[i].Error)
+			}
+			continue
+		}
+		if res[i].Error != nil || res[i].Offset != want.offset {
+			t.Fatalf("element %d: got %+v, want offset %d", i, res[i], want.offset)
+		}
+	}
+	if record, err := topic.partitions[0].Read(1); err != nil || string(record.Value) != "c" {
+		t.Fatalf("read partition 0 offset 1: got %q, %v", record.Value, err)
+	}
+}
+
+// stream은 응답을 시작하기 전에 오프셋을 확인해서 consume처럼 404로 응답한다.
+func TestStreamOffsetBounds(t *testing.T) {
+	log := NewLog()
+	for i := 0; i < 5; i++ {
+		if _, err := log.Append(Record{Value: []byte("a")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, WithLog(log))
+
+	for _, tt := range []struct {
+		offset string
+		code   string
+	}{{"1", "offset_out_of_range"}, {"6", "offset_not_found"}} {
+		w := serve(h, http.MethodGet, "/stream?offset="+tt.offset, "")
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("stream from %s: got %d, want %d", tt.offset, w.Code, http.StatusNotFound)
+		}
+		if code := errorCodeOf(t, w); code != tt.code {
+			t.Fatalf("stream from %s: error code %q, want %q", tt.offset, code, tt.code)
+		}
+	}
+
+	// 남아있는 레코드부터와 다음에 추가될 오프셋부터는 스트림을 시작한다
+	for _, offset := range []string{"2", "5"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream?offset="+offset, nil).WithContext(ctx))
+		cancel()
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("stream from %s: got %d %q", offset, w.Code, w.Header().Get("Content-Type"))
+		}
+		if want := map[string]int{"2": 3, "5": 0}[offset]; strings.Count(w.Body.String(), "data: ") != want {
+			t.Fatalf("stream from %s: got %q, want %d events", offset, w.Body, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdempotencyCacheSize = 10000
+	defaultIdempotencyTTL       = 10 * time.Minute
+)
+
+// idempotencyCache는 최근에 본 Idempotency-Key와 그 키로 추가한 레코드의 오프셋을 기억한다.
+// 키는 ttl이 지나거나 캐시가 size개를 넘어서 가장 오래된 키부터 밀려나면 잊혀지고,
+// 그 뒤에 같은 키로 다시 요청하면 레코드가 한 번 더 추가된다.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// idempotencyEntry는 키 하나의 상태다. done이 닫히기 전에는 첫 요청이 아직 추가 중이다.
+type idempotencyEntry struct {
+	key     string
+	offset  uint64
+	expires time.Time
+	done    chan struct{}
+	ok      bool
+}
+
+func newIdempotencyCache(size int, ttl time.Duration) *idempotencyCache {
+	if size <= 0 {
+		size = defaultIdempotencyCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// reserve는 key로 이미 추가된 레코드가 있으면 그 오프셋과 true를 리턴한다.
+// 없으면 key를 예약하고 entry를 리턴하는데, 호출한 쪽은 레코드를 추가한 뒤 반드시 complete를 호출해야 한다.
+// 같은 키로 동시에 들어온 요청은 첫 요청이 끝날 때까지 기다렸다가 그 결과를 사용한다.
+func (c *idempotencyCache) reserve(key string) (*idempotencyEntry, uint64, bool) {
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		if el, ok := c.entries[key]; ok {
+			e := el.Value.(*idempotencyEntry)
+			select {
+			case <-e.done:
+				if e.ok && now.Before(e.expires) {
+					c.mu.Unlock()
+					return nil, e.offset, true
+				}
+				c.remove(el)
+			default:
+				c.mu.Unlock()
+				<-e.done
+				continue
+			}
+		}
+
+		e := &idempotencyEntry{key: key, done: make(chan struct{})}
+		c.entries[key] = c.order.PushBack(e)
+		for c.order.Len() > c.size {
+			c.remove(c.order.Front())
+		}
+		c.mu.Unlock()
+		return e, 0, false
+	}
+}
+
+// complete는 예약한 키의 결과를 기록하고 기다리던 요청을 깨운다.
+// 추가에 실패했으면 ok를 false로 넘겨서 다음 요청이 다시 추가할 수 있게 한다.
+func (c *idempotencyCache) complete(e *idempotencyEntry, offset uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.offset = offset
+	e.ok = ok
+	e.expires = time.Now().Add(c.ttl)
+	close(e.done)
+	if !ok {
+		if el, found := c.entries[e.key]; found && el.Value == e {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *idempotencyCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*idempotencyEntry)
+	if c.entries[e.key] == el {
+		delete(c.entries, e.key)
+	}
+}
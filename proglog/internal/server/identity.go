@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+type subjectContextKey struct{}
+
+// SubjectFromContext는 mTLS로 검증된 클라이언트 인증서의 CommonName을 리턴한다.
+// 클라이언트 인증서가 없는 요청이면 false를 리턴한다.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectContextKey{}).(string)
+	return subject, ok
+}
+
+// withSubject는 ctx에 요청자의 이름을 담는다.
+func withSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectContextKey{}, subject)
+}
+
+// identifyClient는 검증된 클라이언트 인증서의 CommonName을 요청 컨텍스트에 담아서
+// 이후의 핸들러가 권한 확인에 사용할 수 있게 한다.
+func identifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			subject := r.TLS.VerifiedChains[0][0].Subject.CommonName
+			r = r.WithContext(withSubject(r.Context(), subject))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
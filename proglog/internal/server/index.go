@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// 인덱스 항목 하나는 세그먼트의 베이스 오프셋에 대한 상대 오프셋과 store 안의 위치로 이루어진다
+const (
+	offWidth = 4
+	posWidth = 8
+	entWidth = offWidth + posWidth
+)
+
+// 상대 오프셋이 offWidth 바이트에 들어가야 하므로 세그먼트 하나에 넣을 수 있는 최대 레코드 수
+const maxIndexEntries = math.MaxUint32
+
+// index는 세그먼트의 레코드마다 상대 오프셋과 store 안의 위치를 고정 크기 항목으로 저장하는 파일이다.
+// 세그먼트를 다시 열 때 store를 처음부터 읽지 않고 이 파일만 읽어서 레코드의 위치를 복원한다.
+// store보다 늦게 쓰이므로 크래시 후에는 store보다 짧을 수 있고, 그러면 모자란 부분만 store에서 읽어서 채운다.
+type index struct {
+	mu    sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	dirty bool
+}
+
+// openIndex는 인덱스 파일을 열거나 새로 만든다.
+func openIndex(path string) (*index, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &index{file: f, buf: bufio.NewWriter(f)}, nil
+}
+
+// entries는 인덱스 파일의 항목을 모두 읽는다. 마지막 항목이 끝까지 쓰이지 않았으면 그 항목은 버린다.
+func (i *index) entries() (offs []uint32, positions []uint64, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.buf.Flush(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := i.file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	b, err := io.ReadAll(i.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := len(b) / entWidth
+	offs = make([]uint32, 0, n)
+	positions = make([]uint64, 0, n)
+	for e := 0; e < n; e++ {
+		ent := b[e*entWidth : (e+1)*entWidth]
+		offs = append(offs, enc.Uint32(ent[:offWidth]))
+		positions = append(positions, enc.Uint64(ent[offWidth:]))
+	}
+	return offs, positions, nil
+}
+
+// Write는 항목 하나를 버퍼에 쓴다.
+func (i *index) Write(off uint32, pos uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var ent [entWidth]byte
+	enc.PutUint32(ent[:offWidth], off)
+	enc.PutUint64(ent[offWidth:], pos)
+	if _, err := i.buf.Write(ent[:]); err != nil {
+		return err
+	}
+	i.dirty = true
+	return nil
+}
+
+// reset은 인덱스 파일을 비우고 주어진 항목으로 다시 쓴다. 열 때 인덱스를 고쳐야 하는 경우에 사용한다.
+func (i *index) reset(base uint64, offsets, positions []uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.buf.Reset(i.file)
+	var b bytes.Buffer
+	var ent [entWidth]byte
+	for e := range offsets {
+		enc.PutUint32(ent[:offWidth], uint32(offsets[e]-base))
+		enc.PutUint64(ent[offWidth:], positions[e])
+		b.Write(ent[:])
+	}
+	if err := i.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := i.file.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return i.file.Sync()
+}
+
+// Flush는 버퍼에 남은 항목을 파일에 쓴다.
+func (i *index) Flush() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.buf.Flush()
+}
+
+// Sync는 버퍼를 파일에 쓰고 fsync 한다. 마지막 Sync 뒤에 쓴 항목이 없으면 아무 일도 하지 않는다.
+func (i *index) Sync() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+	if err := i.buf.Flush(); err != nil {
+		return err
+	}
+	if err := i.file.Sync(); err != nil {
+		return err
+	}
+	i.dirty = false
+	return nil
+}
+
+// Close는 버퍼를 파일에 쓰고 fsync 한 뒤 파일을 닫는다.
+func (i *index) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	err := i.buf.Flush()
+	if err == nil {
+		err = i.file.Sync()
+	}
+	if cerr := i.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Remove는 인덱스를 닫고 파일을 삭제한다.
+func (i *index) Remove() error {
+	if err := i.Close(); err != nil {
+		return err
+	}
+	return os.Remove(i.file.Name())
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+// RecordIterator는 오프셋 순서대로 레코드를 하나씩 돌려준다.
+// Next가 false를 리턴하면 로그의 끝에 도달했거나 에러가 난 것이므로 Err로 구분한다.
+// Offset은 다음에 읽을 오프셋이고, 컴팩션으로 지워지거나 만료된 오프셋은 건너뛴다.
+type RecordIterator interface {
+	Next() (Record, bool)
+	Offset() uint64
+	Err() error
+}
+
+// ReadFrom은 offset부터 ReadFrom을 호출한 시점의 마지막 레코드까지 읽는 이터레이터를 리턴한다.
+// 그 뒤에 추가된 레코드는 읽지 않으므로 계속 추가되는 로그에서도 이터레이터가 끝난다.
+// 읽기 락은 Next를 호출하는 동안에만 잡기 때문에 이터레이터를 오래 들고 있어도 Append를 막지 않는다.
+// offset이 이미 삭제되었으면 ErrOffsetOutOfRange를 리턴하고, 도중에 삭제되면 Err가 ErrOffsetOutOfRange가 된다.
+func (c *Log) ReadFrom(offset uint64) (RecordIterator, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, ErrLogClosed
+	}
+	if offset < c.lowest {
+		return nil, ErrOffsetOutOfRange
+	}
+	return &logIterator{log: c, next: offset, end: c.activeSegment.next()}, nil
+}
+
+type logIterator struct {
+	log       *Log
+	next, end uint64
+	err       error
+}
+
+func (it *logIterator) Next() (Record, bool) {
+	if it.err != nil || it.next >= it.end {
+		return Record{}, false
+	}
+	c := it.log
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		it.err = ErrLogClosed
+		return Record{}, false
+	}
+	if it.next < c.lowest {
+		it.err = ErrOffsetOutOfRange
+		return Record{}, false
+	}
+	now := time.Now()
+	for it.next < it.end {
+		s := c.segmentFor(it.next)
+		if s == nil {
+			it.next = it.end
+			break
+		}
+		s.mu.RLock()
+		i := sort.Search(len(s.offsets), func(i int) bool {
+			return s.offsets[i] >= it.next
+		})
+		// 세그먼트의 나머지가 컴팩션으로 지워졌으면 다음 세그먼트로 넘어간다
+		if i == len(s.offsets) {
+			it.next = s.nextOffset
+			s.mu.RUnlock()
+			continue
+		}
+		record, err := s.readAt(i)
+		s.mu.RUnlock()
+		if err != nil {
+			it.err = err
+			return Record{}, false
+		}
+		it.next = record.Offset + 1
+		// 만료된 레코드는 컴팩션으로 지워진 레코드처럼 건너뛴다
+		if record.expired(now) {
+			continue
+		}
+		return record, true
+	}
+	return Record{}, false
+}
+
+func (it *logIterator) Offset() uint64 {
+	return it.next
+}
+
+func (it *logIterator) Err() error {
+	return it.err
+}
+
+// readIterator는 ReadFrom이 없는 CommitLog 백엔드를 Read로 하나씩 읽는다.
+type readIterator struct {
+	log       CommitLog
+	next, end uint64
+	err       error
+}
+
+func (it *readIterator) Next() (Record, bool) {
+	for it.err == nil && it.next < it.end {
+		record, err := it.log.Read(it.next)
+		if err == ErrOffsetCompacted || err == ErrRecordExpired {
+			it.next++
+			continue
+		}
+		if err == ErrOffsetNotFound {
+			it.next = it.end
+			break
+		}
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.next++
+		return record, true
+	}
+	return Record{}, false
+}
+
+func (it *readIterator) Offset() uint64 {
+	return it.next
+}
+
+func (it *readIterator) Err() error {
+	return it.err
+}
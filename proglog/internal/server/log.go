@@ -1,43 +1,896 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Log는 여러 핸들러 고루틴에서 동시에 호출되므로 락을 나누어서 보호한다.
+// 레코드는 세그먼트에 나누어 저장하고, 마지막 세그먼트(activeSegment)에만 쓴다.
+//
+//   - mu는 세그먼트 목록과 lowest 같은 Log 전체의 상태를 보호한다. Append와 Read는 읽기 락만 잡고,
+//     세그먼트를 바꾸거나 잘라내거나 컴팩션할 때만 쓰기 락을 잡는다.
+//   - writeMu는 Append끼리 한 번에 하나만 진행하게 해서 오프셋이 빠짐없이 1씩 커지게 한다.
+//   - 세그먼트마다 있는 mu는 그 세그먼트의 오프셋과 위치를 보호한다. Append는 활성 세그먼트의 락만 잡으므로
+//     이전 세그먼트를 읽는 쪽은 쓰기와 경쟁하지 않는다.
+//
+// Append가 리턴한 오프셋은 항상 그 전에 리턴한 오프셋보다 크고, Append가 리턴한 뒤에는 바로 Read로 읽을 수 있다.
+// AppendBatch의 레코드 사이에 다른 Append가 끼어들지 않지만, 배치가 끝나기 전에 앞쪽 레코드를 먼저 읽을 수는 있다.
 type Log struct {
-	mu      sync.Mutex
-	records []Record
+	mu      sync.RWMutex
+	writeMu sync.Mutex
+
+	Dir    string
+	Config Config
+
+	activeSegment *segment
+	segments      []*segment
+
+	// lowest는 읽을 수 있는 가장 작은 오프셋이다. 이보다 작은 오프셋은 이미 삭제된 것으로 본다.
+	lowest uint64
+
+	// readOnly가 true이면 Append와 Reset이 ErrReadOnly를 리턴한다.
+	readOnly bool
+
+	// closed가 true이면 Close 뒤이므로 읽기와 쓰기가 모두 ErrLogClosed를 리턴한다.
+	closed bool
+
+	// recovery는 파일에서 열 때 세그먼트들을 복구한 결과를 합친 것이다.
+	recovery RecoveryInfo
+
+	// stopSync는 FsyncInterval 정책의 백그라운드 fsync를 멈춘다. 다른 정책에서는 nil이다.
+	stopSync func()
+
+	// keys는 레코드의 키마다 가장 최근 레코드의 오프셋을 기억한다.
+	// Append는 mu의 읽기 락만 잡으므로 keysMu로 따로 보호한다.
+	keysMu sync.RWMutex
+	keys   map[string]uint64
+
+	// appended는 새 레코드가 추가될 때마다 닫히고 새 채널로 교체된다.
+	// 레코드를 기다리는 쪽은 Appended()로 받은 채널이 닫힐 때까지 기다리면 된다.
+	notifyMu     sync.Mutex
+	appended     chan struct{}
+	notifyClosed bool
 }
 
+// NewLog는 메모리에만 레코드를 저장하는 Log를 만든다.
 func NewLog() *Log {
-	return &Log{}
+	log, _ := NewLogWithConfig("", Config{})
+	return log
+}
+
+// NewPersistentLog는 dir 디렉터리에 레코드를 저장하는 Log를 기본 설정으로 만든다.
+func NewPersistentLog(dir string) (*Log, error) {
+	return NewLogWithConfig(dir, Config{})
+}
+
+// NewLogWithConfig는 설정을 지정해서 Log를 만든다.
+// dir이 비어있으면 메모리 Log가 되고, 아니면 dir 디렉터리의 세그먼트 파일을 열거나 새로 만든다.
+// 파일에 이미 레코드가 있다면 세그먼트를 모두 다시 읽기 때문에
+// 서버가 재시작해도 오프셋이 그대로 유지된다.
+func NewLogWithConfig(dir string, c Config) (*Log, error) {
+	if c.Segment.EncryptionKey != nil {
+		if _, err := newAEAD(c.Segment.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	if c.Segment.MaxStoreBytes == 0 {
+		c.Segment.MaxStoreBytes = defaultMaxStoreBytes
+	}
+	l := &Log{
+		Dir:      dir,
+		Config:   c,
+		appended: make(chan struct{}),
+		keys:     make(map[string]uint64),
+	}
+	if err := l.setup(); err != nil {
+		return l, err
+	}
+	l.startSync()
+	return l, nil
+}
+
+// setup은 디렉터리에 있는 세그먼트 파일 이름에서 베이스 오프셋을 찾아서
+// 오래된 순서대로 세그먼트를 다시 만든다. 세그먼트가 하나도 없으면 오프셋 0부터 시작한다.
+func (c *Log) setup() error {
+	if c.Dir == "" {
+		return c.newSegment(0)
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	var baseOffsets []uint64
+	for _, file := range files {
+		if path.Ext(file.Name()) != ".store" {
+			continue
+		}
+		offStr := strings.TrimSuffix(file.Name(), ".store")
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		if err != nil {
+			continue
+		}
+		baseOffsets = append(baseOffsets, off)
+	}
+	sort.Slice(baseOffsets, func(i, j int) bool {
+		return baseOffsets[i] < baseOffsets[j]
+	})
+
+	for _, off := range baseOffsets {
+		if err := c.newSegment(off); err != nil {
+			return err
+		}
+		r := c.activeSegment.recovery
+		c.recovery.Records += r.Records
+		c.recovery.TruncatedBytes += r.TruncatedBytes
+	}
+	// 컴팩션으로 세그먼트의 마지막 레코드가 지워졌을 수 있으므로
+	// 활성 세그먼트가 아닌 세그먼트의 nextOffset은 다음 세그먼트의 베이스 오프셋이다
+	for i := 0; i+1 < len(c.segments); i++ {
+		c.segments[i].nextOffset = c.segments[i+1].baseOffset
+	}
+	if c.segments == nil {
+		return c.newSegment(0)
+	}
+	c.lowest = c.segments[0].baseOffset
+	// 세그먼트 중간까지 잘라냈다면 그 앞의 레코드는 파일에 남아있으므로 기록해둔 lowest부터 읽게 한다
+	saved, err := c.loadLowest()
+	if err != nil {
+		return err
+	}
+	if saved > c.lowest {
+		c.lowest = min(saved, c.activeSegment.nextOffset)
+	}
+	return c.buildKeyIndex()
+}
+
+// lowestPath는 Truncate가 세그먼트 중간까지 잘라낸 lowest를 재시작한 뒤에도 쓰도록 기록하는 파일이다.
+func (c *Log) lowestPath() string {
+	return path.Join(c.Dir, "lowest")
+}
+
+// saveLowest는 lowest를 임시 파일에 쓰고 이름을 바꿔서 기록한다. 메모리 Log이면 아무 일도 하지 않는다.
+func (c *Log) saveLowest(lowest uint64) error {
+	if c.Dir == "" {
+		return nil
+	}
+	tmp := c.lowestPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(lowest, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.lowestPath())
+}
+
+// loadLowest는 saveLowest가 기록한 lowest를 읽는다. 파일이 없으면 0이다.
+func (c *Log) loadLowest() (uint64, error) {
+	b, err := os.ReadFile(c.lowestPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	lowest, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", c.lowestPath(), err)
+	}
+	return lowest, nil
+}
+
+// buildKeyIndex는 모든 세그먼트의 레코드를 읽어서 키 인덱스를 다시 만든다.
+func (c *Log) buildKeyIndex() error {
+	c.keys = make(map[string]uint64)
+	for _, s := range c.segments {
+		for i := 0; i < s.Len(); i++ {
+			record, err := s.readAt(i)
+			if err != nil {
+				return err
+			}
+			if record.Key != nil && record.Offset >= c.lowest {
+				c.keys[string(record.Key)] = record.Offset
+			}
+		}
+	}
+	return nil
+}
+
+// AppendContext는 ctx가 취소되었으면 레코드를 추가하지 않고 ctx.Err()를 리턴한다.
+// 락을 기다리는 동안 취소된 경우에도 추가하지 않는다.
+func (c *Log) AppendContext(ctx context.Context, record Record) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.append(record)
 }
 
 func (c *Log) Append(record Record) (uint64, error) {
-	c.mu.Lock()         // concurrent access to the log is not allowed
-	defer c.mu.Unlock() // unlock when the function returns
+	c.writeMu.Lock() // 레코드를 추가하는 쪽은 한 번에 하나만 진행한다
+	defer c.writeMu.Unlock()
+	return c.append(record)
+}
 
-	record.Offset = uint64(len(c.records)) // set the offset of the record
-	c.records = append(c.records, record)
+// AppendIf는 다음에 추가될 오프셋이 expected일 때만 레코드를 추가한다. 다르면 추가하지 않고 실제 다음 오프셋과
+// ErrOffsetMismatch를 리턴한다. 확인과 추가를 writeMu 안에서 하므로 그 사이에 다른 레코드가 끼어들지 않는다.
+func (c *Log) AppendIf(expected uint64, record Record) (uint64, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if next := nextOffset(c); next != expected {
+		return next, ErrOffsetMismatch
+	}
+	return c.append(record)
+}
 
-	return record.Offset, nil
+// append는 writeMu를 잡은 상태에서 레코드를 추가한다.
+// 타임스탬프를 writeMu 안에서 정하므로 오프셋 순서와 타임스탬프 순서가 같다.
+func (c *Log) append(record Record) (uint64, error) {
+	record.Timestamp = time.Now()
+	return c.appendRecord(record)
 }
 
-func (c *Log) Read(offset uint64) (Record, error) {
+// appendReplicated는 다른 노드가 정한 타임스탬프를 그대로 두고 레코드를 추가한다.
+// DistributedLog의 FSM이 모든 노드에서 같은 레코드를 만들기 위해 사용한다.
+func (c *Log) appendReplicated(record Record) (uint64, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.appendRecord(record)
+}
+
+// appendRecord는 writeMu를 잡은 상태에서 타임스탬프가 정해진 레코드를 추가한다.
+func (c *Log) appendRecord(record Record) (uint64, error) {
+	off, _, maintain, err := c.writeRecord(record, true)
+	if err != nil {
+		return 0, err
+	}
+	c.notifyAppended()
+	if maintain {
+		return off, c.maintain()
+	}
+	return off, nil
+}
+
+// writeRecord는 writeMu를 잡은 상태에서 활성 세그먼트에 레코드를 쓰고 키 인덱스를 갱신한다.
+// Log의 읽기 락과 활성 세그먼트의 락만 잡으므로 다른 세그먼트를 읽는 쪽은 기다리지 않는다.
+// sync가 true이고 FsyncAlways 정책이면 리턴하기 전에 fsync 한다.
+// 세그먼트를 바꾸거나 오래된 레코드를 잘라내야 하면 maintain이 true이고, 호출자가 c.maintain을 호출한다.
+func (c *Log) writeRecord(record Record, sync bool) (off uint64, s *segment, maintain bool, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return 0, nil, false, ErrLogClosed
+	}
+	if c.readOnly {
+		return 0, nil, false, ErrReadOnly
+	}
+	s = c.activeSegment
+	s.mu.Lock()
+	off, err = s.Append(record)
+	if err == nil && sync && c.Config.Fsync == FsyncAlways {
+		err = s.Sync()
+	}
+	maxed := s.IsMaxed()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if record.Key != nil {
+		c.keysMu.Lock()
+		c.keys[string(record.Key)] = off
+		c.keysMu.Unlock()
+	}
+	max := c.Config.MaxRecords
+	return off, s, maxed || (max > 0 && off+1-c.lowest > max), nil
+}
+
+// maintain은 쓰기 락을 잡고 활성 세그먼트가 가득 찼으면 새 세그먼트를 만들고, 레코드 수 제한을 넘으면 잘라낸다.
+// 읽기 락을 놓은 사이에 다른 쪽이 이미 처리했을 수 있으므로 조건을 다시 확인한다.
+func (c *Log) maintain() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if offset >= uint64(len(c.records)) {
+	if c.closed {
+		return ErrLogClosed
+	}
+	if err := c.rollIfMaxed(); err != nil {
+		return err
+	}
+	return c.enforceMaxRecords()
+}
+
+// rollIfMaxed는 활성 세그먼트가 가득 차면 다음 오프셋부터 시작하는 새 세그먼트를 만든다.
+func (c *Log) rollIfMaxed() error {
+	if !c.activeSegment.IsMaxed() {
+		return nil
+	}
+	return c.newSegment(c.activeSegment.nextOffset)
+}
+
+// AppendBatch는 다른 Append와 섞이지 않게 레코드들을 순서대로 추가한 뒤 각 레코드의 오프셋을 리턴한다.
+// 파일 Log에서는 레코드마다가 아니라 배치가 끝난 뒤에 쓴 세그먼트의 버퍼를 한 번만 flush 하고,
+// FsyncAlways 정책이면 fsync도 배치마다 한 번만 한다.
+// 중간에 실패하면 그때까지 추가된 레코드의 오프셋과 에러를 함께 리턴한다.
+// append-only 로그이므로 이미 추가된 레코드는 되돌리지 않고 그대로 남는다.
+func (c *Log) AppendBatch(records []Record) ([]uint64, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	offsets := make([]uint64, 0, len(records))
+	defer func() {
+		if len(offsets) > 0 {
+			c.notifyAppended()
+		}
+	}()
+	var written []*segment
+	for _, record := range records {
+		record.Timestamp = time.Now()
+		off, s, maintain, err := c.writeRecord(record, false)
+		if err != nil {
+			c.flushBatch(written)
+			return offsets, err
+		}
+		offsets = append(offsets, off)
+		if len(written) == 0 || written[len(written)-1] != s {
+			written = append(written, s)
+		}
+		if maintain {
+			if err := c.maintain(); err != nil {
+				c.flushBatch(written)
+				return offsets, err
+			}
+		}
+	}
+	return offsets, c.flushBatch(written)
+}
+
+// flushBatch는 배치에서 쓴 세그먼트를 flush 하고, FsyncAlways 정책이면 fsync까지 한다.
+// 그 사이에 잘려나간 세그먼트는 이미 닫혔으므로 건너뛴다.
+func (c *Log) flushBatch(segments []*segment) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil
+	}
+	live := segments[:0]
+	for _, s := range segments {
+		if slices.Contains(c.segments, s) {
+			live = append(live, s)
+		}
+	}
+	if c.Config.Fsync == FsyncAlways {
+		return syncSegments(live)
+	}
+	return flushSegments(live)
+}
+
+// flushSegments는 세그먼트들의 버퍼를 파일에 쓴다. 실패해도 나머지 세그먼트는 계속 flush 하고 첫 에러를 리턴한다.
+func flushSegments(segments []*segment) error {
+	var first error
+	for _, s := range segments {
+		if err := s.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// enforceMaxRecords는 레코드 수가 Config.MaxRecords를 넘으면 가장 오래된 레코드부터 잘라낸다.
+// 쓰기 락을 잡은 상태에서 호출해야 한다.
+func (c *Log) enforceMaxRecords() error {
+	max := c.Config.MaxRecords
+	next := c.activeSegment.nextOffset
+	if max == 0 || next-c.lowest <= max {
+		return nil
+	}
+	return c.truncate(next - max)
+}
+
+// SetMaxRecords는 보관할 최대 레코드 수를 바꾼다. 0이면 제한하지 않는다.
+// 다음 Append부터 적용된다.
+func (c *Log) SetMaxRecords(n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Config.MaxRecords = n
+}
+
+// SetReadOnly는 읽기 전용 모드를 켜거나 끈다.
+// 읽기 전용 모드에서는 레코드를 추가할 수 없고 읽기만 할 수 있다.
+func (c *Log) SetReadOnly(readOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readOnly = readOnly
+}
+
+// LowestOffset은 현재 읽을 수 있는 가장 작은 오프셋을 리턴한다.
+// 로그가 비어있으면 다음에 추가될 레코드의 오프셋이다.
+func (c *Log) LowestOffset() uint64 {
+	lowest, _, _ := c.Bounds()
+	return lowest
+}
+
+// HighestOffset은 마지막으로 추가된 레코드의 오프셋을 리턴한다.
+// 로그가 비어있으면 LowestOffset과 같은 값을 리턴하므로 Bounds의 count로 구분해야 한다.
+func (c *Log) HighestOffset() uint64 {
+	_, highest, _ := c.Bounds()
+	return highest
+}
+
+// SizeBytes는 모든 세그먼트의 store와 index 크기를 더한 바이트 수다. 아직 flush 하지 않은 버퍼도 포함하고,
+// Truncate가 세그먼트 중간까지 잘라낸 앞쪽 레코드처럼 읽을 수 없지만 디스크에 남은 부분도 센다.
+// 메모리 Log는 index 파일이 없으므로 레코드를 인코딩한 값과 헤더의 크기만 더한다.
+func (c *Log) SizeBytes() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var n uint64
+	for _, s := range c.segments {
+		n += s.store.Size()
+		if c.Dir != "" {
+			s.mu.RLock()
+			n += uint64(len(s.positions)) * entWidth
+			s.mu.RUnlock()
+		}
+	}
+	return n
+}
+
+// Bounds는 같은 시점의 가장 작은 오프셋, 가장 큰 오프셋, 그 사이의 오프셋 수를 리턴한다.
+// count에는 컴팩션으로 지워진 오프셋도 포함된다.
+// 로그가 비어있으면 lowest와 highest는 다음에 추가될 레코드의 오프셋이고 count는 0이다.
+func (c *Log) Bounds() (lowest, highest, count uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	next := c.activeSegment.next()
+	if next == c.lowest {
+		return c.lowest, c.lowest, 0
+	}
+	return c.lowest, next - 1, next - c.lowest
+}
+
+// ReadContext는 ctx가 취소되었으면 레코드를 읽지 않고 ctx.Err()를 리턴한다.
+func (c *Log) ReadContext(ctx context.Context, offset uint64) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	return c.read(offset)
+}
+
+func (c *Log) Read(offset uint64) (Record, error) {
+	c.mu.RLock() // 읽기끼리는 동시에 진행할 수 있다
+	defer c.mu.RUnlock()
+	return c.read(offset)
+}
+
+// read는 읽기 락을 잡은 상태에서 레코드를 읽는다.
+func (c *Log) read(offset uint64) (Record, error) {
+	if c.closed {
+		return Record{}, ErrLogClosed
+	}
+	if offset < c.lowest {
+		return Record{}, ErrOffsetOutOfRange
+	}
+	s := c.segmentFor(offset)
+	if s == nil {
 		return Record{}, ErrOffsetNotFound
 	}
+	record, err := s.Read(offset)
+	// 스윕하기 전의 레코드도 만료 시각이 지났으면 읽을 수 없다
+	if err == nil && record.expired(time.Now()) {
+		return Record{}, ErrRecordExpired
+	}
+	return record, err
+}
+
+// Truncate는 lowest보다 작은 오프셋의 레코드를 삭제하고, 삭제된 오프셋을 읽으면 ErrOffsetOutOfRange를 리턴한다.
+// 파일은 세그먼트 단위로 지우기 때문에 lowest가 세그먼트 중간에 있으면 그 세그먼트는 디스크에 남아있지만
+// 읽을 수는 없다. 활성 세그먼트는 지우지 않는다. lowest는 Log 디렉터리의 lowest 파일에 기록하므로
+// 다시 열어도 남아있는 앞쪽 레코드를 읽을 수 없다.
+func (c *Log) Truncate(lowest uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.truncate(lowest)
+}
+
+// truncate는 쓰기 락을 잡은 상태에서 Truncate를 수행한다.
+func (c *Log) truncate(lowest uint64) error {
+	if c.closed {
+		return ErrLogClosed
+	}
+	if next := c.activeSegment.nextOffset; lowest > next {
+		lowest = next
+	}
+	if lowest <= c.lowest {
+		return nil
+	}
+	if err := c.saveLowest(lowest); err != nil {
+		return err
+	}
+	c.lowest = lowest
+	for key, off := range c.keys {
+		if off < lowest {
+			delete(c.keys, key)
+		}
+	}
+
+	var segments []*segment
+	for _, s := range c.segments {
+		if s.nextOffset <= lowest && s != c.activeSegment {
+			if err := s.Remove(); err != nil {
+				return err
+			}
+			continue
+		}
+		segments = append(segments, s)
+	}
+	c.segments = segments
+	return nil
+}
+
+// Reset은 모든 세그먼트와 store 파일을 삭제하고 오프셋 0부터 다시 시작하는 빈 로그로 되돌린다.
+// 쓰기 락을 잡고 수행하므로 동시에 들어온 Append나 Read와 섞이지 않는다.
+func (c *Log) Reset() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrLogClosed
+	}
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	return c.resetAt(0)
+}
+
+// Compact는 키가 있는 레코드 중 같은 키의 더 최근 레코드가 있는 레코드를 지워서
+// 키마다 가장 최근 레코드만 남긴다. 가장 최근 레코드의 값이 비어있으면(툼스톤) 그 키의 레코드를 모두 지운다.
+// 키가 없는 레코드는 그대로 남고, 남은 레코드의 오프셋은 바뀌지 않는다.
+// 지워진 오프셋을 읽으면 ErrOffsetCompacted를 리턴한다.
+// 활성 세그먼트는 다시 쓰지 않으므로 활성 세그먼트에 있는 레코드와 툼스톤은 세그먼트가 바뀐 뒤에 정리된다.
+// 컴팩션하는 동안 쓰기 락을 잡기 때문에 Append와 Read는 기다려야 한다.
+func (c *Log) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrLogClosed
+	}
+
+	// 키마다 가장 최근 레코드의 오프셋과 툼스톤 여부를 찾는다
+	type latest struct {
+		offset    uint64
+		tombstone bool
+	}
+	latestByKey := make(map[string]latest)
+	for _, s := range c.segments {
+		for i := 0; i < s.Len(); i++ {
+			record, err := s.readAt(i)
+			if err != nil {
+				return err
+			}
+			if record.Key == nil {
+				continue
+			}
+			latestByKey[string(record.Key)] = latest{
+				offset:    record.Offset,
+				tombstone: len(record.Value) == 0,
+			}
+		}
+	}
+
+	for _, s := range c.segments {
+		if s == c.activeSegment {
+			continue
+		}
+		err := s.rewrite(func(record Record) (Record, bool) {
+			if record.Key == nil {
+				return record, true
+			}
+			l := latestByKey[string(record.Key)]
+			return record, l.offset == record.Offset && !l.tombstone
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 툼스톤이 지워진 키는 인덱스에서도 지운다
+	for key, l := range latestByKey {
+		if l.tombstone && l.offset < c.activeSegment.baseOffset {
+			delete(c.keys, key)
+		}
+	}
+	return nil
+}
+
+// SweepExpired는 now에 ExpireAt이 지난 레코드를 값과 헤더를 버린 툼스톤으로 바꿔서 세그먼트를 다시 쓰고, 바꾼 레코드 수를 리턴한다.
+// 오프셋은 그대로 남고 Read는 스윕 전과 마찬가지로 ErrRecordExpired를 리턴하므로, 스윕은 디스크 공간을 돌려받는 일만 한다.
+// 활성 세그먼트는 Compact처럼 다시 쓰지 않으므로 그 안의 레코드는 세그먼트가 바뀐 뒤에 정리된다.
+// 한 번 확인한 세그먼트는 남은 레코드의 가장 이른 ExpireAt이 지나기 전까지 다시 읽지 않는다.
+// 다시 쓰는 동안 쓰기 락을 잡기 때문에 Append와 Read는 기다려야 한다.
+func (c *Log) SweepExpired(now time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, ErrLogClosed
+	}
+	swept := 0
+	for _, s := range c.segments {
+		if s == c.activeSegment || !s.sweepDue(now) {
+			continue
+		}
+		n, next, err := s.expiring(now)
+		if err != nil {
+			return swept, err
+		}
+		if n > 0 {
+			err := s.rewrite(func(record Record) (Record, bool) {
+				if record.expired(now) {
+					return record.expiredTombstone(), true
+				}
+				return record, true
+			})
+			if err != nil {
+				return swept, err
+			}
+		}
+		s.swept, s.nextExpiry = true, next
+		swept += n
+	}
+	return swept, nil
+}
+
+// TruncateBefore는 마지막 레코드가 t보다 먼저 추가된 세그먼트를 모두 삭제한다.
+// 활성 세그먼트가 오래되었으면 새 세그먼트로 교체한 뒤 삭제한다.
+func (c *Log) TruncateBefore(t time.Time) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrLogClosed
+	}
+	active := c.activeSegment
+	if active.nextOffset > active.baseOffset && active.modTime.Before(t) {
+		if err := c.newSegment(active.nextOffset); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	var lowest uint64
+	for _, s := range c.segments {
+		if !s.modTime.Before(t) {
+			break
+		}
+		lowest = s.nextOffset
+	}
+	c.mu.Unlock()
+
+	if lowest == 0 {
+		return nil
+	}
+	return c.Truncate(lowest)
+}
 
-	return c.records[offset], nil
+// ReadKey는 key를 가진 가장 최근 레코드를 읽는다.
+// 그런 레코드가 없거나, 가장 최근 레코드가 툼스톤(빈 값)이거나, 이미 삭제되었으면 ErrKeyNotFound를 리턴한다.
+func (c *Log) ReadKey(key []byte) (Record, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return Record{}, ErrLogClosed
+	}
+	c.keysMu.RLock()
+	off, ok := c.keys[string(key)]
+	c.keysMu.RUnlock()
+	if !ok {
+		return Record{}, ErrKeyNotFound
+	}
+	record, err := c.read(off)
+	switch err {
+	case nil:
+	case ErrOffsetOutOfRange, ErrOffsetCompacted, ErrRecordExpired:
+		return Record{}, ErrKeyNotFound
+	default:
+		return Record{}, err
+	}
+	if len(record.Value) == 0 {
+		return Record{}, ErrKeyNotFound
+	}
+	return record, nil
 }
 
+// OffsetForTime은 t 또는 그 이후에 추가된 가장 앞의 레코드 오프셋을 리턴하고,
+// 그런 레코드가 없으면 ErrOffsetNotFound를 리턴한다.
+// 레코드는 추가된 순서대로 타임스탬프가 커지므로 세그먼트 안에서는 이진 탐색한다.
+func (c *Log) OffsetForTime(t time.Time) (uint64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return 0, ErrLogClosed
+	}
+	var readErr error
+	atOrAfter := func(s *segment, i int) bool {
+		if s.offsets[i] < c.lowest {
+			return false
+		}
+		record, err := s.readAt(i)
+		if err != nil {
+			readErr = err
+			return true
+		}
+		return !record.Timestamp.Before(t)
+	}
+	// 컴팩션으로 빈 세그먼트가 생길 수 있어서 세그먼트는 앞에서부터 마지막 레코드만 확인한다
+	search := func(s *segment) (uint64, bool) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		n := s.Len()
+		if n == 0 || !atOrAfter(s, n-1) {
+			return 0, false
+		}
+		i := sort.Search(n, func(i int) bool { return atOrAfter(s, i) })
+		return s.offsets[i], true
+	}
+	for _, s := range c.segments {
+		off, ok := search(s)
+		if readErr != nil {
+			return 0, readErr
+		}
+		if ok {
+			return off, nil
+		}
+	}
+	return 0, ErrOffsetNotFound
+}
+
+// Appended는 다음 레코드가 추가되면 닫히는 채널을 리턴한다.
+// 레코드를 놓치지 않으려면 Read를 호출하기 전에 먼저 채널을 받아두어야 한다.
+// Log를 닫은 뒤에는 이미 닫힌 채널을 리턴한다.
+func (c *Log) Appended() <-chan struct{} {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	return c.appended
+}
+
+// notifyAppended는 기다리는 쪽을 깨우고 다음 알림을 위한 채널을 새로 만든다.
+// Close가 먼저 채널을 닫았으면 아무 일도 하지 않는다.
+func (c *Log) notifyAppended() {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	if c.notifyClosed {
+		return
+	}
+	close(c.appended)
+	c.appended = make(chan struct{})
+}
+
+// segmentFor는 오프셋이 들어있을 수 있는 세그먼트, 즉 베이스 오프셋이 offset 이하인 마지막 세그먼트를 찾는다.
+// 베이스 오프셋은 바뀌지 않으므로 활성 세그먼트의 락 없이 이진 탐색할 수 있다.
+// 오프셋이 그 세그먼트의 nextOffset보다 작은지는 세그먼트의 락을 잡고 확인해야 한다.
+// 해당하는 세그먼트가 없으면 nil을 리턴한다.
+func (c *Log) segmentFor(offset uint64) *segment {
+	i := sort.Search(len(c.segments), func(i int) bool {
+		return c.segments[i].baseOffset > offset
+	})
+	if i == 0 {
+		return nil
+	}
+	return c.segments[i-1]
+}
+
+// newSegment는 새 세그먼트를 만들어서 활성 세그먼트로 지정한다.
+func (c *Log) newSegment(off uint64) error {
+	s, err := newSegment(c.Dir, off, c.Config)
+	if err != nil {
+		return err
+	}
+	c.segments = append(c.segments, s)
+	c.activeSegment = s
+	return nil
+}
+
+// Close는 모든 세그먼트의 버퍼를 flush 하고 fsync 한 뒤 파일을 닫는다.
+// 닫은 뒤에는 읽기와 쓰기가 모두 ErrLogClosed를 리턴하고, 레코드를 기다리던 쪽은 깨어나서 그 에러를 받는다.
+// 세그먼트 하나를 닫다가 실패해도 나머지 세그먼트는 닫고 첫 에러를 리턴한다.
+func (c *Log) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrLogClosed
+	}
+	c.closed = true
+	c.notifyMu.Lock()
+	close(c.appended)
+	c.notifyClosed = true
+	c.notifyMu.Unlock()
+	if c.stopSync != nil {
+		c.stopSync()
+	}
+
+	var first error
+	for _, s := range c.segments {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Record의 Key는 선택 사항이고, 키로 가장 최근 레코드를 찾거나
+// 컴팩션할 때 같은 키의 레코드 중 가장 최근 것만 남기는 데 사용한다. JSON에서는 Value처럼 base64로 인코딩한다.
 type Record struct {
 	Value  []byte `json:"value"`
 	Offset uint64 `json:"offset"`
+	Key    []byte `json:"key,omitempty"`
+	// Timestamp는 레코드가 로그에 추가된 시각이다. 클라이언트가 보낸 값은 무시하고 Append가 채운다.
+	Timestamp time.Time `json:"timestamp"`
+	// Headers는 content-type이나 trace id처럼 클라이언트가 레코드에 붙이는 메타데이터다.
+	// 서버는 해석하지 않고 레코드와 함께 저장했다가 그대로 돌려준다.
+	Headers map[string]string `json:"headers,omitempty"`
+	// ExpireAt이 있으면 그 시각부터 레코드를 읽을 수 없고 ErrRecordExpired를 리턴한다. 보존 정책과 상관없이 레코드마다 정한다.
+	ExpireAt time.Time `json:"expireAt,omitzero"`
+}
+
+// expired는 레코드에 만료 시각이 있고 now에 이미 지났는지 알려준다.
+func (r Record) expired(now time.Time) bool {
+	return !r.ExpireAt.IsZero() && !now.Before(r.ExpireAt)
+}
+
+// expiredTombstone은 만료된 레코드의 값과 헤더를 버리고 오프셋, 키, 시각만 남긴다.
+// 키가 남아있어서 컴팩션은 이 레코드를 그 키의 툼스톤으로 보고 같은 키의 이전 레코드와 함께 지운다.
+func (r Record) expiredTombstone() Record {
+	return Record{Offset: r.Offset, Key: r.Key, Timestamp: r.Timestamp, ExpireAt: r.ExpireAt}
 }
 
 var ErrOffsetNotFound = fmt.Errorf("offset not found")
+
+// ErrOffsetOutOfRange는 보존 정책 등으로 이미 삭제된 오프셋을 읽을 때 리턴한다.
+var ErrOffsetOutOfRange = fmt.Errorf("offset out of range")
+
+// ErrOffsetCompacted는 컴팩션으로 지워진 오프셋을 읽을 때 리턴한다.
+// 로그의 범위 안에 있는 오프셋이므로 순서대로 읽는 쪽은 이 오프셋을 건너뛰고 계속 읽으면 된다.
+var ErrOffsetCompacted = fmt.Errorf("offset compacted")
+
+// ErrRecordExpired는 ExpireAt이 지난 레코드를 읽을 때 리턴한다. 오프셋은 다시 쓰지 않으므로
+// ErrOffsetCompacted처럼 순서대로 읽는 쪽은 이 오프셋을 건너뛰고 계속 읽으면 된다.
+var ErrRecordExpired = fmt.Errorf("record expired")
+
+// ErrOffsetMismatch는 AppendIf의 expected가 로그의 다음 오프셋과 다를 때 리턴한다.
+var ErrOffsetMismatch = fmt.Errorf("offset mismatch")
+
+// ErrCorruptRecord는 저장된 레코드의 체크섬이 맞지 않을 때 리턴한다. 디스크의 데이터가 손상된 경우이다.
+var ErrCorruptRecord = fmt.Errorf("corrupt record")
+
+// ErrKeyNotFound는 키에 해당하는 레코드가 없을 때 ReadKey가 리턴한다.
+var ErrKeyNotFound = fmt.Errorf("key not found")
+
+// ErrReadOnly는 읽기 전용 Log에 쓰려고 할 때 리턴한다.
+var ErrReadOnly = fmt.Errorf("log is read-only")
+
+// ErrLogClosed는 Close한 Log를 사용하려고 할 때 리턴한다.
+var ErrLogClosed = fmt.Errorf("log is closed")
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// 50개의 고루틴이 Append 하는 동안 50개의 고루틴이 Read 한다. go test -race로 실행해야 의미가 있다.
+func TestLogConcurrentAppendRead(t *testing.T) {
+	const (
+		producers = 50
+		consumers = 50
+		perWorker = 100
+	)
+	log := NewLog()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, producers+consumers)
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := log.Append(Record{Value: []byte(fmt.Sprintf("%d-%d", p, i))}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				// 아직 추가되지 않은 오프셋이면 ErrOffsetNotFound가 정상이다
+				_, err := log.Read(uint64(i))
+				if err != nil && !errors.Is(err, ErrOffsetNotFound) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// 오프셋은 빠짐없이 0부터 이어지고, 추가한 값은 모두 한 번씩 있어야 한다
+	seen := make(map[string]bool)
+	for off := uint64(0); off < producers*perWorker; off++ {
+		record, err := log.Read(off)
+		if err != nil {
+			t.Fatalf("read %d: %v", off, err)
+		}
+		if record.Offset != off {
+			t.Fatalf("record at %d has offset %d", off, record.Offset)
+		}
+		seen[string(record.Value)] = true
+	}
+	if len(seen) != producers*perWorker {
+		t.Fatalf("got %d distinct values, want %d", len(seen), producers*perWorker)
+	}
+	if _, err := log.Read(producers * perWorker); !errors.Is(err, ErrOffsetNotFound) {
+		t.Fatalf("read past the end: got %v, want %v", err, ErrOffsetNotFound)
+	}
+}
+
+// 세그먼트 여러 개에 나뉜 파일 Log에서 무작위 오프셋을 읽는다.
+func BenchmarkRead(b *testing.B) {
+	const records = 10000
+	var c Config
+	c.Segment.MaxStoreBytes = 64 << 10
+	log, err := NewLogWithConfig(b.TempDir(), c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer log.Close()
+	value := make([]byte, 256)
+	for i := 0; i < records; i++ {
+		if _, err := log.Append(Record{Value: value}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := log.Read(rng.Uint64N(records)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Truncate는 lowest 앞의 레코드를 읽을 수 없게 하고, 그 앞의 레코드만 있는 세그먼트 파일은 지운다.
+// 세그먼트 중간에서 자른 경계는 다시 열어도 그대로다.
+func TestLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	var c Config
+	// 레코드 몇 개마다 세그먼트가 바뀌도록 작게 잡는다
+	c.Segment.MaxStoreBytes = 256
+	log, err := NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const records = 30
+	for i := 0; i < records; i++ {
+		if _, err := log.Append(Record{Value: []byte(fmt.Sprintf("record-%02d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(log.segments) < 3 {
+		t.Fatalf("got %d segments, want at least 3", len(log.segments))
+	}
+	// 두 번째 세그먼트의 중간에서 자른다
+	second := log.segments[1]
+	lowest := second.baseOffset + (second.nextOffset-second.baseOffset)/2
+	if lowest == second.baseOffset {
+		t.Fatalf("segment %d has a single record", second.baseOffset)
+	}
+	segments := len(log.segments)
+	if err := log.Truncate(lowest); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(log.segments); got != segments-1 {
+		t.Fatalf("got %d segments after truncating into the second one, want %d", got, segments-1)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0.store")); !os.IsNotExist(err) {
+		t.Fatalf("first segment store still exists: %v", err)
+	}
+
+	check := func(log *Log) {
+		t.Helper()
+		if got := log.LowestOffset(); got != lowest {
+			t.Fatalf("lowest: got %d, want %d", got, lowest)
+		}
+		for _, off := range []uint64{0, second.baseOffset, lowest - 1} {
+			if _, err := log.Read(off); !errors.Is(err, ErrOffsetOutOfRange) {
+				t.Fatalf("read %d below lowest %d: got %v, want %v", off, lowest, err, ErrOffsetOutOfRange)
+			}
+		}
+		for off := lowest; off < records; off++ {
+			record, err := log.Read(off)
+			if err != nil {
+				t.Fatalf("read %d: %v", off, err)
+			}
+			if want := fmt.Sprintf("record-%02d", off); string(record.Value) != want {
+				t.Fatalf("read %d: got %q, want %q", off, record.Value, want)
+			}
+		}
+	}
+	check(log)
+
+	// 더 작은 lowest로 자르면 아무것도 바뀌지 않는다
+	if err := log.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	check(log)
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	check(log)
+	if off, err := log.Append(Record{Value: []byte(fmt.Sprintf("record-%02d", records))}); err != nil || off != records {
+		t.Fatalf("append after reopen: got %d, %v, want %d", off, err, records)
+	}
+}
+
+// 레코드 100개를 Append로 하나씩 추가할 때와 AppendBatch로 한 번에 추가할 때를 비교한다.
+// 파일 Log에서 AppendBatch는 락을 한 번 잡고 버퍼도 배치 끝에서 한 번만 flush 한다.
+func BenchmarkAppendBatch(b *testing.B) {
+	const batchSize = 100
+	records := make([]Record, batchSize)
+	for i := range records {
+		records[i] = Record{Value: make([]byte, 256)}
+	}
+	for _, fsync := range []FsyncPolicy{FsyncNever, FsyncAlways} {
+		newLog := func(b *testing.B) *Log {
+			var c Config
+			c.Fsync = fsync
+			log, err := NewLogWithConfig(b.TempDir(), c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { log.Close() })
+			return log
+		}
+		b.Run("fsync="+fsync.String()+"/single", func(b *testing.B) {
+			log := newLog(b)
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, record := range records {
+					if _, err := log.Append(record); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run("fsync="+fsync.String()+"/batch", func(b *testing.B) {
+			log := newLog(b)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := log.AppendBatch(records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 여러 고루틴이 활성 세그먼트에 쓰는 동안 이전 세그먼트를 읽는다. 쓰기 하나에 읽기 네 번을 섞는다.
+// 코어가 여러 개인 머신에서 -cpu 1,2,4,8로 실행해서 코어 수에 따라 처리량이 어떻게 늘어나는지 본다.
+func BenchmarkLogParallel(b *testing.B) {
+	const records = 10000
+	var c Config
+	c.Segment.MaxStoreBytes = 64 << 10
+	c.Fsync = FsyncNever
+	log, err := NewLogWithConfig(b.TempDir(), c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer log.Close()
+	value := make([]byte, 256)
+	for i := 0; i < records; i++ {
+		if _, err := log.Append(Record{Value: value}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewPCG(rand.Uint64(), 0))
+		for i := 0; pb.Next(); i++ {
+			var err error
+			if i%5 == 0 {
+				_, err = log.Append(Record{Value: value})
+			} else {
+				_, err = log.Read(rng.Uint64N(records))
+			}
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// wait 쿼리 파라미터로 기다릴 수 있는 최대 시간
+const maxConsumeWait = time.Minute
+
+// readWait는 offset의 레코드가 아직 없으면 최대 wait 동안 추가되기를 기다렸다가 읽는다.
+// 기다려도 추가되지 않으면 ErrOffsetNotFound를 리턴하고,
+// 그 전에 ctx가 끝나면(클라이언트가 연결을 끊으면) ctx.Err()를 리턴한다.
+func (s *httpServer) readWait(ctx context.Context, log CommitLog, offset uint64, wait time.Duration) (Record, error) {
+	if wait > maxConsumeWait {
+		wait = maxConsumeWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		// Read보다 먼저 채널을 받아야 그 사이에 추가된 레코드를 놓치지 않는다
+		appended := appended(log)
+		record, err := readContext(ctx, log, offset)
+		if err != ErrOffsetNotFound || wait <= 0 {
+			return record, err
+		}
+
+		select {
+		case <-appended:
+		case <-timer.C:
+			return Record{}, ErrOffsetNotFound
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// MembershipHandler는 Membership이 노드가 늘거나 줄었다고 알려줄 대상이다. DistributedLog가 구현한다.
+// 리더가 아니면 ErrNotLeader를 리턴하면 되고, Membership은 그 에러를 무시한다.
+type MembershipHandler interface {
+	Join(id, raftAddr, httpAddr string) error
+	Leave(id string) error
+}
+
+// MembershipConfig는 Membership이 Serf 클러스터에 참여하는 방법을 정한다.
+type MembershipConfig struct {
+	// NodeName은 Serf 클러스터 안에서 노드를 구분하는 이름이다. Raft 노드 ID와 같아야 한다.
+	NodeName string
+	// BindAddr는 노드끼리 가십 메시지를 주고받는 host:port다. TCP와 UDP를 모두 쓴다.
+	BindAddr string
+	// RaftAddr와 HTTPAddr는 태그로 다른 노드에 알려서 리더가 이 노드를 Raft에 추가할 때 쓴다.
+	RaftAddr string
+	HTTPAddr string
+	// StartJoinAddrs는 시작할 때 접속할 이미 클러스터에 있는 노드들의 BindAddr다. 하나만 접속되어도 나머지는 가십으로 찾는다.
+	StartJoinAddrs []string
+	// Logger는 Serf의 로그를 남길 로거다. 지정하지 않으면 slog.Default()를 사용한다.
+	Logger *slog.Logger
+}
+
+// Membership은 Serf로 살아있는 노드를 추적하고, 노드가 들어오면 handler.Join을, 정상적으로 떠나거나
+// 오래 응답이 없어서 정리되면 handler.Leave를 호출한다. 잠깐 응답이 없는 노드는 Raft 구성에서 빼지 않는다.
+// 리더가 없을 때 들어온 노드를 놓치지 않도록 reconcileInterval마다 살아있는 노드를 모두 다시 handler에 알린다.
+type Membership struct {
+	config  MembershipConfig
+	handler MembershipHandler
+	serf    *serf.Serf
+	events  chan serf.Event
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Member는 Serf 클러스터에 있는 노드 하나다. Status는 alive, leaving, left, failed 중 하나다.
+// Role은 Raft 구성에서의 역할로 leader나 follower이고, 아직 Raft 구성에 없으면 비어있다.
+type Member struct {
+	Name     string `json:"name"`
+	Addr     string `json:"addr"`
+	RaftAddr string `json:"raftAddr,omitempty"`
+	HTTPAddr string `json:"httpAddr,omitempty"`
+	Status   string `json:"status"`
+	Role     string `json:"role,omitempty"`
+}
+
+const (
+	roleLeader   = "leader"
+	roleFollower = "follower"
+)
+
+const (
+	raftAddrTag = "raft_addr"
+	httpAddrTag = "http_addr"
+)
+
+// 살아있는 노드를 다시 handler에 알리는 간격
+const reconcileInterval = 10 * time.Second
+
+// NewMembership은 Serf를 시작하고 StartJoinAddrs의 노드에 접속한다.
+func NewMembership(handler MembershipHandler, config MembershipConfig) (*Membership, error) {
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	host, portStr, err := net.SplitHostPort(config.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Membership{
+		config:  config,
+		handler: handler,
+		events:  make(chan serf.Event, 64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	logger := slog.NewLogLogger(config.Logger.Handler(), slog.LevelInfo)
+	sc := serf.DefaultConfig()
+	sc.Init()
+	sc.NodeName = config.NodeName
+	sc.Tags = map[string]string{raftAddrTag: config.RaftAddr, httpAddrTag: config.HTTPAddr}
+	sc.EventCh = m.events
+	sc.Logger = logger
+	sc.MemberlistConfig.BindAddr = host
+	sc.MemberlistConfig.BindPort = port
+	sc.MemberlistConfig.Logger = logger
+	if m.serf, err = serf.Create(sc); err != nil {
+		return nil, err
+	}
+	go m.run()
+	if len(config.StartJoinAddrs) > 0 {
+		if _, err := m.serf.Join(config.StartJoinAddrs, true); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Membership) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.reconcile()
+		case e := <-m.events:
+			switch e := e.(type) {
+			case serf.MemberEvent:
+				m.handleMemberEvent(e)
+			}
+		}
+	}
+}
+
+func (m *Membership) handleMemberEvent(e serf.MemberEvent) {
+	for _, member := range e.Members {
+		if m.isLocal(member) {
+			continue
+		}
+		switch e.Type {
+		case serf.EventMemberJoin, serf.EventMemberUpdate:
+			m.join(member)
+		case serf.EventMemberLeave, serf.EventMemberReap:
+			m.leave(member.Name)
+		}
+	}
+}
+
+// reconcile은 살아있는 노드를 모두 handler에 다시 알린다. handler.Join은 이미 있는 노드면 아무 일도 하지 않는다.
+// 리더가 떠날 때처럼 leave 이벤트를 받은 노드가 리더가 아니었으면 떠난 노드가 Raft 구성에 남으므로,
+// 새 리더가 Serf에서 left인 노드를 다시 정리한다.
+func (m *Membership) reconcile() {
+	left := make(map[string]bool)
+	for _, member := range m.serf.Members() {
+		if m.isLocal(member) {
+			continue
+		}
+		switch member.Status {
+		case serf.StatusAlive:
+			m.join(member)
+		case serf.StatusLeft:
+			left[member.Name] = true
+		}
+	}
+	c, ok := m.handler.(interface{ Servers() ([]Server, error) })
+	if !ok || len(left) == 0 {
+		return
+	}
+	servers, err := c.Servers()
+	if err != nil {
+		return
+	}
+	for _, srv := range servers {
+		if left[srv.ID] {
+			m.leave(srv.ID)
+		}
+	}
+}
+
+func (m *Membership) join(member serf.Member) {
+	raftAddr := member.Tags[raftAddrTag]
+	if raftAddr == "" {
+		return
+	}
+	m.logError(m.handler.Join(member.Name, raftAddr, member.Tags[httpAddrTag]), "join", member.Name)
+}
+
+func (m *Membership) leave(name string) {
+	m.logError(m.handler.Leave(name), "leave", name)
+}
+
+// logError는 리더가 아니라서 생긴 에러는 리더가 처리할 것이므로 무시한다.
+func (m *Membership) logError(err error, op, name string) {
+	if err == nil || errors.Is(err, ErrNotLeader) {
+		return
+	}
+	m.config.Logger.Warn("failed to update raft membership",
+		slog.String("op", op),
+		slog.String("member", name),
+		slog.Any("error", err),
+	)
+}
+
+func (m *Membership) isLocal(member serf.Member) bool {
+	return member.Name == m.serf.LocalMember().Name
+}
+
+// Members는 Serf가 알고 있는 노드들을 리턴한다. 떠났거나 응답이 없는 노드도 정리되기 전까지는 포함된다.
+// handler가 Servers를 구현하면 Raft 구성을 보고 노드마다 Role을 채운다.
+func (m *Membership) Members() ([]Member, error) {
+	roles := make(map[string]string)
+	if c, ok := m.handler.(interface{ Servers() ([]Server, error) }); ok {
+		servers, err := c.Servers()
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range servers {
+			roles[srv.ID] = roleFollower
+			if srv.Leader {
+				roles[srv.ID] = roleLeader
+			}
+		}
+	}
+	var members []Member
+	for _, member := range m.serf.Members() {
+		members = append(members, Member{
+			Name:     member.Name,
+			Addr:     net.JoinHostPort(member.Addr.String(), strconv.Itoa(int(member.Port))),
+			RaftAddr: member.Tags[raftAddrTag],
+			HTTPAddr: member.Tags[httpAddrTag],
+			Status:   member.Status.String(),
+			Role:     roles[member.Name],
+		})
+	}
+	return members, nil
+}
+
+// Leave는 다른 노드에게 이 노드가 떠난다고 알린다. 리더가 받으면 이 노드를 Raft 구성에서 뺀다.
+func (m *Membership) Leave() error {
+	return m.serf.Leave()
+}
+
+// Close는 이벤트 처리를 멈추고 Serf를 종료한다. 먼저 Leave를 호출하지 않으면 다른 노드는 이 노드가 실패한 것으로 본다.
+func (m *Membership) Close() error {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+	return m.serf.Shutdown()
+}
+
+type MembersResponse struct {
+	Members []Member `json:"members"`
+}
+
+// members 핸들러는 Serf가 알고 있는 노드들과 각 노드의 상태, Raft에서의 역할을 응답한다.
+func (s *httpServer) handleMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := s.membership.Members()
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(MembersResponse{Members: members}); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
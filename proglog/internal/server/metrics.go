@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics는 서버마다 별도의 레지스트리를 가진다.
+// 기본 레지스트리를 쓰면 한 프로세스에서 서버를 여러 개 만들 때 중복 등록으로 패닉이 나기 때문이다.
+type metrics struct {
+	registry *prometheus.Registry
+
+	recordsAppended prometheus.Counter
+	recordsRead     prometheus.Counter
+	// requestsForwarded는 팔로워가 리더에게 전달한 쓰기 요청 수다
+	requestsForwarded prometheus.Counter
+	// auditErrors는 AuditLogger가 기록하지 못한 감사 이벤트 수다
+	auditErrors prometheus.Counter
+	errors      *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		recordsAppended: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proglog_records_appended_total",
+			Help: "Number of records appended to the log.",
+		}),
+		recordsRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proglog_records_read_total",
+			Help: "Number of records read from the log.",
+		}),
+		requestsForwarded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proglog_requests_forwarded_total",
+			Help: "Number of write requests a follower forwarded to the leader.",
+		}),
+		auditErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proglog_audit_errors_total",
+			Help: "Number of audit events the audit logger failed to record.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proglog_http_errors_total",
+			Help: "Number of error responses by status code.",
+		}, []string{"code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proglog_http_request_duration_seconds",
+			Help:    "Handler latency in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"handler"}),
+	}
+	m.registry.MustRegister(
+		m.recordsAppended,
+		m.recordsRead,
+		m.requestsForwarded,
+		m.auditErrors,
+		m.errors,
+		m.latency,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// observeAppendQueue는 처리 중인 쓰기 요청 수를 게이지로 내보낸다. 제한하지 않으면 항상 0이다.
+func (m *metrics) observeAppendQueue(q *appendQueue) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proglog_append_queue_depth",
+		Help: "Number of write requests currently being processed.",
+	}, func() float64 {
+		return float64(q.depth())
+	}))
+}
+
+// observeAppendPool은 append 워커를 기다리는 produce 요청 수를 게이지로 내보낸다. 워커를 쓰지 않으면 항상 0이다.
+func (m *metrics) observeAppendPool(p *appendPool) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proglog_append_pool_queue_depth",
+		Help: "Number of produce requests waiting for an append worker.",
+	}, func() float64 {
+		return float64(p.depth())
+	}))
+}
+
+// observeLogSize는 기본 Log가 차지하는 바이트 수를 게이지로 내보낸다. 크기를 알려주지 않는 백엔드이면 등록하지 않는다.
+func (m *metrics) observeLogSize(log CommitLog) {
+	if _, ok := sizeBytes(log); !ok {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proglog_log_size_bytes",
+		Help: "Bytes used by the default log's segments.",
+	}, func() float64 {
+		n, _ := sizeBytes(log)
+		return float64(n)
+	}))
+}
+
+// Handler는 /metrics 엔드포인트에서 사용할 핸들러를 리턴한다.
+func (m *metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observe는 핸들러 시작 시점을 받아서 지연 시간을 기록한다. defer와 함께 사용한다.
+func (m *metrics) observe(handler string, start time.Time) {
+	m.latency.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+}
+
+// httpError는 err를 JSON 에러 응답으로 보내면서 상태 코드별 에러 카운터를 증가시킨다.
+// 응답의 code는 errorCode로 정한다. 바디를 읽다가 WithMaxBodyBytes의 제한에 걸린 에러이면
+// 핸들러가 넘긴 상태 코드와 상관없이 413(request_too_large)으로 응답한다.
+func (s *httpServer) httpError(w http.ResponseWriter, err error, status int) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		err, status = requestTooLarge(maxBytesErr.Limit), http.StatusRequestEntityTooLarge
+	}
+	s.metrics.errors.WithLabelValues(strconv.Itoa(status)).Inc()
+	writeError(w, status, errorCode(err, status), err.Error())
+}
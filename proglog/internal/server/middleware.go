@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware는 핸들러를 감싸서 요청 앞뒤에 동작을 더하는 함수다.
+type Middleware func(http.Handler) http.Handler
+
+// Chain은 mw를 하나의 Middleware로 합친다. 앞에 있는 것이 바깥쪽이라 요청을 먼저 받고 응답을 마지막에 본다.
+// Chain(a, b)(h)는 a(b(h))와 같다.
+func Chain(mw ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
+
+// responseRecorder는 http.ResponseWriter를 감싸서 상태 코드와 응답 크기를 기록한다.
+// stream 핸들러가 flush 할 수 있도록 http.Flusher도 그대로 전달한다.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += n
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap은 http.ResponseController가 원래의 ResponseWriter에 접근할 수 있게 한다.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ErrRequestTooLarge는 요청 바디가 WithMaxBodyBytes의 제한보다 클 때 413과 함께 리턴한다.
+var ErrRequestTooLarge = errors.New("request body too large")
+
+func requestTooLarge(limit int64) error {
+	return fmt.Errorf("%w: limit is %d bytes", ErrRequestTooLarge, limit)
+}
+
+// limitBody는 요청 바디를 n 바이트까지만 읽도록 http.MaxBytesReader로 감싼다.
+// Content-Length로 넘는 것을 알 수 있으면 바로 413을 반환하고, chunked 바디는 핸들러가 읽다가 에러를 받는다.
+// 핸들러는 그 에러를 어떤 상태 코드로 넘기든 httpError가 413으로 바꾸고, MaxBytesReader가 연결을 닫게 한다.
+func (s *httpServer) limitBody(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				w.Header().Set("Connection", "close")
+				s.httpError(w, requestTooLarge(n), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logRequests는 모든 요청의 메서드, 경로, 상태 코드, 응답 크기, 처리 시간을 구조화된 로그로 남긴다.
+func logRequests(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		logger.Info("request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("size", rec.size),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// recoverPanics는 핸들러에서 패닉이 일어나도 서버가 죽지 않도록 복구하고,
+// 스택을 로그로 남긴 뒤 클라이언트에 500 JSON 에러를 반환한다.
+// http.ErrAbortHandler는 응답을 중단하려고 일부러 일으킨 패닉이므로 그대로 다시 일으킨다.
+func recoverPanics(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			logger.Error("panic recovered",
+				slog.Any("error", err),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("stack", string(debug.Stack())),
+			)
+			writeError(w, http.StatusInternalServerError, "internal_server_error", "internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
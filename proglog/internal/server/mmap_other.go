@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap을 지원하지 않는 플랫폼에서는 store가 ReadAt으로 읽는다.
+func mmapFile(f *os.File, length int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func munmap(b []byte) error {
+	return nil
+}
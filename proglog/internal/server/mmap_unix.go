@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile은 f의 처음부터 length 바이트를 읽기 전용으로 메모리에 매핑한다.
+// 파일보다 길게 매핑해도 되지만, 파일 끝을 넘는 부분에 접근하면 SIGBUS가 나므로 store의 크기 안에서만 읽는다.
+func mmapFile(f *os.File, length int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, length, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
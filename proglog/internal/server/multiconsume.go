@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrTooManyOffsets는 consume-multi 요청의 오프셋 수가 WithMaxConsumeOffsets의 제한을 넘을 때 리턴한다.
+var ErrTooManyOffsets = errors.New("too many offsets")
+
+// WithMaxConsumeOffsets를 지정하지 않았을 때 consume-multi 요청 하나에 넣을 수 있는 오프셋 수
+const defaultMaxConsumeOffsets = 1000
+
+// ConsumeMultiRequest는 읽을 오프셋들이고, 순서가 없어도 되고 같은 오프셋이 여러 번 와도 된다.
+type ConsumeMultiRequest struct {
+	Offsets []uint64 `json:"offsets"`
+}
+
+// ConsumeMultiResult는 오프셋 하나를 읽은 결과다. Status는 그 오프셋만 GET /consume으로 읽었을 때의 상태 코드이고,
+// 200이면 Record가, 아니면 Error가 있다.
+type ConsumeMultiResult struct {
+	Offset uint64       `json:"offset"`
+	Status int          `json:"status"`
+	Record *Record      `json:"record,omitempty"`
+	Error  *ErrorDetail `json:"error,omitempty"`
+}
+
+// ConsumeMultiResponse의 Results는 요청한 오프셋과 같은 순서다.
+type ConsumeMultiResponse struct {
+	Results []ConsumeMultiResult `json:"results"`
+}
+
+// consume multi 핸들러는 흩어져 있는 오프셋들을 한 번에 읽는다. 다른 곳에 저장해둔 오프셋 참조를 한꺼번에 풀 때 쓴다.
+// 없는 오프셋이 있어도 요청 전체를 실패시키지 않고 그 오프셋의 결과에 404와 에러를 담는다.
+// 요청의 컨텍스트가 끝나면 읽기를 멈추고 요청 전체를 실패시킨다.
+func (s *httpServer) handleConsumeMulti(w http.ResponseWriter, r *http.Request) {
+	defer s.metrics.observe("consume_multi", time.Now())
+	var req ConsumeMultiRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if s.maxConsumeOffsets > 0 && len(req.Offsets) > s.maxConsumeOffsets {
+		err := fmt.Errorf("%w: %d offsets, at most %d per request", ErrTooManyOffsets, len(req.Offsets), s.maxConsumeOffsets)
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	log := s.logFor(r)
+	res := ConsumeMultiResponse{Results: make([]ConsumeMultiResult, len(req.Offsets))}
+	for i, off := range req.Offsets {
+		record, err := readContext(r.Context(), log, off)
+		if code, ok := contextErrorStatus(err); ok {
+			s.httpError(w, err, code)
+			return
+		}
+		res.Results[i] = consumeMultiResult(off, record, err)
+		if err == nil {
+			s.metrics.recordsRead.Inc()
+		}
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// consumeMultiResult는 handleConsume과 같은 기준으로 오프셋 하나를 읽은 결과의 상태 코드를 정한다.
+func consumeMultiResult(offset uint64, record Record, err error) ConsumeMultiResult {
+	if err == nil {
+		return ConsumeMultiResult{Offset: offset, Status: http.StatusOK, Record: &record}
+	}
+	status := http.StatusInternalServerError
+	if err == ErrOffsetNotFound || err == ErrOffsetOutOfRange || err == ErrOffsetCompacted || err == ErrRecordExpired {
+		status = http.StatusNotFound
+	}
+	return ConsumeMultiResult{
+		Offset: offset,
+		Status: status,
+		Error:  &ErrorDetail{Code: errorCode(err, status), Message: err.Error()},
+	}
+}
@@ -0,0 +1,515 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option은 NewHTTPServer의 동작을 바꾸는 함수형 옵션이다.
+// 옵션을 하나도 넘기지 않으면 기존과 똑같이 동작한다.
+type Option func(*options)
+
+// validate는 함께 쓸 수 없거나 범위를 벗어난 옵션을 찾는다. 파일을 읽는 옵션은 NewHTTPServerE가 열 때 확인한다.
+func (o options) validate() error {
+	switch {
+	case (o.certFile == "") != (o.keyFile == ""):
+		return errors.New("TLS requires both a certificate and a key file")
+	case o.clientCAs != nil && o.certFile == "":
+		return errors.New("client CAs require TLS")
+	case o.maxRecordBytes < 0:
+		return fmt.Errorf("max record bytes must not be negative: %d", o.maxRecordBytes)
+	case o.maxHeaderBytes < 0:
+		return fmt.Errorf("max header bytes must not be negative: %d", o.maxHeaderBytes)
+	case o.maxBodyBytes < 0:
+		return fmt.Errorf("max body bytes must not be negative: %d", o.maxBodyBytes)
+	case o.readTimeout < 0 || o.writeTimeout < 0:
+		return errors.New("read and write timeouts must not be negative")
+	case o.produceTimeout < 0 || o.consumeTimeout < 0 || o.longPollTimeout < 0:
+		return errors.New("request timeouts must not be negative")
+	case o.expirySweep < 0:
+		return fmt.Errorf("expiry sweep interval must not be negative: %s", o.expirySweep)
+	case o.deadLetterAttempts < 0:
+		return fmt.Errorf("dead letter attempts must not be negative: %d", o.deadLetterAttempts)
+	}
+	if o.storeCompression != nil {
+		if _, err := o.storeCompression.compress(nil); err != nil {
+			return err
+		}
+	}
+	switch len(o.encryptionKey) {
+	case 0, 16, 24, 32:
+	default:
+		return fmt.Errorf("%w: want 16, 24 or 32 bytes, got %d", ErrInvalidEncryptionKey, len(o.encryptionKey))
+	}
+	return nil
+}
+
+type options struct {
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	maxRecordBytes int
+	logger         *slog.Logger
+	log            CommitLog
+	certFile       string
+	keyFile        string
+	clientCAs      *x509.CertPool
+	authorizer     Authorizer
+	produceLimiter *rateLimiter
+	consumeLimiter *rateLimiter
+
+	retention            time.Duration
+	retentionInterval    time.Duration
+	maxRecords           uint64
+	truncateEnabled      bool
+	topicDeletionEnabled bool
+	snapshotEnabled      bool
+	readOnly             bool
+	fsync                *FsyncPolicy
+	storeCompression     *Codec
+	encryptionKey        []byte
+
+	idempotencyCacheSize int
+	idempotencyTTL       time.Duration
+
+	compactionInterval time.Duration
+	expirySweep        time.Duration
+
+	gzipMinBytes int
+	profiling    bool
+
+	tracerProvider trace.TracerProvider
+
+	membership *Membership
+
+	maxInFlightAppends int
+	appendWorkers      int
+	webhooks           bool
+	deadLetterAttempts int
+
+	leaderRedirect   bool
+	forwardTransport http.RoundTripper
+
+	maxConsumeOffsets int
+
+	pathPrefix          string
+	healthOutsidePrefix bool
+
+	auditLogger AuditLogger
+
+	tokenVerifier    TokenVerifier
+	passwordVerifier PasswordVerifier
+
+	maxHeaderBytes int
+	maxBodyBytes   int64
+
+	produceTimeout  time.Duration
+	consumeTimeout  time.Duration
+	longPollTimeout time.Duration
+
+	backuper Backuper
+
+	h2c bool
+
+	corsOrigins []string
+}
+
+// WithReadTimeout은 http.Server의 ReadTimeout을 설정한다.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout은 http.Server의 WriteTimeout을 설정한다.
+// stream 엔드포인트처럼 오래 유지되는 응답도 이 시간이 지나면 끊긴다는 점에 주의한다.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithMaxRecordBytes는 레코드 값의 최대 바이트 수를 설정한다. 0이면 제한하지 않는다.
+func WithMaxRecordBytes(n int) Option {
+	return func(o *options) {
+		o.maxRecordBytes = n
+	}
+}
+
+// WithLogger는 요청 로그를 남길 로거를 설정한다. 지정하지 않으면 slog.Default()를 사용한다.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithLog는 서버가 사용할 로그 백엔드를 지정한다. 지정하지 않으면 새 메모리 Log를 만든다.
+// gRPC 서버와 같은 Log를 공유하거나 영속 Log나 다른 CommitLog 구현을 사용할 때 쓴다.
+func WithLog(log CommitLog) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithTLS는 인증서와 키 파일로 TLS를 사용하도록 설정한다.
+// 지정하지 않으면 로컬 개발을 위해 평문 HTTP를 사용한다.
+// 파일을 읽을 수 없으면 NewHTTPServerE가 에러를 리턴하고, NewHTTPServer는 패닉을 일으킨다.
+func WithTLS(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithClientCAs는 클라이언트 인증서를 요구하고 pool의 CA로 검증하도록 설정한다(mTLS).
+// WithTLS와 함께 사용해야 하며, 검증된 클라이언트의 CommonName은 SubjectFromContext로 얻을 수 있다.
+func WithClientCAs(pool *x509.CertPool) Option {
+	return func(o *options) {
+		o.clientCAs = pool
+	}
+}
+
+// WithAuthorizer는 produce와 consume 요청의 권한을 확인할 Authorizer를 설정한다.
+// 지정하지 않으면 권한을 확인하지 않는다.
+func WithAuthorizer(a Authorizer) Option {
+	return func(o *options) {
+		o.authorizer = a
+	}
+}
+
+// WithProduceRateLimit는 클라이언트 주소마다 produce 요청을 초당 perSecond개, 최대 burst개까지 허용한다.
+func WithProduceRateLimit(perSecond float64, burst int) Option {
+	return func(o *options) {
+		o.produceLimiter = newRateLimiter(perSecond, burst)
+	}
+}
+
+// WithConsumeRateLimit는 consume 요청에 produce와 별개의 속도 제한을 건다.
+// 읽기는 쓰기보다 가벼우므로 보통 produce보다 높게 설정한다. 지정하지 않으면 제한하지 않는다.
+func WithConsumeRateLimit(perSecond float64, burst int) Option {
+	return func(o *options) {
+		o.consumeLimiter = newRateLimiter(perSecond, burst)
+	}
+}
+
+// WithRetention은 마지막 레코드가 maxAge보다 오래된 세그먼트를 주기적으로 삭제하도록 설정한다.
+// 세그먼트 단위로 삭제하므로 maxAge보다 오래된 레코드라도 같은 세그먼트에 새 레코드가 있으면 남는다.
+func WithRetention(maxAge time.Duration) Option {
+	return func(o *options) {
+		o.retention = maxAge
+	}
+}
+
+// WithRetentionInterval은 보존 정책을 확인하는 간격을 설정한다. 기본값은 1분이다.
+func WithRetentionInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.retentionInterval = d
+	}
+}
+
+// WithMaxRecords는 최대 n개의 레코드만 보관하고, 넘치면 Append할 때 가장 오래된 레코드부터 잘라낸다.
+// 잘린 오프셋은 바로 읽을 수 없게 되지만, 디스크의 세그먼트 파일은 세그먼트의 모든 레코드가
+// 잘린 뒤에 삭제되므로 디스크에는 최대 세그먼트 하나 분량의 레코드가 더 남아있을 수 있다.
+// 재시작하면 남아있던 세그먼트의 첫 오프셋부터 다시 읽을 수 있다.
+func WithMaxRecords(n uint64) Option {
+	return func(o *options) {
+		o.maxRecords = n
+	}
+}
+
+// WithFsync는 Log와 토픽 Log의 fsync 정책을 설정한다. 지정하지 않으면 Log의 Config.Fsync를 그대로 쓰고,
+// 그 기본값은 1초마다 fsync 하는 FsyncInterval이다. 정책마다 잃을 수 있는 레코드는 FsyncPolicy를 참고한다.
+func WithFsync(policy FsyncPolicy) Option {
+	return func(o *options) {
+		o.fsync = &policy
+	}
+}
+
+// WithStoreCompression은 Log와 토픽 Log가 새로 만드는 세그먼트의 레코드를 codec으로 압축하게 한다.
+// 지정하지 않으면 Log의 Config.Segment.Compression을 그대로 쓴다. 이미 레코드가 있는 세그먼트는 만들 때의 방식으로 계속 읽는다.
+// 응답을 gzip으로 보내는 WithCompression과는 다른 옵션이다.
+func WithStoreCompression(codec Codec) Option {
+	return func(o *options) {
+		o.storeCompression = &codec
+	}
+}
+
+// WithEncryption은 Log와 토픽 Log가 새로 만드는 세그먼트의 레코드를 key로 AES-GCM 암호화하게 한다. key는 16, 24, 32바이트 중 하나여야 한다.
+// 서버가 여는 토픽 Log는 이 키로 열지만, WithLog로 준 Log에 이미 암호화한 세그먼트가 있다면 NewLogWithConfig에 같은 키를 줘서 열어야 한다.
+func WithEncryption(key []byte) Option {
+	return func(o *options) {
+		o.encryptionKey = key
+	}
+}
+
+// WithTruncateEnabled는 로그 전체를 삭제하는 DELETE / 와 DELETE /log 엔드포인트를 등록할지 정한다.
+// 테스트나 재구성 용도이므로 기본값은 false이고, 운영 환경에서는 켜지 않아야 한다. 토픽 삭제는 WithTopicDeletionEnabled로 따로 켠다.
+func WithTruncateEnabled(enabled bool) Option {
+	return func(o *options) {
+		o.truncateEnabled = enabled
+	}
+}
+
+// WithTopicDeletionEnabled는 토픽과 그 레코드를 모두 삭제하는 DELETE /topics/{topic} 엔드포인트를 등록할지 정한다.
+// 기본 로그는 건드리지 않으므로 truncate와 따로 켤 수 있다. 기본값은 false이고, Authorizer를 쓴다면 truncate 권한이 필요하다.
+func WithTopicDeletionEnabled(enabled bool) Option {
+	return func(o *options) {
+		o.topicDeletionEnabled = enabled
+	}
+}
+
+// WithSnapshotEnabled는 POST /snapshot과 POST /restore 엔드포인트를 등록할지 정한다. 기본값은 false다.
+// restore는 기존 레코드를 모두 지우므로 Authorizer를 쓴다면 snapshot 권한을 관리자에게만 준다.
+func WithSnapshotEnabled(enabled bool) Option {
+	return func(o *options) {
+		o.snapshotEnabled = enabled
+	}
+}
+
+// WithMaxInFlightAppends는 동시에 처리할 쓰기 요청 수를 n으로 제한한다. 기본값은 1024이고, 음수이면 제한하지 않는다.
+// 제한을 넘는 produce, batch, bulk 요청은 기다리지 않고 Retry-After와 함께 503(append_queue_full)을 반환하므로
+// 디스크가 느려져도 메모리는 n개의 요청 바디만큼만 쓴다. 처리 중인 요청 수는 proglog_append_queue_depth 메트릭으로 볼 수 있다.
+func WithMaxInFlightAppends(n int) Option {
+	return func(o *options) {
+		o.maxInFlightAppends = n
+	}
+}
+
+// WithAppendWorkers는 produce 요청의 레코드를 n개의 워커 고루틴이 추가하게 한다. 기본값 0은 요청 고루틴에서 바로 추가한다.
+// 동시 요청이 아주 많을 때 Log의 락을 다투는 고루틴을 n개로 줄인다. 요청은 워커를 기다리는 동안 취소되면 추가하지 않고,
+// 기다리는 요청 수는 proglog_append_pool_queue_depth 메트릭으로 볼 수 있다. 기다리는 요청 수는 WithMaxInFlightAppends로 제한된다.
+func WithAppendWorkers(n int) Option {
+	return func(o *options) {
+		o.appendWorkers = n
+	}
+}
+
+// WithWebhooks는 POST /subscriptions로 등록한 URL에 새 레코드를 POST 하는 웹훅을 켤지 정한다. 기본값은 false다.
+// 서버가 요청받은 아무 URL로나 레코드를 보내므로 구독을 만들고 지우는 요청은 Authorizer의 subscribe 권한이 필요하고,
+// 구독 목록은 read 권한으로 본다. 내부망에 있는 서버라면 subscribe 권한은 관리자에게만 준다.
+func WithWebhooks(enabled bool) Option {
+	return func(o *options) {
+		o.webhooks = enabled
+	}
+}
+
+// WithDeadLetter는 웹훅이 한 레코드를 attempts번 연속으로 전달하지 못하면 레코드와 실패 이유를 데드레터 로그에 남기고
+// 다음 레코드로 넘어가게 한다. 데드레터는 GET /deadletter로 본다. 기본값 0은 데드레터 없이 성공할 때까지 다시 보낸다.
+// 데드레터로 넘기면 연속 실패 횟수를 지우므로 데드레터 로그에 쓸 수 있는 동안에는 구독이 꺼지지 않는다.
+// WithWebhooks가 없으면 아무 효과가 없다. 데드레터 로그는 영속 Log라면 Log 디렉터리 안의 deadletter 디렉터리에 저장한다.
+func WithDeadLetter(attempts int) Option {
+	return func(o *options) {
+		o.deadLetterAttempts = attempts
+	}
+}
+
+// WithReadOnly는 서버를 읽기 전용으로 만든다. produce 요청은 405 에러를 반환하고 consume만 동작한다.
+// 리더/팔로워 구성에서 클라이언트의 쓰기를 거부하는 팔로워 노드를 위한 옵션이다.
+func WithReadOnly(readOnly bool) Option {
+	return func(o *options) {
+		o.readOnly = readOnly
+	}
+}
+
+// WithIdempotency는 Idempotency-Key를 기억할 캐시의 크기와 유지 시간을 설정한다.
+// 기본값은 10000개, 10분이다. 키는 ttl이 지나거나 더 최근의 키 size개에 밀려나면 잊혀지고,
+// 그 뒤에 같은 키로 재시도하면 레코드가 다시 추가된다.
+func WithIdempotency(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.idempotencyCacheSize = size
+		o.idempotencyTTL = ttl
+	}
+}
+
+// WithCompaction은 interval마다 로그를 컴팩션해서 키마다 가장 최근 레코드만 남기도록 설정한다.
+// 컴팩션하는 동안에는 Log의 쓰기 락을 잡으므로 너무 짧게 설정하지 않는다.
+func WithCompaction(interval time.Duration) Option {
+	return func(o *options) {
+		o.compactionInterval = interval
+	}
+}
+
+// WithExpirySweep은 interval마다 ExpireAt이 지난 레코드의 값을 지워서 디스크 공간을 돌려받는다. 0이면 스윕하지 않는다.
+// 스윕하지 않아도 만료된 레코드는 읽을 때 ErrRecordExpired가 되고, 스윕은 활성 세그먼트를 다시 쓰지 않으므로
+// 만료된 레코드의 공간은 그 세그먼트가 가득 차서 바뀐 뒤의 첫 스윕에서 돌아온다.
+func WithExpirySweep(interval time.Duration) Option {
+	return func(o *options) {
+		o.expirySweep = interval
+	}
+}
+
+// WithCompression은 Accept-Encoding: gzip을 보낸 클라이언트에게 minBytes 이상인 응답을 gzip으로 압축해서 보낸다.
+// minBytes보다 작은 응답은 압축해도 별로 줄지 않으므로 그대로 보낸다. 0 이하이면 압축하지 않는다.
+func WithCompression(minBytes int) Option {
+	return func(o *options) {
+		o.gzipMinBytes = minBytes
+	}
+}
+
+// WithProfiling은 net/http/pprof 핸들러를 /debug/pprof/ 에 등록할지 정한다. 기본값은 false다.
+// 프로파일에는 메모리 내용과 명령줄 인자 등 민감한 정보가 들어있으므로
+// 인증 없이 외부에 공개된 리스너에서는 절대 켜지 않아야 한다. Authorizer가 있으면 debug 권한을 확인한다.
+// CPU 프로파일은 seconds 파라미터만큼 응답이 이어지므로 WriteTimeout보다 짧게 요청해야 한다.
+func WithProfiling(enabled bool) Option {
+	return func(o *options) {
+		o.profiling = enabled
+	}
+}
+
+// WithTracerProvider는 요청과 produce, consume의 span을 만들 TracerProvider를 설정한다.
+// 지정하지 않으면 span을 만들지 않는 no-op TracerProvider를 사용하므로 tracing을 끄면 비용이 거의 없다.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithMembership은 GET /members로 m이 추적하는 노드들을 보여준다. 지정하지 않으면 /members를 등록하지 않는다.
+func WithMembership(m *Membership) Option {
+	return func(o *options) {
+		o.membership = m
+	}
+}
+
+// WithLeaderRedirect는 팔로워가 받은 쓰기 요청을 리더에게 전달하지 않고 리더 주소로 307 리다이렉트할지 정한다.
+// 기본값은 false로, 팔로워가 요청을 리더에게 전달하고 리더의 응답을 돌려준다.
+// 리다이렉트를 따라가는 클라이언트는 리더에 직접 보내므로 팔로워를 한 번 더 거치지 않는다.
+func WithLeaderRedirect(enabled bool) Option {
+	return func(o *options) {
+		o.leaderRedirect = enabled
+	}
+}
+
+// WithForwardTransport는 팔로워가 리더에게 쓰기 요청을 전달할 때 쓰는 RoundTripper를 설정한다.
+// 지정하지 않으면 http.DefaultTransport를 사용한다. 리더가 클라이언트 인증서를 요구하면 인증서를 담은 Transport를 넘긴다.
+func WithForwardTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.forwardTransport = rt
+	}
+}
+
+// WithPathPrefix는 모든 엔드포인트를 prefix 아래에 등록한다(예: /api/proglog/produce).
+// 게이트웨이 뒤에서 경로로 서비스를 나눌 때 쓴다. 기본값은 접두사 없음이다.
+func WithPathPrefix(prefix string) Option {
+	return func(o *options) {
+		o.pathPrefix = prefix
+	}
+}
+
+// WithHealthOutsidePrefix는 WithPathPrefix를 써도 /healthz, /readyz, /version, /metrics를 접두사 없이 등록한다.
+// 쿠버네티스 프로브나 Prometheus가 게이트웨이를 거치지 않고 파드에 직접 접속할 때 쓴다.
+func WithHealthOutsidePrefix(enabled bool) Option {
+	return func(o *options) {
+		o.healthOutsidePrefix = enabled
+	}
+}
+
+// WithMaxConsumeOffsets는 POST /consume-multi 요청 하나에 넣을 수 있는 오프셋 수를 n으로 제한한다.
+// 기본값은 1000이고, 음수이면 제한하지 않는다. 넘으면 400(too_many_offsets)을 반환한다.
+func WithMaxConsumeOffsets(n int) Option {
+	return func(o *options) {
+		o.maxConsumeOffsets = n
+	}
+}
+
+// WithAuditLogger는 produce와 consume 요청마다 누가, 언제, 무엇을 했고 결과가 어땠는지 a에 기록한다.
+// 권한이 없거나 rate limit에 걸려서 거절된 요청도 남긴다. 기록에 실패해도 요청은 그대로 처리하고 경고 로그를 남긴다.
+// 기본값은 nil이고, 감사 로그를 남기지 않는다.
+func WithAuditLogger(a AuditLogger) Option {
+	return func(o *options) {
+		o.auditLogger = a
+	}
+}
+
+// WithTokenVerifier는 mTLS 인증서가 없는 클라이언트에게 Authorization: Bearer 토큰을 요구하고 v로 확인한다.
+// 토큰의 subject는 인증서의 CommonName처럼 Authorizer와 감사 로그에 쓰인다. 토큰이 없거나 만료되었거나
+// 서명이 맞지 않으면 401을 반환하고, /healthz와 /readyz는 확인하지 않는다. 기본값은 nil이고, 토큰을 확인하지 않는다.
+func WithTokenVerifier(v TokenVerifier) Option {
+	return func(o *options) {
+		o.tokenVerifier = v
+	}
+}
+
+// WithBasicAuth는 mTLS 인증서가 없는 클라이언트에게 HTTP Basic 인증을 요구하고 v로 비밀번호를 확인한다.
+// 사용자 이름이 Authorizer와 감사 로그의 subject가 된다. 비밀번호가 평문으로 오가므로 TLS와 함께 쓴다.
+// WithTokenVerifier와 함께 쓰면 두 방식을 모두 받는다. /healthz와 /readyz는 확인하지 않는다.
+func WithBasicAuth(v PasswordVerifier) Option {
+	return func(o *options) {
+		o.passwordVerifier = v
+	}
+}
+
+// WithMaxHeaderBytes는 http.Server의 MaxHeaderBytes를 설정한다. 요청 줄과 헤더가 n 바이트를 넘으면
+// net/http가 핸들러를 부르지 않고 431을 응답한다. 0이면 http.DefaultMaxHeaderBytes(1MiB)다.
+func WithMaxHeaderBytes(n int) Option {
+	return func(o *options) {
+		o.maxHeaderBytes = n
+	}
+}
+
+// WithMaxBodyBytes는 모든 요청 바디를 n 바이트로 제한한다. 0이면 제한하지 않는다.
+// Content-Length가 n보다 크면 핸들러를 부르지 않고, 바디를 읽다가 넘으면 그때 413(request_too_large)을 반환한다.
+// produce의 레코드 크기 제한(WithMaxRecordBytes)과 별개로 bulk, batch, restore처럼 큰 바디를 받는 요청에도 적용되므로
+// 스냅숏을 복원한다면 스냅숏보다 크게 설정한다.
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithProduceTimeout은 produce, batch, 토픽 produce처럼 쓰는 요청 하나의 최대 처리 시간을 설정한다. 기본값 0은 제한하지 않는다.
+// 시간이 지나면 http.TimeoutHandler가 요청 컨텍스트를 취소하고 503(deadline_exceeded)을 반환한다.
+// 이미 Log에 추가된 레코드는 되돌리지 않으므로 클라이언트는 Idempotency-Key로 다시 시도한다. bulk와 NDJSON 바디는 제한하지 않는다.
+func WithProduceTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.produceTimeout = d
+	}
+}
+
+// WithConsumeTimeout은 consume, range, offsets처럼 읽는 요청 하나의 최대 처리 시간을 설정한다. 기본값 0은 제한하지 않는다.
+// wait 파라미터로 기다리는 요청은 WithLongPollTimeout을 따르고, stream과 export는 제한하지 않는다.
+func WithConsumeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.consumeTimeout = d
+	}
+}
+
+// WithLongPollTimeout은 wait 쿼리 파라미터로 레코드를 기다리는 consume 요청의 최대 처리 시간을 설정한다. 기본값 0은 제한하지 않는다.
+// wait은 최대 1분이므로 그보다 짧으면 기다리는 도중에 404 대신 503이 된다.
+func WithLongPollTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.longPollTimeout = d
+	}
+}
+
+// WithBackup은 POST /backup으로 b.Backup을 바로 실행할 수 있게 한다. 요청자는 backup 작업 권한이 있어야 한다.
+// 주기적인 백업은 서버가 아니라 b가 따로 실행한다. 기본값은 nil이고, /backup을 등록하지 않는다.
+func WithBackup(b Backuper) Option {
+	return func(o *options) {
+		o.backuper = b
+	}
+}
+
+// WithH2C는 평문 리스너에서 HTTP/1.1과 함께 TLS 없는 HTTP/2(h2c)를 받는다. 연결 하나에 여러 요청을 동시에 보낼 수 있으므로
+// stream처럼 오래 열어두는 요청이 많아도 연결이 늘지 않는다. golang.org/x/net/http2/h2c는 deprecated 되었으므로
+// http.Server.Protocols를 쓰고, 그래서 Upgrade: h2c 헤더로 올리는 방식은 받지 않고 처음부터 HTTP/2로 보내는(prior knowledge) 클라이언트만 받는다.
+// TLS 리스너는 이 옵션과 상관없이 ALPN으로 HTTP/2를 협상한다. 기본값은 false다.
+func WithH2C(enabled bool) Option {
+	return func(o *options) {
+		o.h2c = enabled
+	}
+}
+
+// WithCORS는 브라우저가 allowedOrigins에서 API를 직접 호출할 수 있도록 CORS 헤더를 붙이고 preflight OPTIONS에 204로 응답한다.
+// Origin은 https://ui.example.com처럼 스킴과 호스트(와 포트)로 적고, "*"는 모든 Origin을 허용한다. 메서드는 GET, POST, HEAD만 허용한다.
+// 기본값은 nil이고, CORS 헤더를 붙이지 않으므로 같은 Origin에서만 호출할 수 있다.
+func WithCORS(allowedOrigins []string) Option {
+	return func(o *options) {
+		o.corsOrigins = allowedOrigins
+	}
+}
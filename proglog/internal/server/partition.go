@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// 토픽 하나가 가질 수 있는 최대 파티션 수
+const maxPartitions = 1024
+
+var (
+	ErrPartitionNotFound = errors.New("partition not found")
+	ErrInvalidPartitions = errors.New("invalid partition count")
+	// ErrPartitionMismatch는 이미 있는 토픽을 다른 파티션 수로 만들려고 할 때 리턴한다.
+	ErrPartitionMismatch = errors.New("topic already exists with a different partition count")
+)
+
+// Topic은 여러 파티션으로 나뉜 토픽이다. 파티션마다 독립된 Log이므로
+// 오프셋은 파티션마다 0부터 따로 매겨지고, 순서도 파티션 안에서만 보장된다.
+// 같은 키의 레코드는 항상 같은 파티션에 추가되므로 키 단위의 순서는 유지된다.
+type Topic struct {
+	name       string
+	dir        string
+	partitions []*Log
+
+	// next는 키가 없는 레코드를 파티션에 돌아가면서 나눌 때 사용한다
+	next atomic.Uint64
+}
+
+func (t *Topic) Name() string {
+	return t.name
+}
+
+// Partitions는 토픽의 파티션 수를 리턴한다.
+func (t *Topic) Partitions() int {
+	return len(t.partitions)
+}
+
+// Partition은 i번 파티션의 Log를 리턴하고, 없으면 ErrPartitionNotFound를 리턴한다.
+func (t *Topic) Partition(i int) (*Log, error) {
+	if i < 0 || i >= len(t.partitions) {
+		return nil, ErrPartitionNotFound
+	}
+	return t.partitions[i], nil
+}
+
+func (t *Topic) close() error {
+	for _, log := range t.partitions {
+		if err := log.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartitionForKey는 키가 추가될 파티션 번호를 리턴한다.
+// 서버와 같은 파티션을 계산하려는 클라이언트는 이 함수를 사용하면 된다.
+// 키의 FNV-1a 해시를 partitions로 나눈 나머지이므로 파티션 수가 바뀌면 결과도 바뀐다.
+func PartitionForKey(key []byte, partitions int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(partitions))
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// 이보다 커진 버퍼는 풀에 돌려놓지 않는다. 큰 요청 하나 때문에 커진 버퍼를 계속 들고 있지 않기 위해서다.
+const maxPooledBufferBytes = 64 * 1024
+
+// bodyPool은 요청 바디를 읽어둘 버퍼를 재사용한다.
+var bodyPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBody() *bytes.Buffer {
+	return bodyPool.Get().(*bytes.Buffer)
+}
+
+func putBody(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBufferBytes {
+		return
+	}
+	b.Reset()
+	bodyPool.Put(b)
+}
+
+// jsonBuffer는 응답을 인코딩할 버퍼와 그 버퍼에 쓰는 Encoder를 함께 재사용한다.
+type jsonBuffer struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonBufferPool = sync.Pool{
+	New: func() any {
+		b := new(jsonBuffer)
+		b.enc = json.NewEncoder(&b.buf)
+		return b
+	},
+}
+
+func getJSONBuffer() *jsonBuffer {
+	return jsonBufferPool.Get().(*jsonBuffer)
+}
+
+func putJSONBuffer(b *jsonBuffer) {
+	if b.buf.Cap() > maxPooledBufferBytes {
+		return
+	}
+	b.buf.Reset()
+	jsonBufferPool.Put(b)
+}
+
+// produceRequestPool과 consumeRequestPool은 produce와 consume 핸들러의 요청 구조체를 재사용한다.
+// 디코딩한 값이 다음 요청에 섞이지 않도록 풀에 돌려놓기 전에 제로 값으로 되돌린다.
+var (
+	produceRequestPool = sync.Pool{New: func() any { return new(ProduceRequest) }}
+	consumeRequestPool = sync.Pool{New: func() any { return new(ConsumeRequest) }}
+)
+
+func getProduceRequest() *ProduceRequest {
+	return produceRequestPool.Get().(*ProduceRequest)
+}
+
+func putProduceRequest(req *ProduceRequest) {
+	*req = ProduceRequest{}
+	produceRequestPool.Put(req)
+}
+
+func getConsumeRequest() *ConsumeRequest {
+	return consumeRequestPool.Get().(*ConsumeRequest)
+}
+
+func putConsumeRequest(req *ConsumeRequest) {
+	*req = ConsumeRequest{}
+	consumeRequestPool.Put(req)
+}
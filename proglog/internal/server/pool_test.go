@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestHandler는 요청 로그를 남기지 않는 서버의 핸들러를 만든다. 테스트가 끝나면 서버를 셧다운한다.
+func newTestHandler(tb testing.TB, opts ...Option) http.Handler {
+	tb.Helper()
+	srv, err := NewHTTPServerE(":0", append([]Option{WithLogger(slog.New(slog.DiscardHandler))}, opts...)...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv.Handler
+}
+
+// produce와 consume 핸들러가 요청마다 할당하는 양을 잰다. 바디 버퍼, Encoder, 요청 구조체는 풀에서 다시 쓴다.
+func BenchmarkProduceHandler(b *testing.B) {
+	h := newTestHandler(b)
+	body := []byte(`{"record":{"value":"` + strings.Repeat("QUJD", 64) + `"}}`)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+			if w.Code != http.StatusCreated {
+				b.Errorf("produce: got %d: %s", w.Code, w.Body)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConsumeHandler(b *testing.B) {
+	log := NewLog()
+	for i := 0; i < 1000; i++ {
+		log.Append(Record{Value: bytes.Repeat([]byte("abc"), 64)})
+	}
+	h := newTestHandler(b, WithLog(log))
+	body := []byte(`{"offset":500}`)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				b.Errorf("consume: got %d: %s", w.Code, w.Body)
+				return
+			}
+		}
+	})
+}
+
+// 풀에서 다시 쓴 요청 구조체에 앞 요청의 필드가 남으면 키나 헤더가 없는 레코드에 다른 레코드의 값이 붙는다.
+func TestPooledRequestsDoNotLeak(t *testing.T) {
+	log := NewLog()
+	h := newTestHandler(t, WithLog(log))
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"record":{"value":"YQ=="}}`
+			if i%2 == 0 {
+				body = `{"record":{"value":"Yg==","key":"aw==","headers":{"h":"v"}}}`
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			if w.Code != http.StatusCreated {
+				t.Errorf("produce: got %d: %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for off := uint64(0); off < 200; off++ {
+		record, err := log.Read(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch string(record.Value) {
+		case "a":
+			if record.Key != nil || record.Headers != nil {
+				t.Fatalf("record %d without a key got key %q and headers %v", off, record.Key, record.Headers)
+			}
+		case "b":
+			if string(record.Key) != "k" || record.Headers["h"] != "v" {
+				t.Fatalf("record %d lost its key or headers: %+v", off, record)
+			}
+		default:
+			t.Fatalf("record %d: unexpected value %q", off, record.Value)
+		}
+	}
+
+	// consume 응답도 앞 응답의 내용이 섞이지 않아야 한다
+	for off := uint64(0); off < 200; off++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{"offset":`+strconv.FormatUint(off, 10)+`}`)))
+		var res ConsumeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("consume %d: %v: %s", off, err, w.Body)
+		}
+		if res.Record.Offset != off {
+			t.Fatalf("consume %d: got offset %d", off, res.Record.Offset)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ErrInvalidProduceArray는 produce 요청의 JSON 배열이 비어있거나 ProduceRequest 객체가 아닌 원소가 있을 때 감싸서 리턴한다.
+var ErrInvalidProduceArray = errors.New("invalid produce array")
+
+// produce 요청의 JSON 배열 하나에 넣을 수 있는 최대 원소 수.
+// 배열 바디는 레코드 하나의 바디 제한(maxProduceBodyBytes)의 이 배수까지만 읽는다.
+const maxProduceArrayRecords = 1000
+
+// peekJSONArray는 공백을 건너뛴 바디의 첫 바이트가 '['인지 본다. 읽은 바이트는 돌려놓으므로 r.Body는 처음부터 다시 읽힌다.
+// 바디가 비어있거나 읽지 못하면 false를 리턴하고, 에러는 뒤에서 바디를 다시 읽을 때 그대로 나온다.
+func peekJSONArray(r *http.Request) bool {
+	br := bufio.NewReader(r.Body)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, r.Body}
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.Discard(1)
+			continue
+		}
+		return b[0] == '['
+	}
+}
+
+// decodeProduceArray는 ProduceRequest의 JSON 배열을 레코드들로 디코딩한다.
+// 원소마다 record 필드가 있는 객체여야 하고, 레코드를 그대로 넣었거나 다른 타입이 섞여 있으면 몇 번째 원소인지 알려주는 에러를 리턴한다.
+// expectedOffset은 레코드 하나의 compare-and-append라서 배열에서는 쓸 수 없다.
+func decodeProduceArray(body io.Reader) ([]Record, error) {
+	var elems []json.RawMessage
+	if err := decodeJSON(body, &elems); err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("%w: array has no produce requests", ErrInvalidProduceArray)
+	}
+	if len(elems) > maxProduceArrayRecords {
+		return nil, fmt.Errorf("%w: %d produce requests, at most %d per array", ErrInvalidProduceArray, len(elems), maxProduceArrayRecords)
+	}
+	records := make([]Record, len(elems))
+	for i, elem := range elems {
+		if elem = bytes.TrimSpace(elem); len(elem) == 0 || elem[0] != '{' {
+			return nil, fmt.Errorf("%w: element %d is %s, not a produce request object", ErrInvalidProduceArray, i, jsonKind(elem))
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(elem, &fields); err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, jsonError(err))
+		}
+		if _, ok := fields["record"]; !ok {
+			return nil, fmt.Errorf("%w: element %d has no record field", ErrInvalidProduceArray, i)
+		}
+		if _, ok := fields["expectedOffset"]; ok {
+			return nil, fmt.Errorf("%w: element %d has expectedOffset, which is only supported for a single produce request", ErrInvalidProduceArray, i)
+		}
+		var req ProduceRequest
+		if err := json.Unmarshal(elem, &req); err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, jsonError(err))
+		}
+		records[i] = req.Record
+	}
+	return records, nil
+}
+
+// produce array 핸들러는 POST /에 JSON 배열로 온 ProduceRequest들을 순서대로 추가하고, 같은 순서의 ProduceResponse 배열을 201로 응답한다.
+// 배열 전체를 먼저 확인하므로 원소 하나라도 잘못되었거나 너무 크면 아무것도 추가하지 않는다.
+// 토픽 경로에서는 레코드마다 파티션을 정하고, 같은 파티션의 레코드는 AppendBatch로 한 번에 추가해서 오프셋이 이어진다.
+// 파티션 사이에는 원자성이 없으므로 일부 레코드만 추가한 뒤에 실패하면 207로 원소마다 결과를 응답하고,
+// 추가하지 못한 원소에는 error가 들어간다. 아무것도 추가하지 못했으면 레코드 하나의 produce와 같은 에러로 응답한다.
+// 응답 하나에 오프셋을 하나만 기억하는 Idempotency-Key는 배열과 함께 쓸 수 없다.
+// maxRecordBytes가 있으면 디코딩하기 전에 바디를 maxProduceArrayRecords개의 레코드 바디 크기까지만 읽고, 넘으면 413을 반환한다.
+func (s *httpServer) handleProduceArray(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(idempotencyKeyHeader) != "" {
+		err := fmt.Errorf("%w: %s is only supported for a single produce request", ErrInvalidProduceArray, idempotencyKeyHeader)
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if limit := s.maxProduceBodyBytes(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit*maxProduceArrayRecords)
+	}
+	records, err := decodeProduceArray(r.Body)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	for _, record := range records {
+		if err := s.checkRecordSize(record); err != nil {
+			s.httpError(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	// 파티션마다 레코드를 모으고, 응답에 원래 순서대로 넣을 수 있도록 원소의 위치를 기억한다
+	type batch struct {
+		log     CommitLog
+		records []Record
+		index   []int
+	}
+	var batches []*batch
+	byPartition := make(map[int]*batch)
+	res := make([]ProduceResponse, len(records))
+	for i, record := range records {
+		log, partition := s.produceTarget(r, record, "")
+		b, ok := byPartition[partition]
+		if !ok {
+			b = &batch{log: log}
+			byPartition[partition] = b
+			batches = append(batches, b)
+		}
+		b.records = append(b.records, record)
+		b.index = append(b.index, i)
+		res[i].Partition = partition
+	}
+
+	appended := make([]bool, len(records))
+	appendedAny := false
+	var failed error
+	for _, b := range batches {
+		offsets, err := appendBatch(b.log, b.records)
+		s.metrics.recordsAppended.Add(float64(len(offsets)))
+		for j, off := range offsets {
+			res[b.index[j]].Offset = off
+			appended[b.index[j]] = true
+		}
+		if len(offsets) > 0 {
+			if !appendedAny {
+				auditOffset(r, offsets[0])
+			}
+			appendedAny = true
+		}
+		if err == nil {
+			continue
+		}
+		if !appendedAny {
+			switch err {
+			case ErrReadOnly:
+				s.httpError(w, err, http.StatusMethodNotAllowed)
+			case ErrNotLeader:
+				s.notLeader(w, r)
+			default:
+				s.httpError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+		// 이미 추가한 레코드는 되돌릴 수 없으므로 남은 파티션은 시도하지 않고 어디까지 추가했는지 알려준다
+		failed = err
+		break
+	}
+
+	status := http.StatusCreated
+	if failed != nil {
+		status = http.StatusMultiStatus
+		detail := &ErrorDetail{Code: errorCode(failed, http.StatusInternalServerError), Message: failed.Error()}
+		for i := range res {
+			if !appended[i] {
+				res[i].Error = detail
+			}
+		}
+		s.metrics.errors.WithLabelValues(strconv.Itoa(status)).Inc()
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// jsonKind는 에러 메시지에 쓰도록 JSON 값의 종류를 알려준다.
+func jsonKind(v []byte) string {
+	if len(v) == 0 {
+		return "empty"
+	}
+	switch v[0] {
+	case '[':
+		return "an array"
+	case '"':
+		return "a string"
+	case 'n':
+		return "null"
+	case 't', 'f':
+		return "a boolean"
+	}
+	return "a number"
+}
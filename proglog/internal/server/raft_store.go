@@ -0,0 +1,370 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// raftStore는 Raft 로그와 Raft의 상태(현재 term, 투표한 노드 등)를 dir 디렉터리에 저장한다.
+// raft.LogStore와 raft.StableStore를 구현한다.
+//
+// Raft 로그는 log.store 파일에 store와 같은 형식(길이 + 체크섬 + JSON)으로 raftOp를 이어서 쓰고,
+// 열 때 처음부터 다시 적용해서 메모리의 entries를 만든다. StoreLogs 한 번이 레코드 하나이므로
+// 쓰다가 죽으면 그 호출의 엔트리가 모두 없거나 모두 남는다. 스냅숏 뒤에 앞쪽 엔트리가 지워지면 파일을 다시 쓴다.
+// 상태는 작고 드물게 바뀌므로 stable.json 파일 하나에 통째로 쓴다.
+type raftStore struct {
+	mu  sync.RWMutex
+	dir string
+
+	log     *store
+	entries []raft.Log // 인덱스가 1씩 커지는 엔트리들
+	garbage int        // 마지막으로 파일을 다시 쓴 뒤 지운 엔트리 수
+
+	stable map[string][]byte
+}
+
+var (
+	_ raft.LogStore          = (*raftStore)(nil)
+	_ raft.StableStore       = (*raftStore)(nil)
+	_ raft.MonotonicLogStore = (*raftStore)(nil)
+)
+
+// raftOp는 log.store 파일의 레코드 하나다. Logs를 추가하거나 DeleteMin부터 DeleteMax까지를 지운다.
+type raftOp struct {
+	Logs      []*raft.Log `json:"logs,omitempty"`
+	DeleteMin uint64      `json:"deleteMin,omitempty"`
+	DeleteMax uint64      `json:"deleteMax,omitempty"`
+}
+
+// 지운 엔트리가 이만큼 넘게 쌓이고 남은 엔트리보다 많아지면 log.store 파일을 다시 쓴다
+const raftStoreCompactThreshold = 1024
+
+// errRaftKeyNotFound는 StableStore에 없는 키를 읽을 때 리턴한다. raft가 메시지로 이 에러를 구분한다.
+var errRaftKeyNotFound = errors.New("not found")
+
+// newRaftStore는 dir 디렉터리의 log.store와 stable.json을 열거나 만든다.
+// log.store 끝에 쓰다 만 레코드가 있으면 잘라낸다.
+func newRaftStore(dir string) (*raftStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &raftStore{dir: dir, stable: make(map[string][]byte)}
+	b, err := os.ReadFile(s.stablePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &s.stable); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.stablePath(), err)
+		}
+	}
+	if err := s.openLog(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *raftStore) logPath() string {
+	return filepath.Join(s.dir, "log.store")
+}
+
+func (s *raftStore) stablePath() string {
+	return filepath.Join(s.dir, "stable.json")
+}
+
+// openLog는 log.store를 열고 레코드를 처음부터 적용한다.
+func (s *raftStore) openLog() error {
+	f, err := os.OpenFile(s.logPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.log, err = newStore(f); err != nil {
+		return err
+	}
+	var pos uint64
+	size := s.log.Size()
+	for pos < size {
+		end, err := s.log.recordEnd(pos)
+		if err == errPartialRecord {
+			return s.log.truncate(pos)
+		}
+		if err != nil {
+			return err
+		}
+		p, err := s.log.Read(pos)
+		if err == ErrCorruptRecord && end == size {
+			return s.log.truncate(pos)
+		}
+		if err != nil {
+			return err
+		}
+		var op raftOp
+		if err := json.Unmarshal(p, &op); err != nil {
+			return err
+		}
+		if err := s.apply(op); err != nil {
+			return err
+		}
+		pos = end
+	}
+	return nil
+}
+
+// apply는 op를 메모리의 entries에 반영한다.
+func (s *raftStore) apply(op raftOp) error {
+	if op.DeleteMax > 0 {
+		return s.deleteRange(op.DeleteMin, op.DeleteMax)
+	}
+	for _, l := range op.Logs {
+		if n := len(s.entries); n > 0 && l.Index != s.entries[n-1].Index+1 {
+			return fmt.Errorf("raft log index %d does not follow %d", l.Index, s.entries[n-1].Index)
+		}
+		s.entries = append(s.entries, *l)
+	}
+	return nil
+}
+
+// deleteRange는 lo부터 hi까지의 엔트리를 메모리에서 지운다.
+// raft는 스냅숏 뒤에 앞쪽을, 리더와 충돌하면 뒤쪽을 지우므로 가운데만 지우는 경우는 허용하지 않는다.
+func (s *raftStore) deleteRange(lo, hi uint64) error {
+	n := len(s.entries)
+	if n == 0 {
+		return nil
+	}
+	first, last := s.entries[0].Index, s.entries[n-1].Index
+	lo, hi = max(lo, first), min(hi, last)
+	if lo > hi {
+		return nil
+	}
+	switch {
+	case lo == first:
+		s.entries = s.entries[hi-first+1:]
+	case hi == last:
+		s.entries = s.entries[:lo-first]
+	default:
+		return fmt.Errorf("cannot delete raft log range [%d, %d] inside [%d, %d]", lo, hi, first, last)
+	}
+	s.garbage += int(hi - lo + 1)
+	return nil
+}
+
+func (s *raftStore) FirstIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.entries) == 0 {
+		return 0, nil
+	}
+	return s.entries[0].Index, nil
+}
+
+func (s *raftStore) LastIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.entries) == 0 {
+		return 0, nil
+	}
+	return s.entries[len(s.entries)-1].Index, nil
+}
+
+func (s *raftStore) GetLog(index uint64, log *raft.Log) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.entries) == 0 || index < s.entries[0].Index || index > s.entries[len(s.entries)-1].Index {
+		return raft.ErrLogNotFound
+	}
+	*log = s.entries[index-s.entries[0].Index]
+	return nil
+}
+
+func (s *raftStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs는 엔트리들을 파일에 쓰고 fsync 한 뒤에 리턴한다. raft는 리턴한 엔트리가 디스크에 있다고 가정한다.
+func (s *raftStore) StoreLogs(logs []*raft.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(logs) == 0 {
+		return nil
+	}
+	op := raftOp{Logs: logs}
+	// 메모리에 먼저 반영해서 인덱스가 이어지는지 확인하고, 파일에 쓰지 못하면 되돌린다
+	n := len(s.entries)
+	if err := s.apply(op); err != nil {
+		s.entries = s.entries[:n]
+		return err
+	}
+	if err := s.write(op); err != nil {
+		s.entries = s.entries[:n]
+		return err
+	}
+	return nil
+}
+
+// DeleteRange는 lo부터 hi까지의 엔트리를 지운다. 지운 엔트리가 충분히 쌓이면 파일을 남은 엔트리로 다시 쓴다.
+func (s *raftStore) DeleteRange(lo, hi uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.deleteRange(lo, hi); err != nil {
+		return err
+	}
+	if s.garbage > raftStoreCompactThreshold && s.garbage > len(s.entries) {
+		return s.rewrite()
+	}
+	return s.write(raftOp{DeleteMin: lo, DeleteMax: hi})
+}
+
+// IsMonotonic은 raft에게 엔트리 인덱스 사이에 빈 곳을 허용하지 않는다고 알린다.
+// 그러면 raft는 스냅숏을 복원한 뒤에 이전 엔트리를 모두 지운다.
+func (s *raftStore) IsMonotonic() bool {
+	return true
+}
+
+// write는 op를 파일에 쓰고 fsync 한다.
+func (s *raftStore) write(op raftOp) error {
+	p, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	if _, _, err := s.log.Append(p); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// rewrite는 남은 엔트리만 담은 임시 파일을 만든 뒤 log.store로 이름을 바꾼다.
+// 도중에 실패하면 원래 파일이 그대로 남는다.
+func (s *raftStore) rewrite() error {
+	tmp := s.logPath() + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	next, err := newStore(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	op := raftOp{Logs: make([]*raft.Log, len(s.entries))}
+	for i := range s.entries {
+		op.Logs[i] = &s.entries[i]
+	}
+	if len(op.Logs) > 0 {
+		p, err := json.Marshal(op)
+		if err != nil {
+			next.Close()
+			return err
+		}
+		if _, _, err := next.Append(p); err != nil {
+			next.Close()
+			return err
+		}
+	}
+	if err := next.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.logPath()); err != nil {
+		return err
+	}
+	if err := s.log.Close(); err != nil {
+		return err
+	}
+	f, err = os.OpenFile(s.logPath(), os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.log, err = newStore(f); err != nil {
+		return err
+	}
+	// 앞쪽을 잘라낸 슬라이스가 지운 엔트리를 계속 붙잡고 있지 않도록 복사한다
+	s.entries = append([]raft.Log(nil), s.entries...)
+	s.garbage = 0
+	return nil
+}
+
+func (s *raftStore) Set(key []byte, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.stable[string(key)]
+	s.stable[string(key)] = append([]byte(nil), val...)
+	if err := s.saveStable(); err != nil {
+		if existed {
+			s.stable[string(key)] = prev
+		} else {
+			delete(s.stable, string(key))
+		}
+		return err
+	}
+	return nil
+}
+
+// Get은 key의 값을 리턴하고, 없으면 raft가 기대하는 "not found" 에러를 리턴한다.
+func (s *raftStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.stable[string(key)]
+	if !ok {
+		return nil, errRaftKeyNotFound
+	}
+	return append([]byte(nil), val...), nil
+}
+
+func (s *raftStore) SetUint64(key []byte, val uint64) error {
+	var b [8]byte
+	enc.PutUint64(b[:], val)
+	return s.Set(key, b[:])
+}
+
+// GetUint64은 key가 없으면 raft.InmemStore처럼 0을 리턴한다.
+func (s *raftStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err == errRaftKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("raft stable key %q is not a uint64", key)
+	}
+	return enc.Uint64(val), nil
+}
+
+// saveStable은 상태를 임시 파일에 쓰고 fsync 한 뒤 이름을 바꾼다. 투표한 노드를 잊으면
+// 같은 term에 두 번 투표할 수 있으므로 리턴하기 전에 디스크에 있어야 한다.
+func (s *raftStore) saveStable() error {
+	b, err := json.Marshal(s.stable)
+	if err != nil {
+		return err
+	}
+	tmp := s.stablePath() + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.stablePath())
+}
+
+// Close는 log.store를 닫는다.
+func (s *raftStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.Close()
+}
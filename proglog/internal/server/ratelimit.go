@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 이 시간 동안 요청이 없던 클라이언트의 리미터는 정리한다
+const rateLimiterIdleTimeout = 3 * time.Minute
+
+// rateLimiter는 클라이언트 주소마다 토큰 버킷 리미터를 관리한다.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+	pruned  time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+		pruned:  time.Now(),
+	}
+}
+
+// allow는 key에 해당하는 클라이언트가 지금 요청할 수 있는지 확인한다.
+// 허용하지 않으면 다음 토큰이 생길 때까지 기다려야 하는 시간을 함께 리턴한다.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > rateLimiterIdleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	res := c.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Second
+	}
+	if d := res.DelayFrom(now); d > 0 {
+		res.CancelAt(now)
+		return false, d
+	}
+	return true, 0
+}
+
+// rateLimit은 핸들러를 감싸서 클라이언트 주소별로 요청 속도를 제한한다.
+// 제한을 넘으면 Retry-After 헤더와 함께 429 에러를 반환하고, limiter가 nil이면 제한하지 않는다.
+func (s *httpServer) rateLimit(l *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ok, wait := l.allow(host); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.httpError(w, errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Reader는 로그의 레코드를 가장 작은 오프셋부터 Reader를 호출한 시점의 마지막 레코드까지 이어 붙인 io.Reader를 리턴한다.
+// 세그먼트마다 reader를 만들어서 io.MultiReader로 잇기 때문에 io.Copy로 파일이나 소켓에 그대로 흘려보낼 수 있고,
+// 레코드를 하나씩 읽으므로 로그 전체를 메모리에 올리지 않는다. 그 뒤에 추가된 레코드는 포함하지 않는다.
+//
+// 형식은 /export 응답과 같은 NDJSON이다. 한 줄에 Record 하나를 JSON 객체로 쓰고 "\n"으로 끝낸다.
+// 값과 키는 base64 문자열이고, 컴팩션으로 지워진 오프셋은 줄이 없으므로 offset 필드로 위치를 확인한다.
+//
+//	{"value":"aGVsbG8=","offset":0,"timestamp":"2024-01-01T00:00:00Z"}
+//	{"value":"d29ybGQ=","offset":1,"timestamp":"2024-01-01T00:00:01Z","key":"dXNlci0x"}
+//
+// 읽는 도중에 보존 정책이나 Truncate로 레코드가 지워지면 Read가 ErrOffsetOutOfRange를 리턴한다.
+func (c *Log) Reader() io.Reader {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return errReader{ErrLogClosed}
+	}
+	end := c.activeSegment.next()
+	readers := make([]io.Reader, 0, len(c.segments))
+	for _, s := range c.segments {
+		next := min(s.next(), end)
+		if next <= c.lowest {
+			continue
+		}
+		it := &logIterator{log: c, next: max(s.baseOffset, c.lowest), end: next}
+		readers = append(readers, newRecordReader(it))
+	}
+	return io.MultiReader(readers...)
+}
+
+// recordReader는 RecordIterator의 레코드를 Reader와 같은 NDJSON으로 인코딩하면서 읽는다.
+// 한 번에 레코드 하나만 버퍼에 두고, n은 지금까지 인코딩한 레코드 수다.
+type recordReader struct {
+	it  RecordIterator
+	buf bytes.Buffer
+	enc *json.Encoder
+	n   int
+}
+
+func newRecordReader(it RecordIterator) *recordReader {
+	r := &recordReader{it: it}
+	r.enc = json.NewEncoder(&r.buf)
+	return r
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		record, ok := r.it.Next()
+		if !ok {
+			if err := r.it.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if err := r.enc.Encode(record); err != nil {
+			return 0, err
+		}
+		r.n++
+	}
+	return r.buf.Read(p)
+}
+
+// errReader는 읽을 때마다 err를 리턴한다.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// errPartialRecord는 레코드의 헤더나 데이터가 store의 끝을 넘어가는 경우이다.
+// 레코드를 쓰는 도중에 프로세스가 죽으면 마지막 레코드가 이렇게 남는다.
+var errPartialRecord = errors.New("partial record")
+
+// RecoveryInfo는 파일 Log를 열 때 store 파일을 처음부터 다시 읽은 결과다.
+// Records는 검증을 통과해서 다시 읽은 레코드 수이고,
+// TruncatedBytes는 끝까지 쓰이지 않은 마지막 레코드라서 잘라낸 바이트 수다.
+type RecoveryInfo struct {
+	Records        int
+	TruncatedBytes uint64
+}
+
+// Recovery는 Log를 열 때 복구한 결과를 리턴한다. 메모리 Log나 빈 디렉터리에서 연 Log는 제로 값이다.
+func (c *Log) Recovery() RecoveryInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.recovery
+}
+
+// load는 인덱스 파일에서 레코드의 오프셋과 위치를 복원하고, 인덱스에 없는 나머지 레코드는 store에서 읽는다.
+// 인덱스는 store보다 늦게 쓰이므로 store의 범위를 벗어나는 항목은 버린다.
+// 인덱스가 없거나 store와 맞지 않았으면 복원한 내용으로 인덱스 파일을 다시 쓴다.
+func (s *segment) load() (RecoveryInfo, error) {
+	offs, positions, err := s.index.entries()
+	if err != nil {
+		return RecoveryInfo{}, err
+	}
+	n := 0
+	for ; n < len(offs); n++ {
+		if n > 0 && (offs[n] <= offs[n-1] || positions[n] <= positions[n-1]) {
+			break
+		}
+		if positions[n] >= s.store.Size() {
+			break
+		}
+	}
+	// 마지막 항목의 레코드가 끝까지 쓰여있어야 그 뒤부터 store를 읽을 수 있다
+	var pos uint64
+	for ; n > 0; n-- {
+		end, err := s.store.recordEnd(positions[n-1])
+		if err == nil {
+			pos = end
+			break
+		}
+		if err != errPartialRecord {
+			return RecoveryInfo{}, err
+		}
+	}
+	for e := 0; e < n; e++ {
+		s.offsets = append(s.offsets, s.baseOffset+uint64(offs[e]))
+		s.positions = append(s.positions, positions[e])
+	}
+	if n > 0 {
+		s.nextOffset = s.offsets[n-1] + 1
+	}
+
+	info, err := s.recover(pos)
+	if err != nil {
+		return info, err
+	}
+	if n != len(offs) || len(s.offsets) != n {
+		if err := s.index.reset(s.baseOffset, s.offsets, s.positions); err != nil {
+			return info, err
+		}
+	}
+	info.Records = len(s.offsets)
+	return info, nil
+}
+
+// recover는 store를 pos부터 읽으면서 길이와 체크섬을 검증하고 오프셋과 위치를 복원한다.
+// 마지막 레코드가 끝까지 쓰이지 않았거나, 파일 끝에서 끝나는 마지막 레코드의 체크섬이 맞지 않으면
+// 쓰다가 죽은 레코드로 보고 그 레코드부터 잘라낸다. 그보다 앞에 있는 레코드가 손상되었으면
+// 데이터를 잃지 않도록 잘라내지 않고 ErrCorruptRecord를 리턴한다.
+func (s *segment) recover(pos uint64) (RecoveryInfo, error) {
+	var info RecoveryInfo
+	size := s.store.Size()
+	for pos < size {
+		end, err := s.store.recordEnd(pos)
+		if err == errPartialRecord {
+			return s.truncateStore(info, pos)
+		}
+		if err != nil {
+			return info, err
+		}
+		p, err := s.store.Read(pos)
+		if err == ErrCorruptRecord && end == size {
+			return s.truncateStore(info, pos)
+		}
+		if err != nil {
+			return info, err
+		}
+		record, err := s.decode(p)
+		if err != nil {
+			return info, err
+		}
+		s.offsets = append(s.offsets, record.Offset)
+		s.positions = append(s.positions, pos)
+		s.nextOffset = record.Offset + 1
+		info.Records++
+		pos = end
+	}
+	return info, nil
+}
+
+func (s *segment) truncateStore(info RecoveryInfo, pos uint64) (RecoveryInfo, error) {
+	info.TruncatedBytes = s.store.Size() - pos
+	return info, s.store.truncate(pos)
+}
+
+// logRecovery는 Log를 열 때 깨진 레코드를 잘라냈으면 경고 로그를 남긴다.
+func logRecovery(logger *slog.Logger, l *Log) {
+	r := l.Recovery()
+	if r.TruncatedBytes == 0 {
+		return
+	}
+	logger.Warn("truncated partial record while opening log",
+		slog.String("dir", l.Dir),
+		slog.Int("recovered", r.Records),
+		slog.Uint64("truncated_bytes", r.TruncatedBytes),
+	)
+}
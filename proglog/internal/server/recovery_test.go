@@ -0,0 +1,73 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 마지막 레코드를 쓰다가 죽은 것처럼 store 파일을 레코드 중간에서 자르면, 다시 열 때 그 레코드만 잘라내고 앞의 레코드는 그대로 읽어야 한다.
+func TestRecoverTornRecord(t *testing.T) {
+	for _, cut := range []struct {
+		name string
+		keep func(lastRecord int64) int64 // 마지막 레코드에서 남길 바이트 수
+	}{
+		{"in the header", func(int64) int64 { return lenWidth / 2 }},
+		{"in the data", func(n int64) int64 { return n - 3 }},
+	} {
+		t.Run(cut.name, func(t *testing.T) {
+			dir := t.TempDir()
+			log, err := NewPersistentLog(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []string{"one", "two", "three"} {
+				if _, err := log.Append(Record{Value: []byte(v)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 마지막 레코드가 시작하는 위치
+			last := log.segments[0].positions[2]
+			if err := log.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "0.store")
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lastSize := fi.Size() - int64(last)
+			if err := os.Truncate(path, int64(last)+cut.keep(lastSize)); err != nil {
+				t.Fatal(err)
+			}
+
+			log, err = NewPersistentLog(dir)
+			if err != nil {
+				t.Fatalf("open after a torn write: %v", err)
+			}
+			defer log.Close()
+			info := log.Recovery()
+			if info.Records != 2 || info.TruncatedBytes != uint64(cut.keep(lastSize)) {
+				t.Fatalf("recovery: got %+v, want 2 records and %d truncated bytes", info, cut.keep(lastSize))
+			}
+			if fi, err := os.Stat(path); err != nil || fi.Size() != int64(last) {
+				t.Fatalf("store size after recovery: got %v, %v, want %d", fi.Size(), err, last)
+			}
+			for off, want := range []string{"one", "two"} {
+				record, err := log.Read(uint64(off))
+				if err != nil || string(record.Value) != want {
+					t.Fatalf("read %d: got %q, %v, want %q", off, record.Value, err, want)
+				}
+			}
+			// 잘라낸 오프셋부터 다시 쓴다
+			off, err := log.Append(Record{Value: []byte("three again")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if off != 2 {
+				t.Fatalf("append after recovery: got offset %d, want 2", off)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+)
+
+const defaultRetentionInterval = time.Minute
+
+// retainer와 compactor는 보존 기간과 컴팩션을 지원하는 로그 백엔드가 구현한다.
+type retainer interface {
+	TruncateBefore(time.Time) error
+}
+
+type compactor interface {
+	Compact() error
+}
+
+// expirySweeper는 ExpireAt이 지난 레코드를 툼스톤으로 바꾸는 로그 백엔드가 구현한다.
+type expirySweeper interface {
+	SweepExpired(time.Time) (int, error)
+}
+
+// startRetention은 interval마다 maxAge보다 오래된 세그먼트를 삭제하는 고루틴을 시작한다.
+// 리턴된 함수를 호출하면 고루틴이 멈춘다.
+func startRetention(log retainer, logger *slog.Logger, maxAge, interval time.Duration) (stop func()) {
+	return every(interval, func() {
+		if err := log.TruncateBefore(time.Now().Add(-maxAge)); err != nil {
+			logger.Error("retention sweep failed", slog.Any("error", err))
+		}
+	})
+}
+
+// startCompaction은 interval마다 로그를 컴팩션하는 고루틴을 시작한다.
+func startCompaction(log compactor, logger *slog.Logger, interval time.Duration) (stop func()) {
+	return every(interval, func() {
+		if err := log.Compact(); err != nil {
+			logger.Error("compaction failed", slog.Any("error", err))
+		}
+	})
+}
+
+// startExpirySweep은 interval마다 log와 토픽의 파티션 Log에서 만료된 레코드를 툼스톤으로 바꾸는 고루틴을 시작한다.
+// log가 SweepExpired를 지원하지 않으면 토픽만 스윕한다. 스윕하는 도중에 삭제된 토픽은 건너뛴다.
+func startExpirySweep(log CommitLog, topics *TopicManager, logger *slog.Logger, interval time.Duration) (stop func()) {
+	return every(interval, func() {
+		now := time.Now()
+		sweep := func(l expirySweeper, topic string, partition int) {
+			n, err := l.SweepExpired(now)
+			if err != nil && err != ErrLogClosed {
+				logger.Error("expiry sweep failed", slog.String("topic", topic), slog.Int("partition", partition), slog.Any("error", err))
+			}
+			if n > 0 {
+				logger.Debug("expired records swept", slog.String("topic", topic), slog.Int("partition", partition), slog.Int("records", n))
+			}
+		}
+		if l, ok := log.(expirySweeper); ok {
+			sweep(l, DefaultTopic, 0)
+		}
+		for _, t := range topics.Topics() {
+			for i, p := range t.partitions {
+				sweep(p, t.Name(), i)
+			}
+		}
+	})
+}
+
+// every는 interval마다 fn을 실행하는 고루틴을 시작하고, 고루틴을 멈추는 함수를 리턴한다.
+func every(interval time.Duration, fn func()) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Run은 srv를 실행하다가 ctx가 취소되면 그레이스풀 셧다운을 한다.
+// 셧다운이 시작되면 리스너는 새 연결을 더 받지 않고, 처리 중인 요청은 grace 시간 동안 끝나기를 기다린다.
+// 셧다운 도중 이미 열려있는 연결로 들어온 새 요청에는 503을 반환한다.
+// 셧다운이 끝나면 NewHTTPServer가 직접 만든 토픽 Log와 기본 Log를 닫아서 버퍼에 남은 레코드를 디스크에 쓴다.
+// WithLog로 넘긴 Log는 호출자가 Run이 리턴한 뒤에 닫는다.
+func Run(ctx context.Context, srv *http.Server, grace time.Duration) error {
+	var draining atomic.Bool
+	closer, _ := srv.Handler.(io.Closer)
+	next := srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.Header().Set("Connection", "close")
+			writeError(w, http.StatusServiceUnavailable, "shutting_down", "server is shutting down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		// 인증서는 이미 TLSConfig에 들어있으므로 파일 이름은 비워서 넘긴다
+		if srv.TLSConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err == nil {
+		if serr := <-errc; !errors.Is(serr, http.ErrServerClosed) {
+			err = serr
+		}
+	}
+	// grace 시간이 지나서 셧다운이 실패해도 Log는 닫는다
+	if closer != nil {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closingHandler는 서버가 만든 자원을 Run이 셧다운을 마친 뒤에 닫을 수 있도록 핸들러에 붙여둔다.
+type closingHandler struct {
+	http.Handler
+	closers []io.Closer
+}
+
+// Close는 closers를 모두 닫고 첫 에러를 리턴한다.
+func (h closingHandler) Close() error {
+	var first error
+	for _, c := range h.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// OffsetForTimeResponse는 요청한 시각 이후에 추가된 첫 레코드의 오프셋을 담는다.
+type OffsetForTimeResponse struct {
+	Offset uint64 `json:"offset"`
+}
+
+// at 핸들러는 time 쿼리 파라미터(RFC 3339) 또는 그 이후에 추가된 가장 앞의 레코드 오프셋을 응답한다.
+// 컨슈머는 오프셋을 추측하지 않고 "5분 전"처럼 시각으로 읽기 시작할 위치를 찾을 수 있다.
+// 그 시각 이후의 레코드가 없으면 404 에러를 반환한다.
+func (s *httpServer) handleOffsetForTime(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query().Get("time")
+	if v == "" {
+		s.httpError(w, errors.New("missing time query parameter"), http.StatusBadRequest)
+		return
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	off, err := offsetForTime(s.logFor(r), t)
+	if err == ErrOffsetNotFound {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err == errors.ErrUnsupported {
+		s.httpError(w, err, http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(OffsetForTimeResponse{Offset: off})
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// segment는 store 하나와 그 store에 담긴 레코드들의 위치를 묶는다.
+// 파일 세그먼트는 레코드의 위치를 <baseOffset>.index 파일에도 기록해서 다시 열 때 store를 읽지 않고 복원한다.
+// baseOffset은 세그먼트의 첫 레코드 오프셋, nextOffset은 다음에 추가될 레코드의 오프셋이다.
+// offsets와 positions는 같은 인덱스끼리 레코드의 오프셋과 store 안의 위치를 담는다.
+// 컴팩션으로 레코드가 빠질 수 있으므로 오프셋은 연속적이지 않을 수 있다.
+// modTime은 마지막으로 레코드가 추가된 시각으로, 시간 기반 보존 정책에서 사용한다.
+// codec은 이 세그먼트의 레코드를 압축한 방식으로, 파일 세그먼트는 만들 때의 방식을 <baseOffset>.codec 파일에 기록한다.
+// aead가 있으면 압축한 레코드를 AES-GCM으로 암호화해서 쓴다.
+type segment struct {
+	// mu는 offsets, positions, nextOffset, modTime을 보호한다. 활성 세그먼트에 쓰는 동안 다른 세그먼트는 계속 읽을 수 있다.
+	// Log의 쓰기 락을 잡은 쪽은 쓰는 쪽이 없으므로 이 락 없이 접근해도 된다.
+	mu sync.RWMutex
+
+	dir                    string
+	store                  *store
+	index                  *index
+	offsets                []uint64
+	positions              []uint64
+	baseOffset, nextOffset uint64
+	config                 Config
+	modTime                time.Time
+	codec                  Codec
+	aead                   cipher.AEAD
+
+	// recovery는 파일에서 다시 열 때 복구한 결과다.
+	recovery RecoveryInfo
+
+	// swept는 SweepExpired가 이 세그먼트를 한 번 확인했는지, nextExpiry는 그때 남은 레코드의 가장 이른 ExpireAt이다.
+	// 만료될 레코드가 없으면 nextExpiry는 비어있다.
+	swept      bool
+	nextExpiry time.Time
+}
+
+// newSegment는 dir 디렉터리에 <baseOffset>.store 파일을 열거나 만들어서 세그먼트를 만든다.
+// dir이 비어있으면 메모리 store를 사용한다.
+// 파일에 이미 레코드가 있으면 다시 읽어서 오프셋과 nextOffset을 복원하고, 끝까지 쓰이지 않은 마지막 레코드는 잘라낸다.
+func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
+	s := &segment{
+		dir:        dir,
+		baseOffset: baseOffset,
+		nextOffset: baseOffset,
+		config:     c,
+		modTime:    time.Now(),
+	}
+	if dir == "" {
+		if err := s.useConfigured(c); err != nil {
+			return nil, err
+		}
+		s.store = newMemoryStore()
+		return s, nil
+	}
+
+	f, err := os.OpenFile(s.path(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if s.store, err = newStore(f); err != nil {
+		return nil, err
+	}
+	s.store.mmap = c.Segment.Mmap
+	if err := s.loadCodec(c); err != nil {
+		s.store.Close()
+		return nil, err
+	}
+	if s.index, err = openIndex(s.indexPath()); err != nil {
+		return nil, err
+	}
+	// 파일에서 다시 연 세그먼트는 파일의 수정 시각을 마지막 추가 시각으로 사용한다
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		s.modTime = fi.ModTime()
+	}
+	if s.recovery, err = s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *segment) path() string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.store", s.baseOffset))
+}
+
+func (s *segment) indexPath() string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.index", s.baseOffset))
+}
+
+func (s *segment) codecPath() string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.codec", s.baseOffset))
+}
+
+// Append는 레코드에 오프셋을 붙여서 store에 쓰고 그 오프셋을 리턴한다.
+func (s *segment) Append(record Record) (uint64, error) {
+	record.Offset = s.nextOffset
+	if err := s.write(record); err != nil {
+		return 0, err
+	}
+	s.nextOffset++
+	s.modTime = time.Now()
+	return record.Offset, nil
+}
+
+// write는 오프셋이 정해진 레코드를 store에 쓰고 위치를 기억한다.
+func (s *segment) write(record Record) error {
+	p, err := s.encode(record)
+	if err != nil {
+		return err
+	}
+	_, pos, err := s.store.Append(p)
+	if err != nil {
+		return err
+	}
+	if s.index != nil {
+		if err := s.index.Write(uint32(record.Offset-s.baseOffset), pos); err != nil {
+			return err
+		}
+	}
+	s.offsets = append(s.offsets, record.Offset)
+	s.positions = append(s.positions, pos)
+	return nil
+}
+
+// Read는 절대 오프셋 off에 해당하는 레코드를 읽는다.
+// 세그먼트 범위 안의 오프셋인데 레코드가 없으면 컴팩션으로 지워진 것이므로 ErrOffsetCompacted를 리턴한다.
+// 컴팩션되지 않은 세그먼트는 오프셋이 연속적이므로 바로 위치를 찾고, 아니면 이진 탐색한다.
+func (s *segment) Read(off uint64) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if off >= s.nextOffset {
+		return Record{}, ErrOffsetNotFound
+	}
+	if i := off - s.baseOffset; off >= s.baseOffset && i < uint64(len(s.offsets)) && s.offsets[i] == off {
+		return s.readAt(int(i))
+	}
+	i := sort.Search(len(s.offsets), func(i int) bool {
+		return s.offsets[i] >= off
+	})
+	if i == len(s.offsets) || s.offsets[i] != off {
+		return Record{}, ErrOffsetCompacted
+	}
+	return s.readAt(i)
+}
+
+// next는 세그먼트에 다음에 추가될 레코드의 오프셋을 리턴한다.
+func (s *segment) next() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextOffset
+}
+
+// readAt은 세그먼트 안에서 i번째 레코드를 읽는다.
+func (s *segment) readAt(i int) (Record, error) {
+	p, err := s.store.Read(s.positions[i])
+	if err != nil {
+		return Record{}, err
+	}
+	return s.decode(p)
+}
+
+// encode는 레코드를 JSON으로 인코딩하고 세그먼트의 방식으로 압축, 암호화해서 store에 쓸 바이트로 만든다.
+func (s *segment) encode(record Record) ([]byte, error) {
+	p, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = s.codec.compress(p); err != nil {
+		return nil, err
+	}
+	return s.seal(p)
+}
+
+// decode는 encode가 만든 바이트에서 레코드를 되돌린다.
+func (s *segment) decode(p []byte) (Record, error) {
+	p, err := s.open(p)
+	if err != nil {
+		return Record{}, err
+	}
+	if p, err = s.codec.decompress(p); err != nil {
+		return Record{}, err
+	}
+	var record Record
+	if err := json.Unmarshal(p, &record); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// Len은 세그먼트에 남아있는 레코드 수를 리턴한다.
+func (s *segment) Len() int {
+	return len(s.offsets)
+}
+
+// sweepDue는 SweepExpired가 now에 이 세그먼트를 다시 읽어야 하는지 알려준다.
+func (s *segment) sweepDue(now time.Time) bool {
+	return !s.swept || !s.nextExpiry.IsZero() && !now.Before(s.nextExpiry)
+}
+
+// expiring은 now에 만료되었지만 아직 툼스톤으로 바꾸지 않은 레코드 수와, 아직 만료되지 않은 레코드의 가장 이른 ExpireAt을 리턴한다.
+func (s *segment) expiring(now time.Time) (n int, next time.Time, err error) {
+	for i := range s.offsets {
+		record, err := s.readAt(i)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		switch {
+		case record.ExpireAt.IsZero():
+		case record.expired(now):
+			if record.Value != nil || record.Headers != nil {
+				n++
+			}
+		case next.IsZero() || record.ExpireAt.Before(next):
+			next = record.ExpireAt
+		}
+	}
+	return n, next, nil
+}
+
+// rewrite는 keep이 true를 리턴하는 레코드만 남기고 세그먼트를 다시 쓴다. keep이 리턴한 레코드를 쓰므로 레코드를 바꿀 수도 있다.
+// 남은 레코드의 오프셋은 바뀌지 않는다. 파일 세그먼트는 임시 파일에 다 쓴 뒤
+// 원래 파일 이름으로 바꾸기 때문에 도중에 실패해도 원래 파일이 남는다.
+func (s *segment) rewrite(keep func(Record) (Record, bool)) error {
+	next := &segment{
+		dir:        s.dir,
+		baseOffset: s.baseOffset,
+		nextOffset: s.nextOffset,
+		config:     s.config,
+		modTime:    s.modTime,
+		codec:      s.codec,
+		aead:       s.aead,
+	}
+
+	var tmp *os.File
+	if s.dir == "" {
+		next.store = newMemoryStore()
+	} else {
+		f, err := os.OpenFile(s.path()+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		tmp = f
+		if next.store, err = newStore(f); err != nil {
+			return err
+		}
+		if err := os.Remove(s.indexPath() + ".compact"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if next.index, err = openIndex(s.indexPath() + ".compact"); err != nil {
+			return err
+		}
+	}
+
+	for i := range s.offsets {
+		record, err := s.readAt(i)
+		if err != nil {
+			return err
+		}
+		record, ok := keep(record)
+		if !ok {
+			continue
+		}
+		if err := next.write(record); err != nil {
+			return err
+		}
+	}
+
+	if tmp != nil {
+		if err := next.store.Flush(); err != nil {
+			return err
+		}
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+		if err := next.store.Close(); err != nil {
+			return err
+		}
+		if err := next.index.Close(); err != nil {
+			return err
+		}
+		// 인덱스를 먼저 지워두면 store 이름을 바꾼 직후에 죽어도 다시 열 때 새 store로 인덱스를 다시 만든다
+		if err := s.index.Remove(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), s.path()); err != nil {
+			return err
+		}
+		if err := s.store.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(next.index.file.Name(), s.indexPath()); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		if next.store, err = newStore(f); err != nil {
+			return err
+		}
+		next.store.mmap = s.config.Segment.Mmap
+		if next.index, err = openIndex(s.indexPath()); err != nil {
+			return err
+		}
+	}
+
+	s.store = next.store
+	s.index = next.index
+	s.offsets = next.offsets
+	s.positions = next.positions
+	return nil
+}
+
+// IsMaxed는 store가 설정된 최대 크기에 도달했거나 인덱스에 더 이상 상대 오프셋을 담을 수 없는지 알려준다.
+func (s *segment) IsMaxed() bool {
+	return s.store.Size() >= s.config.Segment.MaxStoreBytes || s.nextOffset-s.baseOffset >= maxIndexEntries
+}
+
+// Flush는 store와 인덱스의 버퍼를 파일에 쓴다.
+func (s *segment) Flush() error {
+	if err := s.store.Flush(); err != nil {
+		return err
+	}
+	if s.index == nil {
+		return nil
+	}
+	return s.index.Flush()
+}
+
+// Sync는 store와 인덱스를 fsync 한다. 인덱스는 store보다 늦게 동기화해서 store에 없는 레코드를 가리키지 않게 한다.
+func (s *segment) Sync() error {
+	if err := s.store.Sync(); err != nil {
+		return err
+	}
+	if s.index == nil {
+		return nil
+	}
+	return s.index.Sync()
+}
+
+// Close는 store와 인덱스를 닫는다. 하나가 실패해도 나머지는 닫는다.
+func (s *segment) Close() error {
+	err := s.store.Close()
+	if s.index != nil {
+		if ierr := s.index.Close(); err == nil {
+			err = ierr
+		}
+	}
+	return err
+}
+
+// Remove는 세그먼트를 닫고 store 파일과 인덱스 파일, .codec 파일을 삭제한다.
+func (s *segment) Remove() error {
+	if err := s.store.Remove(); err != nil {
+		return err
+	}
+	if s.index == nil {
+		return nil
+	}
+	if err := s.index.Remove(); err != nil {
+		return err
+	}
+	if err := os.Remove(s.codecPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrInvalidSnapshot은 복원하려는 스냅숏의 형식이 맞지 않거나 레코드의 오프셋 순서가 맞지 않을 때 리턴한다.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// snapshotHeader는 스냅숏의 첫 줄이고, 그 뒤에는 레코드가 오프셋 순서대로 한 줄에 하나씩 온다.
+// 컴팩션으로 지워진 오프셋은 빠지므로 복원할 때 Lowest와 Next로 오프셋 범위를 맞춘다.
+// Members는 DistributedLog의 FSM이 쓰는 노드 ID -> HTTP 주소이고, 로컬 Log의 스냅숏에는 없다.
+type snapshotHeader struct {
+	Lowest  uint64            `json:"lowest"`
+	Next    uint64            `json:"next"`
+	Members map[string]string `json:"members,omitempty"`
+}
+
+// snapshotter는 자기 상태를 스냅숏으로 쓰고 스냅숏에서 다시 만들 수 있는 백엔드다.
+// Log는 로컬에서, DistributedLog는 Raft를 통해 모든 노드에서 복원한다.
+type snapshotter interface {
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+}
+
+// logRestorer는 비어있는 오프셋을 포함해서 스냅숏과 같은 오프셋으로 레코드를 다시 쓸 수 있는 백엔드다.
+type logRestorer interface {
+	restore(lowest, next uint64, records RecordIterator) error
+}
+
+var (
+	_ snapshotter = (*Log)(nil)
+	_ snapshotter = (*DistributedLog)(nil)
+)
+
+// Snapshot은 로그의 지금 상태를 w에 쓴다. 시작할 때의 오프셋 범위를 기록하고 레코드를 하나씩 읽어서 쓰므로
+// 로그 전체를 메모리에 올리지 않고, 쓰는 동안 Append를 막지 않는다.
+func (c *Log) Snapshot(w io.Writer) error {
+	sn, err := snapshotOf(c, nil)
+	if err != nil {
+		return err
+	}
+	return sn.writeTo(w)
+}
+
+// Restore는 로그를 비우고 Snapshot이 쓴 스냅숏에서 같은 오프셋, 같은 타임스탬프로 레코드를 다시 만든다.
+func (c *Log) Restore(r io.Reader) error {
+	_, _, err := restoreSnapshot(c, r)
+	return err
+}
+
+// restore는 로그를 lowest부터 시작하는 빈 로그로 되돌리고 records를 각자의 오프셋에 쓴다.
+// 레코드 사이의 빈 오프셋은 컴팩션으로 지워진 것으로 읽히고, 마지막 레코드 뒤에 빈 오프셋이 있으면
+// 재시작한 뒤에도 다음 오프셋이 next가 되도록 next에서 시작하는 세그먼트를 만든다.
+// 쓰기 락을 잡고 수행하므로 복원하는 동안 Append와 Read는 기다린다.
+func (c *Log) restore(lowest, next uint64, records RecordIterator) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrLogClosed
+	}
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if err := c.resetAt(lowest); err != nil {
+		return err
+	}
+	keys := make(map[string]uint64)
+	for {
+		record, ok := records.Next()
+		if !ok {
+			break
+		}
+		s := c.activeSegment
+		if record.Offset < s.nextOffset {
+			return fmt.Errorf("%w: offset %d after %d", ErrInvalidSnapshot, record.Offset, s.nextOffset)
+		}
+		s.mu.Lock()
+		err := s.write(record)
+		if err == nil {
+			s.nextOffset = record.Offset + 1
+		}
+		maxed := s.IsMaxed()
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if record.Key != nil {
+			keys[string(record.Key)] = record.Offset
+		}
+		if maxed {
+			if err := c.newSegment(s.nextOffset); err != nil {
+				return err
+			}
+		}
+	}
+	if err := records.Err(); err != nil {
+		return err
+	}
+	if s := c.activeSegment; next > s.nextOffset {
+		s.mu.Lock()
+		s.nextOffset = next
+		s.mu.Unlock()
+		if err := c.newSegment(next); err != nil {
+			return err
+		}
+	}
+	c.keysMu.Lock()
+	c.keys = keys
+	c.keysMu.Unlock()
+	if err := syncSegments(c.segments); err != nil {
+		return err
+	}
+	c.notifyAppended()
+	return nil
+}
+
+// resetAt은 쓰기 락을 잡은 상태에서 모든 세그먼트를 삭제하고 base부터 시작하는 빈 로그로 되돌린다.
+func (c *Log) resetAt(base uint64) error {
+	for _, s := range c.segments {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	c.segments = nil
+	c.lowest = base
+	if c.Dir != "" {
+		if err := os.Remove(c.lowestPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	c.keysMu.Lock()
+	c.keys = make(map[string]uint64)
+	c.keysMu.Unlock()
+	return c.newSegment(base)
+}
+
+// logSnapshot은 스냅숏을 만든 시점의 오프셋 범위와 그 범위를 읽는 이터레이터다.
+// 레코드는 추가된 뒤 바뀌지 않으므로 나중에 writeTo를 호출해도 만든 시점의 내용을 쓴다.
+type logSnapshot struct {
+	header  snapshotHeader
+	records RecordIterator
+}
+
+// snapshotOf는 log의 지금 오프셋 범위를 고정한다. 범위를 먼저 구한 뒤 이터레이터를 만들기 때문에
+// 그 사이에 추가된 레코드가 더 들어갈 수 있고, 복원할 때는 마지막 레코드 뒤부터 이어진다.
+func snapshotOf(log CommitLog, members map[string]string) (*logSnapshot, error) {
+	lowest, highest, count := bounds(log)
+	header := snapshotHeader{Lowest: lowest, Next: lowest, Members: members}
+	if count > 0 {
+		header.Next = highest + 1
+	}
+	it, err := readFrom(log, lowest)
+	if err != nil {
+		return nil, err
+	}
+	return &logSnapshot{header: header, records: it}, nil
+}
+
+// writeTo는 헤더 줄 뒤에 레코드를 Log.Reader와 같은 NDJSON으로 w에 쓴다.
+func (s *logSnapshot) writeTo(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(s.header); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, newRecordReader(s.records))
+	return err
+}
+
+// restoreSnapshot은 r의 스냅숏으로 log를 다시 만들고 헤더와 마지막 레코드의 타임스탬프를 리턴한다.
+// restore가 없는 백엔드는 Reset 뒤에 레코드를 차례로 추가하므로 오프셋 0부터 빈 곳 없이 이어진 스냅숏만 복원할 수 있다.
+func restoreSnapshot(log CommitLog, r io.Reader) (snapshotHeader, time.Time, error) {
+	dec := json.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return header, time.Time{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	it := &snapshotIterator{dec: dec, next: header.Lowest}
+	var err error
+	if lr, ok := log.(logRestorer); ok {
+		err = lr.restore(header.Lowest, header.Next, it)
+	} else {
+		err = restoreByAppend(log, it)
+	}
+	return header, it.last, err
+}
+
+// validateSnapshot은 r을 끝까지 읽어서 복원할 수 있는 스냅숏인지 확인한다.
+func validateSnapshot(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	it := &snapshotIterator{dec: dec, next: header.Lowest}
+	for {
+		if _, ok := it.Next(); !ok {
+			return it.Err()
+		}
+	}
+}
+
+func restoreByAppend(log CommitLog, records RecordIterator) error {
+	if _, _, count := bounds(log); count > 0 {
+		if err := reset(log); err != nil {
+			return fmt.Errorf("reset local log: %w", err)
+		}
+	}
+	for {
+		record, ok := records.Next()
+		if !ok {
+			return records.Err()
+		}
+		off, err := appendReplicated(log, record)
+		if err != nil {
+			return err
+		}
+		if off != record.Offset {
+			return fmt.Errorf("restored record at offset %d, want %d", off, record.Offset)
+		}
+	}
+}
+
+// snapshotIterator는 스냅숏의 레코드를 하나씩 디코딩하고 오프셋이 커지는 순서인지 확인한다.
+type snapshotIterator struct {
+	dec  *json.Decoder
+	next uint64
+	last time.Time
+	err  error
+}
+
+func (it *snapshotIterator) Next() (Record, bool) {
+	if it.err != nil {
+		return Record{}, false
+	}
+	var record Record
+	if err := it.dec.Decode(&record); err != nil {
+		if err != io.EOF {
+			it.err = fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		return Record{}, false
+	}
+	if record.Offset < it.next {
+		it.err = fmt.Errorf("%w: offset %d after %d", ErrInvalidSnapshot, record.Offset, it.next)
+		return Record{}, false
+	}
+	it.next = record.Offset + 1
+	it.last = record.Timestamp
+	return record, true
+}
+
+func (it *snapshotIterator) Offset() uint64 {
+	return it.next
+}
+
+func (it *snapshotIterator) Err() error {
+	return it.err
+}
+
+// snapshot 핸들러는 로그의 스냅숏을 NDJSON으로 응답한다. 응답을 /restore에 그대로 올리면 같은 오프셋으로 복원된다.
+// Raft 노드라면 먼저 Raft 스냅숏을 만들어서 Raft 로그를 줄이므로 늦은 팔로워가 스냅숏으로 빨리 따라잡는다.
+func (s *httpServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.Log.(snapshotter)
+	if !ok {
+		s.httpError(w, errors.ErrUnsupported, http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	if err := sn.Snapshot(w); err != nil {
+		// 이미 응답을 쓰기 시작했으므로 연결을 끊어서 스냅숏이 완전하지 않다는 것을 알린다
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// restore 핸들러는 바디의 스냅숏으로 로그를 다시 만든다. 기존 레코드는 모두 지워진다.
+// Raft 노드라면 리더에서만 복원할 수 있고(팔로워는 리더에게 전달한다), 리더가 팔로워에게 스냅숏을 보내서 모든 노드가 같은 상태가 된다.
+func (s *httpServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.Log.(snapshotter)
+	if !ok {
+		s.httpError(w, errors.ErrUnsupported, http.StatusNotImplemented)
+		return
+	}
+	err := sn.Restore(r.Body)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotLeader):
+		s.notLeader(w, r)
+		return
+	case errors.Is(err, ErrInvalidSnapshot):
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrReadOnly):
+		s.httpError(w, err, http.StatusMethodNotAllowed)
+		return
+	default:
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.handleOffsets(w, r)
+}
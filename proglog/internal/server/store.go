@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+// 레코드 길이와 체크섬을 저장할 때 사용할 인코딩과 바이트 수
+var (
+	enc      = binary.BigEndian
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+const (
+	lenWidth    = 8
+	crcWidth    = 4
+	headerWidth = lenWidth + crcWidth
+)
+
+// store는 레코드를 길이(lenWidth 바이트) + CRC32 체크섬(crcWidth 바이트) + 데이터 형태로
+// 이어붙여 저장하는 append-only 저장소다. 체크섬은 Castagnoli 다항식으로 데이터에 대해 계산한다.
+// file이 nil이면 메모리에 저장하고, 아니면 버퍼를 거쳐 파일에 기록한다.
+type store struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	mem  []byte
+	size uint64
+
+	// dirty는 마지막 Sync 뒤에 쓴 데이터가 있는지 나타낸다
+	dirty bool
+
+	// mmap이 true이면 Read가 파일을 매핑한 mapped에서 바로 읽는다. 파일이 매핑보다 커지면 더 크게 다시 매핑하고,
+	// 이전 매핑은 그 매핑에서 읽은 슬라이스를 아직 쓰고 있을 수 있으므로 Close할 때까지 retired에 남겨둔다.
+	mmap    bool
+	mapped  []byte
+	retired [][]byte
+}
+
+// 처음 매핑하는 크기. 이후에는 필요한 만큼 두 배씩 늘린다
+const minMmapBytes = 64 * 1024
+
+// newStore는 파일을 감싸는 store를 만든다.
+// 이미 데이터가 있는 파일이라면 현재 크기부터 이어서 쓴다.
+func newStore(f *os.File) (*store, error) {
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &store{
+		file: f,
+		buf:  bufio.NewWriter(f),
+		size: uint64(fi.Size()),
+	}, nil
+}
+
+// newMemoryStore는 파일 없이 메모리에만 저장하는 store를 만든다.
+func newMemoryStore() *store {
+	return &store{}
+}
+
+// Append는 길이와 체크섬을 먼저 쓰고 데이터를 쓴 뒤, 쓴 바이트 수와 레코드가 시작하는 위치를 리턴한다.
+func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var header [headerWidth]byte
+	enc.PutUint64(header[:lenWidth], uint64(len(p)))
+	enc.PutUint32(header[lenWidth:], crc32.Checksum(p, crcTable))
+
+	pos = s.size
+	if s.file == nil {
+		s.mem = append(s.mem, header[:]...)
+		s.mem = append(s.mem, p...)
+		n = uint64(headerWidth + len(p))
+		s.size += n
+		return n, pos, nil
+	}
+
+	if _, err := s.buf.Write(header[:]); err != nil {
+		return 0, 0, err
+	}
+	w, err := s.buf.Write(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	n = uint64(headerWidth + w)
+	s.size += n
+	s.dirty = true
+	return n, pos, nil
+}
+
+// Read는 pos 위치에 저장된 레코드의 데이터를 읽고 체크섬을 확인한다.
+// 체크섬이 맞지 않으면 ErrCorruptRecord를 리턴한다.
+// 아직 버퍼에 남아있는 데이터가 있을 수 있으므로 읽기 전에 먼저 flush 한다.
+func (s *store) Read(pos uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var header []byte
+	var p []byte
+	if s.file == nil {
+		header = s.mem[pos : pos+headerWidth]
+		size := enc.Uint64(header[:lenWidth])
+		p = make([]byte, size)
+		copy(p, s.mem[pos+headerWidth:pos+headerWidth+size])
+	} else if m, ok := s.mappedAt(pos + headerWidth); ok {
+		if err := s.buf.Flush(); err != nil {
+			return nil, err
+		}
+		header = m[pos : pos+headerWidth]
+		size := enc.Uint64(header[:lenWidth])
+		if size > s.size-pos-headerWidth {
+			return nil, ErrCorruptRecord
+		}
+		// 매핑에서 바로 슬라이스하므로 복사하지 않는다
+		if m, ok = s.mappedAt(pos + headerWidth + size); !ok {
+			return nil, ErrCorruptRecord
+		}
+		p = m[pos+headerWidth : pos+headerWidth+size]
+	} else {
+		if err := s.buf.Flush(); err != nil {
+			return nil, err
+		}
+		header = make([]byte, headerWidth)
+		if _, err := s.file.ReadAt(header, int64(pos)); err != nil {
+			return nil, err
+		}
+		// 길이가 깨져 있으면 엄청난 크기의 버퍼를 만들지 않도록 store 크기와 먼저 비교한다
+		size := enc.Uint64(header[:lenWidth])
+		if size > s.size-pos-headerWidth {
+			return nil, ErrCorruptRecord
+		}
+		p = make([]byte, size)
+		if _, err := s.file.ReadAt(p, int64(pos+headerWidth)); err != nil {
+			return nil, err
+		}
+	}
+
+	if crc32.Checksum(p, crcTable) != enc.Uint32(header[lenWidth:]) {
+		return nil, ErrCorruptRecord
+	}
+	return p, nil
+}
+
+// mappedAt은 파일의 처음부터 end 바이트까지를 덮는 매핑을 리턴한다. 지금 매핑이 짧으면 더 크게 다시 매핑한다.
+// mmap을 쓰지 않거나 매핑에 실패하면 false를 리턴하고, 실패한 뒤로는 ReadAt으로 읽는다. s.mu를 잡은 상태에서 호출해야 한다.
+func (s *store) mappedAt(end uint64) ([]byte, bool) {
+	if !s.mmap || end > s.size {
+		return nil, false
+	}
+	if end <= uint64(len(s.mapped)) {
+		return s.mapped, true
+	}
+	length := max(uint64(minMmapBytes), 2*uint64(len(s.mapped)))
+	for length < end {
+		length *= 2
+	}
+	m, err := mmapFile(s.file, int(length))
+	if err != nil {
+		s.mmap = false
+		return nil, false
+	}
+	if s.mapped != nil {
+		s.retired = append(s.retired, s.mapped)
+	}
+	s.mapped = m
+	return m, true
+}
+
+// unmapAll은 모든 매핑을 해제한다. 더 이상 읽는 쪽이 없을 때 Close에서 호출한다.
+func (s *store) unmapAll() error {
+	var first error
+	for _, m := range append(s.retired, s.mapped) {
+		if m == nil {
+			continue
+		}
+		if err := munmap(m); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.mapped, s.retired = nil, nil
+	return first
+}
+
+// recordEnd는 pos 위치의 레코드 헤더만 읽어서 그 레코드가 끝나는 위치를 리턴한다.
+// 헤더나 데이터가 store의 끝을 넘어가면 errPartialRecord를 리턴한다.
+func (s *store) recordEnd(pos uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pos+headerWidth > s.size {
+		return 0, errPartialRecord
+	}
+	header := make([]byte, lenWidth)
+	if s.file == nil {
+		copy(header, s.mem[pos:])
+	} else {
+		if err := s.buf.Flush(); err != nil {
+			return 0, err
+		}
+		if _, err := s.file.ReadAt(header, int64(pos)); err != nil {
+			return 0, err
+		}
+	}
+	size := enc.Uint64(header)
+	if size > s.size-pos-headerWidth {
+		return 0, errPartialRecord
+	}
+	return pos + headerWidth + size, nil
+}
+
+// truncate는 store를 size 바이트로 자른다. 파일 끝에 남은 깨진 레코드를 지울 때 사용한다.
+func (s *store) truncate(size uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		s.mem = s.mem[:size]
+		s.size = size
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	s.size = size
+	return s.file.Sync()
+}
+
+// Size는 store에 기록된 전체 바이트 수를 리턴한다.
+func (s *store) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Flush는 버퍼에 남은 데이터를 파일에 쓴다.
+func (s *store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.buf.Flush()
+}
+
+// Sync는 버퍼에 남은 데이터를 파일에 쓰고 fsync 한다. 마지막 Sync 뒤에 쓴 데이터가 없으면 아무 일도 하지 않는다.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || !s.dirty {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Close는 버퍼에 남은 데이터를 파일에 쓰고 디스크에 fsync 한 뒤 파일을 닫는다.
+// flush나 fsync가 실패해도 파일은 닫는다.
+func (s *store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.buf.Flush()
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if uerr := s.unmapAll(); err == nil {
+		err = uerr
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Remove는 store를 닫고 파일을 삭제한다.
+func (s *store) Remove() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if s.file == nil {
+		return nil
+	}
+	return os.Remove(s.file.Name())
+}
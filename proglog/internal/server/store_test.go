@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// flipByte는 path 파일의 off 바이트를 뒤집는다.
+func flipByte(t *testing.T, path string, off int64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 열려있는 Log의 store 파일에서 레코드 데이터 바이트 하나를 바꾸면 Read가 쓰레기 값이 아니라 ErrCorruptRecord를 리턴해야 한다.
+func TestReadDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	var c Config
+	c.Fsync = FsyncAlways
+	log, err := NewLogWithConfig(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for _, v := range []string{"first record", "second record"} {
+		if _, err := log.Append(Record{Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 첫 레코드의 헤더 바로 뒤, 데이터의 첫 바이트를 뒤집는다
+	flipByte(t, filepath.Join(dir, "0.store"), headerWidth)
+	if _, err := log.Read(0); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("read the flipped record: got %v, want %v", err, ErrCorruptRecord)
+	}
+	record, err := log.Read(1)
+	if err != nil {
+		t.Fatalf("read the intact record: %v", err)
+	}
+	if string(record.Value) != "second record" {
+		t.Fatalf("intact record: got %q", record.Value)
+	}
+}
+
+// 마지막이 아닌 레코드가 손상된 store는 잘라내면 데이터를 잃으므로 Log를 열지 않는다.
+func TestOpenDetectsCorruption(t *testing.T) {
+	for _, mmap := range []bool{false, true} {
+		t.Run(map[bool]string{false: "pread", true: "mmap"}[mmap], func(t *testing.T) {
+			dir := t.TempDir()
+			var c Config
+			c.Segment.Mmap = mmap
+			log, err := NewLogWithConfig(dir, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []string{"first record", "second record"} {
+				if _, err := log.Append(Record{Value: []byte(v)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := log.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			flipByte(t, filepath.Join(dir, "0.store"), headerWidth)
+			if _, err := NewLogWithConfig(dir, c); !errors.Is(err, ErrCorruptRecord) {
+				t.Fatalf("open: got %v, want %v", err, ErrCorruptRecord)
+			}
+		})
+	}
+}
+
+// 같은 파일 Log를 ReadAt(pread)으로 읽을 때와 매핑한 store에서 읽을 때를 비교한다.
+func BenchmarkStoreReadMmap(b *testing.B) {
+	const records = 10000
+	for _, mmap := range []bool{false, true} {
+		b.Run(map[bool]string{false: "pread", true: "mmap"}[mmap], func(b *testing.B) {
+			var c Config
+			c.Segment.Mmap = mmap
+			log, err := NewLogWithConfig(b.TempDir(), c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer log.Close()
+			value := make([]byte, 256)
+			for i := 0; i < records; i++ {
+				if _, err := log.Append(Record{Value: value}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			// 버퍼에 남은 레코드도 파일에서 읽도록 먼저 flush 한다
+			if err := syncSegments(log.segments); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				off := uint64(0)
+				for pb.Next() {
+					if _, err := log.Read(off % records); err != nil {
+						b.Error(err)
+						return
+					}
+					off += 7
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 클라이언트와의 연결이 끊기지 않도록 heartbeat 주석을 보내는 간격
+const streamHeartbeatInterval = 15 * time.Second
+
+// stream 핸들러는 Server-Sent Events로 레코드를 실시간으로 내보낸다.
+// offset 쿼리 파라미터부터 시작해서 이미 있는 레코드를 먼저 보내고,
+// 로그의 끝에 도달하면 새 레코드가 추가될 때까지 기다렸다가 이어서 보낸다.
+// 이벤트를 보낼 때마다 flush 하고, 클라이언트가 연결을 끊으면 종료한다.
+// 스트림을 시작하기 전에 offset을 확인해서, 남아있는 가장 앞의 오프셋보다 작거나 다음에 추가될 오프셋보다 크면
+// consume처럼 404로 응답한다.
+func (s *httpServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	offset, _, err := offsetParam(r)
+	if err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	log := s.logFor(r)
+	lowest, highest, count := bounds(log)
+	next := lowest
+	if count > 0 {
+		next = highest + 1
+	}
+	if offset < lowest {
+		s.httpError(w, ErrOffsetOutOfRange, http.StatusNotFound)
+		return
+	}
+	if offset > next {
+		s.httpError(w, ErrOffsetNotFound, http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.httpError(w, errors.New("streaming unsupported"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// Read보다 먼저 채널을 받아야 그 사이에 추가된 레코드를 놓치지 않는다
+		appended := appended(log)
+		record, err := log.Read(offset)
+		if err == nil {
+			p, err := json.Marshal(record)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", record.Offset, p); err != nil {
+				return
+			}
+			flusher.Flush()
+			s.metrics.recordsRead.Inc()
+			offset++
+			continue
+		}
+		if err == ErrOffsetCompacted || err == ErrRecordExpired {
+			offset++
+			continue
+		}
+		if err != ErrOffsetNotFound {
+			return
+		}
+
+		select {
+		case <-appended:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// TimeoutHandler가 시간이 지난 요청에 보내는 바디. 컨텍스트 기한이 지난 다른 에러 응답과 같은 code를 쓴다.
+const timeoutBody = `{"error":{"code":"deadline_exceeded","message":"request timed out"}}` + "\n"
+
+// withTimeout은 next를 http.TimeoutHandler로 감싸서 timeout(r)이 지나면 요청 컨텍스트를 취소하고 503을 반환한다.
+// timeout(r)이 0이면 제한하지 않는다. TimeoutHandler는 응답을 버퍼에 모았다가 한 번에 쓰고 http.Flusher를 지원하지 않으므로
+// stream과 export처럼 응답을 흘려보내는 핸들러에는 쓰지 않는다.
+func (s *httpServer) withTimeout(timeout func(*http.Request) time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := timeout(r)
+		if d <= 0 {
+			next(w, r)
+			return
+		}
+		http.TimeoutHandler(next, d, timeoutBody).ServeHTTP(&timeoutWriter{ResponseWriter: w, s: s}, r)
+	}
+}
+
+// timeoutWriter는 TimeoutHandler가 시간이 지나서 쓰는 503에 다른 에러 응답과 같은 헤더를 붙이고 에러 카운터를 증가시킨다.
+// 핸들러가 끝낸 응답이면 TimeoutHandler가 핸들러의 헤더를 먼저 복사하므로 Content-Type이 있다.
+type timeoutWriter struct {
+	http.ResponseWriter
+	s *httpServer
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.s.metrics.errors.WithLabelValues("503").Inc()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// produceTimeoutFor는 쓰기 요청의 최대 처리 시간이다. NDJSON 바디는 bulk로 올리는 큰 파일이므로 제한하지 않는다.
+func (o options) produceTimeoutFor(r *http.Request) time.Duration {
+	if hasMediaType(r.Header.Get("Content-Type"), contentTypeNDJSON) {
+		return 0
+	}
+	return o.produceTimeout
+}
+
+// consumeTimeoutFor는 읽기 요청의 최대 처리 시간이다. wait 쿼리 파라미터로 레코드를 기다리는 long-poll 요청은
+// 기다리는 시간이 있으므로 longPollTimeout을 쓴다.
+func (o options) consumeTimeoutFor(r *http.Request) time.Duration {
+	if r.URL.Query().Get("wait") != "" {
+		return o.longPollTimeout
+	}
+	return o.consumeTimeout
+}
+
+// noTimeout은 요청 시간을 제한하지 않는 라우트에 쓴다.
+func noTimeout(*http.Request) time.Duration {
+	return 0
+}
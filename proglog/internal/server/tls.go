@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadTLSConfig는 인증서와 키 파일을 읽어서 서버용 *tls.Config를 만든다.
+// 파일이 없으면 어떤 파일이 없는지 알 수 있도록 바로 에러를 리턴한다.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if _, err := os.Stat(certFile); err != nil {
+		return nil, fmt.Errorf("tls cert file: %w", err)
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		return nil, fmt.Errorf("tls key file: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls key pair: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// LoadCertPool은 PEM 형식의 CA 인증서 파일을 읽어서 인증서 풀을 만든다.
+// 클라이언트 인증서를 검증할 CA를 지정할 때 사용한다.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("tls ca file: no certificates found in %q", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,428 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultTopic은 토픽을 지정하지 않는 기존 / 엔드포인트가 사용하는 토픽이다.
+// 서버에 넘긴 Log가 이 토픽이 된다.
+const DefaultTopic = "default"
+
+var (
+	ErrTopicNotFound = errors.New("topic not found")
+	ErrInvalidTopic  = errors.New("invalid topic name")
+	// ErrDefaultTopic은 기본 토픽을 삭제하려고 할 때 리턴한다.
+	ErrDefaultTopic = errors.New("default topic cannot be deleted")
+)
+
+// 토픽 이름은 디렉터리 이름으로도 사용하므로 경로 구분자 없이 영문, 숫자, '.', '_', '-'만 허용한다
+var topicNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+func validTopicName(name string) bool {
+	return topicNamePattern.MatchString(name) && name != "." && name != ".."
+}
+
+// TopicManager는 토픽 이름별로 Topic을 관리한다.
+// dir이 비어있으면 파티션마다 메모리 Log를 만들고,
+// 아니면 dir/<토픽 이름>/<파티션 번호> 디렉터리에 영속 Log를 만들어서 재시작해도 토픽이 유지된다.
+type TopicManager struct {
+	mu     sync.RWMutex
+	dir    string
+	config Config
+	topics map[string]*Topic
+
+	// onOpen은 새로 열거나 만든 파티션 Log에 서버 설정을 적용한다
+	onOpen func(*Log)
+}
+
+// NewTopicManager는 dir 디렉터리에 이미 있는 토픽들을 열어서 TopicManager를 만든다.
+func NewTopicManager(dir string, c Config) (*TopicManager, error) {
+	return newTopicManager(dir, c, nil)
+}
+
+func newTopicManager(dir string, c Config, onOpen func(*Log)) (*TopicManager, error) {
+	m := &TopicManager{
+		dir:    dir,
+		config: c,
+		topics: make(map[string]*Topic),
+		onOpen: onOpen,
+	}
+	if dir == "" {
+		return m, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validTopicName(entry.Name()) {
+			continue
+		}
+		n := countPartitions(filepath.Join(dir, entry.Name()))
+		if n == 0 {
+			continue
+		}
+		if _, err := m.open(entry.Name(), n); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// countPartitions는 토픽 디렉터리에 0부터 이어지는 파티션 디렉터리가 몇 개 있는지 센다.
+func countPartitions(dir string) int {
+	n := 0
+	for {
+		info, err := os.Stat(filepath.Join(dir, strconv.Itoa(n)))
+		if err != nil || !info.IsDir() {
+			return n
+		}
+		n++
+	}
+}
+
+// open은 토픽의 파티션 Log들을 열어서 등록한다. 호출하는 쪽에서 쓰기 락을 잡거나 아직 공유되지 않은 상태여야 한다.
+func (m *TopicManager) open(name string, partitions int) (*Topic, error) {
+	t := &Topic{name: name}
+	if m.dir != "" {
+		t.dir = filepath.Join(m.dir, name)
+	}
+	for i := 0; i < partitions; i++ {
+		var dir string
+		if t.dir != "" {
+			dir = filepath.Join(t.dir, strconv.Itoa(i))
+		}
+		log, err := NewLogWithConfig(dir, m.config)
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		if m.onOpen != nil {
+			m.onOpen(log)
+		}
+		t.partitions = append(t.partitions, log)
+	}
+	m.topics[name] = t
+	return t, nil
+}
+
+// Get은 토픽을 리턴하고, 토픽이 없으면 ErrTopicNotFound를 리턴한다.
+func (m *TopicManager) Get(name string) (*Topic, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.topics[name]
+	if !ok {
+		return nil, ErrTopicNotFound
+	}
+	return t, nil
+}
+
+// GetOrCreate는 토픽을 리턴하고, 토픽이 없으면 partitions개의 파티션으로 새로 만든다.
+// 이미 있는 토픽의 파티션 수는 바꾸지 않는다. created는 이번 호출에서 토픽을 만들었는지 알려준다.
+func (m *TopicManager) GetOrCreate(name string, partitions int) (t *Topic, created bool, err error) {
+	if !validTopicName(name) {
+		return nil, false, ErrInvalidTopic
+	}
+	if partitions < 1 || partitions > maxPartitions {
+		return nil, false, ErrInvalidPartitions
+	}
+	if t, err := m.Get(name); err == nil {
+		return t, false, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 락을 다시 잡는 사이에 다른 요청이 토픽을 만들었을 수 있다
+	if t, ok := m.topics[name]; ok {
+		return t, false, nil
+	}
+	t, err = m.open(name, partitions)
+	if err != nil {
+		return nil, false, err
+	}
+	return t, true, nil
+}
+
+// Topics는 토픽들을 이름 순서대로 리턴한다.
+func (m *TopicManager) Topics() []*Topic {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	topics := make([]*Topic, 0, len(m.topics))
+	for _, t := range m.topics {
+		topics = append(topics, t)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].name < topics[j].name
+	})
+	return topics
+}
+
+// Delete는 토픽의 파티션 Log들을 닫고 삭제한다. 영속 토픽이라면 디렉터리도 함께 삭제한다.
+func (m *TopicManager) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.topics[name]
+	if !ok {
+		return ErrTopicNotFound
+	}
+	delete(m.topics, name)
+	if err := t.close(); err != nil {
+		return err
+	}
+	if t.dir != "" {
+		return os.RemoveAll(t.dir)
+	}
+	return nil
+}
+
+// Close는 모든 토픽의 파티션 Log들을 닫는다.
+func (m *TopicManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.topics {
+		if err := t.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topicsDir은 영속 Log라면 Log 디렉터리 안의 topics 디렉터리를,
+// 메모리 Log나 다른 CommitLog 구현이라면 빈 문자열을 리턴한다.
+func topicsDir(log CommitLog) string {
+	l, ok := log.(*Log)
+	if !ok || l.Dir == "" {
+		return ""
+	}
+	return filepath.Join(l.Dir, "topics")
+}
+
+// consumeLocation은 produce 응답의 Location 헤더로 레코드를 다시 읽을 수 있는 경로를 리턴한다.
+func (s *httpServer) consumeLocation(r *http.Request, partition int, offset uint64) string {
+	if topic := mux.Vars(r)["topic"]; topic != "" {
+		return fmt.Sprintf("%s/topics/%s?partition=%d&offset=%d", s.apiBase(r), topic, partition, offset)
+	}
+	return fmt.Sprintf("%s/consume?offset=%d", s.apiBase(r), offset)
+}
+
+type topicRouteKey struct{}
+
+// topicRoute는 withTopic이 요청 컨텍스트에 넣는 토픽과 파티션이다.
+type topicRoute struct {
+	topic     *Topic // nil이면 기본 토픽
+	partition int    // partition 쿼리 파라미터, 지정하지 않았으면 -1
+}
+
+func routeFor(r *http.Request) topicRoute {
+	if route, ok := r.Context().Value(topicRouteKey{}).(topicRoute); ok {
+		return route
+	}
+	return topicRoute{partition: -1}
+}
+
+// logFor는 요청이 읽을 로그를 리턴한다. topic 경로가 아니면 기본 토픽의 로그이고,
+// 파티션을 지정하지 않았으면 0번 파티션이다.
+func (s *httpServer) logFor(r *http.Request) CommitLog {
+	route := routeFor(r)
+	if route.topic == nil {
+		return s.Log
+	}
+	return route.topic.partitions[max(route.partition, 0)]
+}
+
+// produceTarget은 레코드를 추가할 로그와 파티션 번호를 리턴한다.
+// partition 쿼리 파라미터가 있으면 그 파티션을, 레코드에 키가 있으면 키의 파티션을 사용한다.
+// 키가 없으면 Idempotency-Key로 파티션을 정해서 재시도해도 같은 파티션에 가게 하고,
+// 그것도 없으면 파티션을 돌아가면서 사용한다.
+func (s *httpServer) produceTarget(r *http.Request, record Record, idempotencyKey string) (CommitLog, int) {
+	route := routeFor(r)
+	if route.topic == nil {
+		return s.Log, 0
+	}
+	t := route.topic
+	p := route.partition
+	switch {
+	case p >= 0:
+	case len(record.Key) > 0:
+		p = PartitionForKey(record.Key, len(t.partitions))
+	case idempotencyKey != "":
+		p = PartitionForKey([]byte(idempotencyKey), len(t.partitions))
+	default:
+		p = int((t.next.Add(1) - 1) % uint64(len(t.partitions)))
+	}
+	return t.partitions[p], p
+}
+
+// withTopic은 경로의 topic과 partition 쿼리 파라미터를 요청 컨텍스트에 넣어서
+// 핸들러가 logFor나 produceTarget으로 사용하게 한다.
+// create가 true이면 produce처럼 처음 쓰는 토픽을 파티션 하나로 자동으로 만든다.
+func (s *httpServer) withTopic(create bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := topicRoute{partition: -1}
+		name := mux.Vars(r)["topic"]
+		var err error
+		switch {
+		case name == DefaultTopic:
+		case create:
+			route.topic, _, err = s.topics.GetOrCreate(name, 1)
+		default:
+			route.topic, err = s.topics.Get(name)
+		}
+		if err == ErrTopicNotFound {
+			s.httpError(w, err, http.StatusNotFound)
+			return
+		}
+		if err == ErrInvalidTopic {
+			s.httpError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.httpError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if v := r.URL.Query().Get("partition"); v != "" {
+			p, err := strconv.ParseUint(v, 10, 31)
+			if err != nil {
+				s.httpError(w, fmt.Errorf("invalid partition: %s", v), http.StatusBadRequest)
+				return
+			}
+			partitions := 1
+			if route.topic != nil {
+				partitions = len(route.topic.partitions)
+			}
+			if int(p) >= partitions {
+				s.httpError(w, ErrPartitionNotFound, http.StatusNotFound)
+				return
+			}
+			route.partition = int(p)
+		}
+
+		ctx := context.WithValue(r.Context(), topicRouteKey{}, route)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// TopicInfo는 토픽의 이름과 전체 레코드 수, 파티션별 오프셋 범위를 담는다.
+type TopicInfo struct {
+	Name       string          `json:"name"`
+	Count      uint64          `json:"count"`
+	Partitions []PartitionInfo `json:"partitions"`
+}
+
+// PartitionInfo는 파티션 하나의 오프셋 범위를 담는다. 범위의 의미는 OffsetsResponse와 같다.
+type PartitionInfo struct {
+	Partition int    `json:"partition"`
+	Lowest    uint64 `json:"lowest"`
+	Highest   uint64 `json:"highest"`
+	Count     uint64 `json:"count"`
+}
+
+func topicInfo(name string, partitions []CommitLog) TopicInfo {
+	info := TopicInfo{Name: name, Partitions: make([]PartitionInfo, len(partitions))}
+	for i, log := range partitions {
+		lowest, highest, count := bounds(log)
+		info.Partitions[i] = PartitionInfo{Partition: i, Lowest: lowest, Highest: highest, Count: count}
+		info.Count += count
+	}
+	return info
+}
+
+// list topics 핸들러는 기본 토픽을 포함해서 produce로 만들어진 토픽과
+// 명시적으로 만든 토픽을 이름 순서대로 응답한다.
+func (s *httpServer) handleListTopics(w http.ResponseWriter, r *http.Request) {
+	res := []TopicInfo{topicInfo(DefaultTopic, []CommitLog{s.Log})}
+	for _, t := range s.topics.Topics() {
+		partitions := make([]CommitLog, len(t.partitions))
+		for i, log := range t.partitions {
+			partitions[i] = log
+		}
+		res = append(res, topicInfo(t.name, partitions))
+	}
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// create topic 핸들러는 partitions 쿼리 파라미터(기본값 1)만큼의 파티션으로 토픽을 만들고 201을 반환한다.
+// 이미 있는 토픽이면 200을 반환하고, 요청한 파티션 수가 기존 토픽과 다르면 409 에러를 반환한다.
+func (s *httpServer) handleCreateTopic(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["topic"]
+	partitions := 1
+	v := r.URL.Query().Get("partitions")
+	if v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			s.httpError(w, fmt.Errorf("invalid partitions: %s", v), http.StatusBadRequest)
+			return
+		}
+		partitions = n
+	}
+	if name == DefaultTopic {
+		if partitions != 1 {
+			s.httpError(w, ErrPartitionMismatch, http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	t, created, err := s.topics.GetOrCreate(name, partitions)
+	if err == ErrInvalidTopic || err == ErrInvalidPartitions {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if v != "" && t.Partitions() != partitions {
+		s.httpError(w, ErrPartitionMismatch, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// delete topic 핸들러는 토픽과 그 레코드를 모두 삭제하고 204를 반환한다.
+// 기존 / 엔드포인트가 사용하는 기본 토픽은 삭제할 수 없다.
+func (s *httpServer) handleDeleteTopic(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["topic"]
+	if name == DefaultTopic {
+		s.httpError(w, ErrDefaultTopic, http.StatusConflict)
+		return
+	}
+	err := s.topics.Delete(name)
+	if err == ErrTopicNotFound {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
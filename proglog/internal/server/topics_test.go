@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+// 토픽 삭제와 기본 로그 truncate는 따로 켠다.
+func TestTopicDeletionEnabled(t *testing.T) {
+	h := newTestHandler(t, WithTruncateEnabled(true))
+	if w := serve(h, http.MethodPut, "/topics/events", ""); w.Code != http.StatusCreated {
+		t.Fatalf("create topic: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodDelete, "/topics/events", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("delete topic with only truncate enabled: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	h = newTestHandler(t, WithTopicDeletionEnabled(true))
+	if w := serve(h, http.MethodPut, "/topics/events", ""); w.Code != http.StatusCreated {
+		t.Fatalf("create topic: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodDelete, "/topics/events", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete topic: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodGet, "/topics/events?offset=0", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("consume a deleted topic: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(h, http.MethodDelete, "/", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("truncate with only topic deletion enabled: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
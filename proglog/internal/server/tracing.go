@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mokpolar/proglog/internal/server"
+
+// traceRequests는 요청마다 서버 span을 만든다. traceparent 헤더로 들어온 trace context를 이어받아서
+// 다른 서비스에서 보낸 요청의 span과 연결되고, baggage도 함께 전달한다.
+func traceRequests(tp trace.TracerProvider, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "proglog",
+		otelhttp.WithTracerProvider(tp),
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		)),
+	)
+}
+
+// nameSpans는 라우터가 경로를 찾은 뒤에 서버 span의 이름을 "GET /key/{key}"처럼 경로 템플릿으로 바꾼다.
+// 실제 경로를 쓰면 키나 토픽마다 span 이름이 달라지기 때문이다.
+func nameSpans(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				trace.SpanFromContext(r.Context()).SetName(r.Method + " " + tmpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// endSpan은 err가 있으면 span에 기록하고, 없으면 attrs를 추가한 뒤 span을 끝낸다.
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attrs...)
+	}
+	span.End()
+}
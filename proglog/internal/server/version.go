@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// 빌드 정보는 -ldflags로 설정한다. 설정하지 않으면 기본값으로 동작한다.
+//
+//	go build -ldflags "-X github.com/mokpolar/proglog/internal/server.Version=v1.2.0 \
+//		-X github.com/mokpolar/proglog/internal/server.Commit=$(git rev-parse HEAD) \
+//		-X github.com/mokpolar/proglog/internal/server.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// buildInfo는 빌드 정보를 리턴한다. Commit을 ldflags로 설정하지 않았으면
+// go build가 바이너리에 기록한 VCS 정보를 대신 사용한다.
+func buildInfo() VersionResponse {
+	res := VersionResponse{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if res.Commit == "unknown" {
+					res.Commit = setting.Value
+				}
+			case "vcs.time":
+				if res.BuildTime == "unknown" {
+					res.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+	return res
+}
+
+// version 핸들러는 실행 중인 서버의 빌드 정보를 응답한다.
+// healthz처럼 로그에 접근하지 않으므로 인증 없이 호출할 수 있다.
+func (s *httpServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(buildInfo())
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrUnknownAPIVersion은 /v3/처럼 서버가 모르는 API 버전의 경로를 요청했을 때 리턴한다.
+var ErrUnknownAPIVersion = errors.New("unknown api version")
+
+// apiVersion은 /name 아래에 엔드포인트를 등록하는 API 버전이다.
+type apiVersion struct {
+	name     string
+	register func(s *httpServer, r *mux.Router, o options)
+}
+
+// apiVersions는 서버가 제공하는 API 버전이다. 호환되지 않는 변경은 registerV2처럼 새 버전을 추가해서 등록하고,
+// 기존 버전은 그대로 두어 클라이언트가 옮겨갈 시간을 준다. 버전 없는 경로는 첫 번째 버전과 같다.
+var apiVersions = []apiVersion{
+	{name: "v1", register: (*httpServer).registerV1},
+}
+
+type apiVersionKey struct{}
+
+// withAPIVersion은 요청이 어느 버전 경로로 들어왔는지 컨텍스트에 넣는다.
+func withAPIVersion(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, name)))
+		})
+	}
+}
+
+// apiBase는 요청이 들어온 경로의 접두사와 버전이다(예: /api/proglog/v1). Location 헤더에
+// 같은 버전의 경로를 주기 위해 쓰고, 버전 없는 경로로 들어왔으면 접두사만 리턴한다.
+func (s *httpServer) apiBase(r *http.Request) string {
+	if v, ok := r.Context().Value(apiVersionKey{}).(string); ok {
+		return s.pathPrefix + "/" + v
+	}
+	return s.pathPrefix
+}
+
+var versionPath = regexp.MustCompile(`^/(v[0-9]+)(/|$)`)
+
+// unknownAPIVersion은 등록된 경로가 없는 요청이 모르는 버전 경로이면 그 버전을 리턴한다.
+// /v1/nope처럼 아는 버전의 없는 경로는 빈 문자열을 리턴해서 일반적인 not_found로 응답한다.
+func (s *httpServer) unknownAPIVersion(r *http.Request) string {
+	path, ok := strings.CutPrefix(r.URL.Path, s.pathPrefix)
+	if !ok {
+		return ""
+	}
+	m := versionPath.FindStringSubmatch(path)
+	if m == nil {
+		return ""
+	}
+	for _, v := range apiVersions {
+		if v.name == m[1] {
+			return ""
+		}
+	}
+	return m[1]
+}
+
+// unknownAPIVersionError는 지원하는 버전을 메시지에 담아서 클라이언트가 어느 버전으로 바꿀지 알 수 있게 한다.
+func unknownAPIVersionError(version string) error {
+	names := make([]string, len(apiVersions))
+	for i, v := range apiVersions {
+		names[i] = v.name
+	}
+	return fmt.Errorf("%w %q: supported versions are %s", ErrUnknownAPIVersion, version, strings.Join(names, ", "))
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrSubscriptionNotFound는 없는 구독을 지우려고 할 때 리턴한다.
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrInvalidSubscription은 구독의 URL이 http나 https의 절대 URL이 아닐 때 리턴한다.
+	ErrInvalidSubscription = errors.New("subscription url must be an absolute http or https url")
+)
+
+const (
+	// 전달에 연속으로 이만큼 실패하면 구독을 끈다. 데드레터가 있으면 maxFailures를 본다
+	webhookMaxFailures = 10
+	// 실패할 때마다 기다리는 시간이 두 배가 되고 webhookMaxBackoff를 넘지 않는다
+	webhookBaseBackoff = time.Second
+	webhookMaxBackoff  = time.Minute
+	// 구독자가 이 시간 안에 응답하지 않으면 실패로 본다
+	webhookTimeout = 10 * time.Second
+
+	subscriptionHeader = "X-Proglog-Subscription"
+	offsetHeader       = "X-Proglog-Offset"
+)
+
+// Subscription은 레코드를 받을 웹훅이다. NextOffset은 다음에 보낼 레코드의 오프셋이고,
+// 전달에 성공할 때마다 커진다. Disabled이면 더 이상 보내지 않는다.
+type Subscription struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	NextOffset uint64 `json:"nextOffset"`
+	Failures   int    `json:"failures"`
+	Disabled   bool   `json:"disabled"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+type SubscribeRequest struct {
+	URL        string `json:"url"`
+	FromOffset uint64 `json:"fromOffset"`
+}
+
+type SubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// WebhookDelivery는 구독자에게 POST 하는 바디다. 같은 레코드가 다시 전달될 수 있으므로
+// 구독자는 Offset으로 이미 처리한 레코드를 거른다.
+type WebhookDelivery struct {
+	Subscription string `json:"subscription"`
+	Offset       uint64 `json:"offset"`
+	Record       Record `json:"record"`
+}
+
+// webhooks는 구독마다 고루틴 하나로 레코드를 순서대로 전달한다. 구독자가 2xx로 응답해야 다음 레코드로 넘어가고,
+// 실패하면 같은 레코드를 백오프하며 다시 보낸다. 그래서 한 구독 안에서는 순서가 지켜지고 레코드를 건너뛰지 않는다.
+// deadLetters가 있으면 한 레코드를 maxAttempts번 보내지 못했을 때 데드레터 로그에 남기고 다음 레코드로 넘어간다.
+// path가 있으면 구독과 전달한 위치를 JSON 파일로 저장해서 재시작한 뒤에 이어서 보낸다.
+type webhooks struct {
+	log    CommitLog
+	client *http.Client
+	logger *slog.Logger
+
+	deadLetters CommitLog
+	maxAttempts int
+
+	mu     sync.Mutex
+	path   string
+	subs   map[string]*webhook
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type webhook struct {
+	Subscription
+	stop chan struct{}
+}
+
+// newWebhooks는 path 파일에서 구독을 읽어서 꺼지지 않은 구독의 전달을 시작한다. path가 비어있으면 메모리에만 저장한다.
+// deadLetters가 nil이면 데드레터를 남기지 않고 성공할 때까지 같은 레코드를 다시 보낸다.
+func newWebhooks(log CommitLog, path string, deadLetters CommitLog, maxAttempts int, logger *slog.Logger) (*webhooks, error) {
+	h := &webhooks{
+		log:         log,
+		client:      &http.Client{Timeout: webhookTimeout},
+		logger:      logger,
+		deadLetters: deadLetters,
+		maxAttempts: maxAttempts,
+		path:        path,
+		subs:        make(map[string]*webhook),
+	}
+	if path == "" {
+		return h, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subs []Subscription
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		h.start(&webhook{Subscription: sub, stop: make(chan struct{})})
+	}
+	return h, nil
+}
+
+// webhooksPath는 영속 Log라면 Log 디렉터리 안의 subscriptions.json을,
+// 메모리 Log나 다른 CommitLog 구현이라면 빈 문자열을 리턴한다.
+func webhooksPath(log CommitLog) string {
+	l, ok := log.(*Log)
+	if !ok || l.Dir == "" {
+		return ""
+	}
+	return filepath.Join(l.Dir, "subscriptions.json")
+}
+
+// Subscribe는 fromOffset부터 레코드를 url로 보내는 구독을 만든다.
+func (h *webhooks) Subscribe(rawURL string, fromOffset uint64) (Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, ErrInvalidSubscription
+	}
+	id, err := newSubscriptionID()
+	if err != nil {
+		return Subscription{}, err
+	}
+	wh := &webhook{
+		Subscription: Subscription{ID: id, URL: u.String(), NextOffset: fromOffset},
+		stop:         make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return Subscription{}, ErrLogClosed
+	}
+	h.subs[id] = wh
+	if err := h.save(); err != nil {
+		delete(h.subs, id)
+		return Subscription{}, err
+	}
+	h.start(wh)
+	return wh.Subscription, nil
+}
+
+// Unsubscribe는 구독을 지우고 전달을 멈춘다. 이미 보내고 있던 요청은 끝까지 기다리지 않는다.
+func (h *webhooks) Unsubscribe(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wh, ok := h.subs[id]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(h.subs, id)
+	if err := h.save(); err != nil {
+		h.subs[id] = wh
+		return err
+	}
+	wh.close()
+	return nil
+}
+
+// List는 구독들을 ID 순서로 리턴한다.
+func (h *webhooks) List() []Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := make([]Subscription, 0, len(h.subs))
+	for _, wh := range h.subs {
+		subs = append(subs, wh.Subscription)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+	return subs
+}
+
+// Close는 모든 구독의 전달을 멈추고 고루틴이 끝나기를 기다린다. 구독은 파일에 남아서 다음에 다시 시작한다.
+func (h *webhooks) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	for _, wh := range h.subs {
+		wh.close()
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+	return nil
+}
+
+// start는 mu를 잡은 상태에서 호출하거나 newWebhooks에서 호출한다. 꺼진 구독은 시작하지 않는다.
+func (h *webhooks) start(wh *webhook) {
+	h.subs[wh.ID] = wh
+	if wh.Disabled {
+		return
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.dispatch(wh)
+	}()
+}
+
+func (wh *webhook) close() {
+	select {
+	case <-wh.stop:
+	default:
+		close(wh.stop)
+	}
+}
+
+// dispatch는 구독이 멈출 때까지 NextOffset부터 레코드를 하나씩 전달하고, 끝까지 보냈으면 새 레코드를 기다린다.
+func (h *webhooks) dispatch(wh *webhook) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-wh.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for ctx.Err() == nil {
+		h.mu.Lock()
+		next := wh.NextOffset
+		h.mu.Unlock()
+		// 새 레코드를 놓치지 않도록 읽기 전에 기다릴 채널을 먼저 받는다
+		wait := appended(h.log)
+		it, err := readFrom(h.log, next)
+		if err == ErrOffsetOutOfRange {
+			// 보존 정책으로 지워진 레코드는 보낼 수 없으므로 남아있는 가장 앞의 레코드부터 보낸다
+			lowest, _, _ := bounds(h.log)
+			h.logger.Warn("webhook records were deleted before delivery",
+				slog.String("subscription", wh.ID),
+				slog.Uint64("from", next),
+				slog.Uint64("to", lowest),
+			)
+			h.advance(wh, lowest)
+			continue
+		}
+		if err != nil {
+			h.logger.Error("webhook read failed", slog.String("subscription", wh.ID), slog.Any("error", err))
+			return
+		}
+		delivered := false
+		for {
+			record, ok := it.Next()
+			if !ok {
+				break
+			}
+			if !h.deliver(ctx, wh, record) {
+				return
+			}
+			delivered = true
+		}
+		// 읽는 도중에 레코드가 지워졌으면 다시 ReadFrom을 호출해서 남아있는 레코드부터 보낸다
+		err = it.Err()
+		if err != nil && err != ErrOffsetOutOfRange {
+			h.logger.Error("webhook read failed", slog.String("subscription", wh.ID), slog.Any("error", err))
+			return
+		}
+		if delivered || err != nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-wait:
+		}
+	}
+}
+
+// deliver는 record가 성공적으로 전달될 때까지 백오프하며 다시 보낸다.
+// 데드레터 로그가 있으면 maxAttempts번 실패한 레코드를 구독을 끄기 전에 데드레터로 남기고 true를 리턴한다.
+// 구독이 멈추거나 연속 실패로 꺼지면 false를 리턴한다.
+func (h *webhooks) deliver(ctx context.Context, wh *webhook, record Record) bool {
+	for attempts := 1; ; attempts++ {
+		err := h.post(ctx, wh, record)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err == nil {
+			h.advance(wh, record.Offset+1)
+			return true
+		}
+		if h.deadLetters != nil && attempts >= h.maxAttempts && h.deadLetter(wh, record, attempts, err) {
+			return true
+		}
+		failures, disabled := h.fail(wh, err)
+		if disabled {
+			h.logger.Warn("webhook disabled after repeated failures",
+				slog.String("subscription", wh.ID),
+				slog.String("url", wh.URL),
+				slog.Any("error", err),
+			)
+			return false
+		}
+		backoff := min(webhookBaseBackoff<<(failures-1), webhookMaxBackoff)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (h *webhooks) post(ctx context.Context, wh *webhook, record Record) error {
+	body, err := json.Marshal(WebhookDelivery{Subscription: wh.ID, Offset: record.Offset, Record: record})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set(subscriptionHeader, wh.ID)
+	req.Header.Set(offsetHeader, strconv.FormatUint(record.Offset, 10))
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// 연결을 다시 쓸 수 있도록 바디를 조금 읽고 닫는다
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
+
+// advance는 다음에 보낼 오프셋을 기록하고 연속 실패 횟수를 지운다.
+func (h *webhooks) advance(wh *webhook, next uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wh.NextOffset = next
+	wh.Failures = 0
+	wh.LastError = ""
+	h.saveOrWarn()
+}
+
+// deadLetter는 record를 실패 이유와 함께 데드레터 로그에 남기고 다음 레코드로 넘어간다.
+// 다음 레코드는 처음부터 다시 세도록 연속 실패 횟수를 지우므로, 데드레터 로그에 쓸 수 있는 동안에는 구독이 꺼지지 않는다.
+// 데드레터 로그에 쓰지 못하면 레코드를 잃지 않도록 false를 리턴하고 같은 레코드를 다시 보낸다.
+func (h *webhooks) deadLetter(wh *webhook, record Record, attempts int, err error) bool {
+	off, appendErr := appendDeadLetter(h.deadLetters, DeadLetter{
+		Source:       deadLetterSourceWebhook,
+		Subscription: wh.ID,
+		URL:          wh.URL,
+		Attempts:     attempts,
+		Reason:       err.Error(),
+		Record:       record,
+	})
+	if appendErr != nil {
+		h.logger.Error("failed to write dead letter", slog.String("subscription", wh.ID), slog.Any("error", appendErr))
+		return false
+	}
+	h.logger.Warn("webhook record moved to dead letter log",
+		slog.String("subscription", wh.ID),
+		slog.Uint64("offset", record.Offset),
+		slog.Uint64("deadLetterOffset", off),
+		slog.Any("error", err),
+	)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wh.NextOffset = record.Offset + 1
+	wh.Failures = 0
+	wh.LastError = err.Error()
+	h.saveOrWarn()
+	return true
+}
+
+// fail은 연속 실패 횟수를 늘리고, maxFailures에 닿으면 구독을 끈다.
+func (h *webhooks) fail(wh *webhook, err error) (failures int, disabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wh.Failures++
+	wh.LastError = err.Error()
+	if wh.Failures >= h.maxFailures() {
+		wh.Disabled = true
+		h.saveOrWarn()
+	}
+	return wh.Failures, wh.Disabled
+}
+
+// maxFailures는 구독을 끄는 연속 실패 횟수다. 데드레터가 있으면 maxAttempts번째 실패에서 데드레터로 넘어가므로
+// 그보다 작지 않게 해서, 데드레터 로그에 쓰지 못할 때만 구독이 꺼지게 한다.
+func (h *webhooks) maxFailures() int {
+	if h.deadLetters != nil {
+		return max(webhookMaxFailures, h.maxAttempts)
+	}
+	return webhookMaxFailures
+}
+
+func (h *webhooks) saveOrWarn() {
+	if err := h.save(); err != nil {
+		h.logger.Warn("failed to save subscriptions", slog.Any("error", err))
+	}
+}
+
+// save는 mu를 잡은 상태에서 구독들을 임시 파일에 쓴 뒤 이름을 바꾼다.
+func (h *webhooks) save() error {
+	if h.path == "" {
+		return nil
+	}
+	subs := make([]Subscription, 0, len(h.subs))
+	for _, wh := range h.subs {
+		subs = append(subs, wh.Subscription)
+	}
+	b, err := json.Marshal(subs)
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+func newSubscriptionID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// subscribe 핸들러는 새 레코드를 url로 POST 하는 구독을 만들고 201과 함께 구독을 응답한다.
+func (s *httpServer) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var req SubscribeRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	sub, err := s.webhooks.Subscribe(req.URL, req.FromOffset)
+	if err == ErrInvalidSubscription {
+		s.httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("Location", s.apiBase(r)+"/subscriptions/"+sub.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// subscriptions 핸들러는 구독들과 각 구독이 어디까지 전달했는지, 꺼졌는지를 응답한다.
+func (s *httpServer) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(SubscriptionsResponse{Subscriptions: s.webhooks.List()}); err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// unsubscribe 핸들러는 구독을 지우고 204를 반환한다.
+func (s *httpServer) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	err := s.webhooks.Unsubscribe(mux.Vars(r)["id"])
+	if err == ErrSubscriptionNotFound {
+		s.httpError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}